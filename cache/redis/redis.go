@@ -1,6 +1,7 @@
 package redis
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -47,6 +48,44 @@ func (rc *Cache) do(commandName string, args ...interface{}) (reply interface{},
 	return c.Do(commandName, args...)
 }
 
+// Do run a redis command on the cache connection pool, args[0] must be the key name.
+// It is used for commands the Cache interface does not cover, e.g. sorted sets.
+func (rc *Cache) Do(commandName string, args ...interface{}) (reply interface{}, err error) {
+	return rc.do(commandName, args...)
+}
+
+// Eval run a lua script on the cache connection pool, keys are associated with the collection name.
+func (rc *Cache) Eval(script *redis.Script, keys []string, args ...interface{}) (reply interface{}, err error) {
+	keysAndArgs := make([]interface{}, 0, len(keys)+len(args))
+	for _, key := range keys {
+		keysAndArgs = append(keysAndArgs, rc.associate(key))
+	}
+	keysAndArgs = append(keysAndArgs, args...)
+	c := rc.p.Get()
+	defer c.Close()
+
+	return script.Do(c, keysAndArgs...)
+}
+
+// Ping send PING on a pooled connection, used for health checks.
+func (rc *Cache) Ping(ctx context.Context) error {
+	if rc.p == nil {
+		return errors.New("redis cache is not started")
+	}
+	c, err := rc.p.GetContext(ctx)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+
+	if deadline, ok := ctx.Deadline(); ok {
+		_, err = redis.DoWithTimeout(c, time.Until(deadline), "PING")
+	} else {
+		_, err = c.Do("PING")
+	}
+	return err
+}
+
 // associate with config key.
 func (rc *Cache) associate(originKey interface{}) string {
 	return fmt.Sprintf("%s:%s", rc.key, originKey)
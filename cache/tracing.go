@@ -0,0 +1,80 @@
+package cache
+
+import (
+	"context"
+	"time"
+
+	"github.com/Tokumicn/lego-lib/tracing"
+)
+
+// WithContext 返回在ctx链路下为每次调用创建span的Cache
+// Cache接口不带context 需要链路时按请求包装: cache.WithContext(ctx, bm).Get(key)
+func WithContext(ctx context.Context, c Cache) Cache {
+	return &tracedCache{ctx: ctx, cache: c}
+}
+
+type tracedCache struct {
+	ctx   context.Context
+	cache Cache
+}
+
+func (t *tracedCache) start(op, key string) *tracing.Span {
+	_, span := tracing.StartSpan(t.ctx, "cache "+op, tracing.KindClient)
+	if key != "" {
+		span.SetAttribute("cache.key", key)
+	}
+	return span
+}
+
+func (t *tracedCache) finish(span *tracing.Span, err error) error {
+	span.SetError(err)
+	span.End()
+	return err
+}
+
+func (t *tracedCache) Get(key string) interface{} {
+	span := t.start("Get", key)
+	defer span.End()
+	return t.cache.Get(key)
+}
+
+func (t *tracedCache) GetMulti(keys []string) []interface{} {
+	span := t.start("GetMulti", "")
+	defer span.End()
+	return t.cache.GetMulti(keys)
+}
+
+func (t *tracedCache) Put(key string, val interface{}, timeout time.Duration) error {
+	span := t.start("Put", key)
+	return t.finish(span, t.cache.Put(key, val, timeout))
+}
+
+func (t *tracedCache) Delete(key string) error {
+	span := t.start("Delete", key)
+	return t.finish(span, t.cache.Delete(key))
+}
+
+func (t *tracedCache) Incr(key string) error {
+	span := t.start("Incr", key)
+	return t.finish(span, t.cache.Incr(key))
+}
+
+func (t *tracedCache) Decr(key string) error {
+	span := t.start("Decr", key)
+	return t.finish(span, t.cache.Decr(key))
+}
+
+func (t *tracedCache) IsExist(key string) bool {
+	span := t.start("IsExist", key)
+	defer span.End()
+	return t.cache.IsExist(key)
+}
+
+func (t *tracedCache) ClearAll() error {
+	span := t.start("ClearAll", "")
+	return t.finish(span, t.cache.ClearAll())
+}
+
+func (t *tracedCache) StartAndGC(config string) error {
+	return t.cache.StartAndGC(config)
+}
@@ -1,7 +1,10 @@
 package elastic
 
 import (
+	"net/http"
+
 	"github.com/Tokumicn/lego-lib/logs"
+	"github.com/Tokumicn/lego-lib/tracing"
 	"gopkg.in/olivere/elastic.v5"
 )
 
@@ -36,7 +39,9 @@ func NewElastic(conf *Config) *Elastic {
 
 func connect(conf *Config) (*elastic.Client, error) {
 
-	client, err := elastic.NewClient(elastic.SetURL(conf.Hosts))
+	// 每次请求记录为span并向es传递traceparent
+	httpClient := &http.Client{Transport: tracing.NewTransport(nil)}
+	client, err := elastic.NewClient(elastic.SetURL(conf.Hosts), elastic.SetHttpClient(httpClient))
 	if err != nil {
 		return nil, err
 	}
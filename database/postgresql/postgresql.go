@@ -1,6 +1,7 @@
 package postgresql
 
 import (
+	"context"
 	"fmt"
 	"time"
 
@@ -27,6 +28,9 @@ type Pool struct {
 // NodeConfig 一个实例配置
 type NodeConfig struct {
 	Host    string `toml:"host"`
+	Auth    string `toml:"auth"` // user:password
+	Name    string `toml:"name"` // 数据库名
+	Opts    string `toml:"opts"` // 连接参数 如sslmode=disable
 	MaxIdle int    `toml:"max_idle"`
 	MaxOpen int    `toml:"max_open"`
 	MaxLife int    `toml:"max_life"`
@@ -53,8 +57,18 @@ func NewPool(conf *Config) *Pool {
 	return pool
 }
 
+// DB 获取连接池对应的gorm实例
+func (p *Pool) DB() *DB {
+	return p.db
+}
+
+// Ping 检查数据库连接 用于健康检查
+func (p *Pool) Ping(ctx context.Context) error {
+	return p.db.DB().PingContext(ctx)
+}
+
 func connect(debug bool, node *NodeConfig) (*gorm.DB, error) {
-	dst := fmt.Sprintf("%s@tcp(%s)/%s", node.Auth, node.Host, node.Name)
+	dst := fmt.Sprintf("postgres://%s@%s/%s", node.Auth, node.Host, node.Name)
 	if len(node.Opts) > 0 {
 		dst = dst + "?" + node.Opts
 	}
@@ -66,6 +80,7 @@ func connect(debug bool, node *NodeConfig) (*gorm.DB, error) {
 	if debug {
 		orm.LogMode(true)
 	}
+	registerTracing(orm)
 
 	orm.DB().SetMaxIdleConns(node.MaxIdle)
 	orm.DB().SetMaxOpenConns(node.MaxOpen)
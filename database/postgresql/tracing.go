@@ -0,0 +1,68 @@
+package postgresql
+
+import (
+	"context"
+
+	"github.com/jinzhu/gorm"
+
+	"github.com/Tokumicn/lego-lib/tracing"
+)
+
+const (
+	tracingContextKey = "lego:tracing_context"
+	tracingSpanKey    = "lego:tracing_span"
+)
+
+// WithContext 返回在ctx链路下执行的DB 之后的sql调用记录为span
+// gorm v1不支持context 需要链路时按请求包装: postgresql.WithContext(ctx, pool.DB()).Find(&rows)
+func WithContext(ctx context.Context, db *DB) *DB {
+	return db.Set(tracingContextKey, ctx)
+}
+
+func registerTracing(db *gorm.DB) {
+	cb := db.Callback()
+	cb.Create().Before("gorm:begin_transaction").Register("tracing:before_create", startSpan("create"))
+	cb.Create().After("gorm:commit_or_rollback_transaction").Register("tracing:after_create", endSpan)
+	cb.Update().Before("gorm:begin_transaction").Register("tracing:before_update", startSpan("update"))
+	cb.Update().After("gorm:commit_or_rollback_transaction").Register("tracing:after_update", endSpan)
+	cb.Delete().Before("gorm:begin_transaction").Register("tracing:before_delete", startSpan("delete"))
+	cb.Delete().After("gorm:commit_or_rollback_transaction").Register("tracing:after_delete", endSpan)
+	cb.Query().Before("gorm:query").Register("tracing:before_query", startSpan("query"))
+	cb.Query().After("gorm:after_query").Register("tracing:after_query", endSpan)
+	cb.RowQuery().Before("gorm:row_query").Register("tracing:before_row_query", startSpan("row_query"))
+	cb.RowQuery().After("gorm:row_query").Register("tracing:after_row_query", endSpan)
+}
+
+func startSpan(op string) func(scope *gorm.Scope) {
+	return func(scope *gorm.Scope) {
+		v, ok := scope.Get(tracingContextKey)
+		if !ok {
+			return
+		}
+		ctx, ok := v.(context.Context)
+		if !ok {
+			return
+		}
+
+		_, span := tracing.StartSpan(ctx, "postgresql "+op, tracing.KindClient)
+		span.SetAttribute("db.table", scope.TableName())
+		scope.Set(tracingSpanKey, span)
+	}
+}
+
+func endSpan(scope *gorm.Scope) {
+	v, ok := scope.Get(tracingSpanKey)
+	if !ok {
+		return
+	}
+	span, ok := v.(*tracing.Span)
+	if !ok {
+		return
+	}
+
+	span.SetAttribute("db.statement", scope.SQL)
+	if err := scope.DB().Error; err != nil && !gorm.IsRecordNotFoundError(err) {
+		span.SetError(err)
+	}
+	span.End()
+}
@@ -1 +1,876 @@
 package gin
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/Tokumicn/lego-lib/cache/redis"
+	"github.com/Tokumicn/lego-lib/logs"
+	httpclient "github.com/Tokumicn/lego-lib/net/http"
+	legocrypto "github.com/Tokumicn/lego-lib/utils/crypto"
+)
+
+// 认证失败时ErrorResponse使用的错误码
+const (
+	CodeUnauthorized     = 40100 // 缺少凭证
+	CodeInvalidToken     = 40101 // token格式 算法或签名错误
+	CodeTokenExpired     = 40102 // token过期或未生效
+	CodeInvalidClaims    = 40103 // issuer audience不匹配或缺少必需的claim
+	CodeInvalidAPIKey    = 40104 // api key不存在或已过期
+	CodeInvalidSignature = 40105 // 请求签名错误
+	CodeRequestExpired   = 40106 // 请求时间戳超出范围或nonce重复
+	CodeAuthUnavailable  = 50300 // 凭证存储不可用
+)
+
+// IdentityKey 认证通过后*Identity在gin.Context中的key
+const IdentityKey = "lego.identity"
+
+// 认证方式
+const (
+	AuthJWT       = "jwt"
+	AuthAPIKey    = "apikey"
+	AuthSignature = "signature"
+)
+
+// Identity 认证通过的调用方
+type Identity struct {
+	Subject string
+	// Method 认证方式 AuthJWT AuthAPIKey AuthSignature
+	Method string
+	Roles  []string
+	// Claims JWT认证时的claims
+	Claims Claims
+	// APIKey api key或签名认证时的凭证
+	APIKey *APIKey
+}
+
+// GetIdentity 获取认证中间件写入的调用方
+func GetIdentity(c *gin.Context) (*Identity, bool) {
+	v, ok := c.Get(IdentityKey)
+	if !ok {
+		return nil, false
+	}
+	identity, ok := v.(*Identity)
+	return identity, ok
+}
+
+func abortAuth(c *gin.Context, code int, msg string) {
+	status := http.StatusUnauthorized
+	if code == CodeAuthUnavailable {
+		status = http.StatusServiceUnavailable
+	}
+	c.AbortWithStatusJSON(status, ErrorResponse(code, msg))
+}
+
+// Claims JWT payload 数字以json.Number保存
+type Claims map[string]interface{}
+
+// String 获取字符串claim
+func (c Claims) String(name string) string {
+	s, _ := c[name].(string)
+	return s
+}
+
+// Strings 获取字符串或字符串数组claim
+func (c Claims) Strings(name string) []string {
+	switch v := c[name].(type) {
+	case string:
+		return []string{v}
+	case []interface{}:
+		result := make([]string, 0, len(v))
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				result = append(result, s)
+			}
+		}
+		return result
+	}
+	return nil
+}
+
+// Time 获取NumericDate类型的claim 不存在或格式错误时ok为false
+func (c Claims) Time(name string) (t time.Time, ok bool) {
+	n, ok := c[name].(json.Number)
+	if !ok {
+		return time.Time{}, false
+	}
+	f, err := n.Float64()
+	if err != nil {
+		return time.Time{}, false
+	}
+	sec := int64(f)
+	return time.Unix(sec, int64((f-float64(sec))*1e9)), true
+}
+
+// JWTConfig JWT认证配置 HS算法使用Secret RS ES算法使用JWKS或Keys中的公钥
+type JWTConfig struct {
+	Secret string `toml:"secret"`
+	// JWKSFile JWKS文件 启动时读取
+	JWKSFile string `toml:"jwks_file"`
+	// JWKSURL JWKS地址 按JWKSRefresh定期刷新 遇到未知kid时最多每分钟刷新一次
+	JWKSURL     string        `toml:"jwks_url"`
+	JWKSRefresh time.Duration `toml:"jwks_refresh"` // 默认10m
+	// Keys 按kid配置的公钥 *rsa.PublicKey或*ecdsa.PublicKey
+	Keys map[string]crypto.PublicKey `toml:"-"`
+
+	// Algorithms 允许的算法 默认按配置的密钥允许HS256/384/512或RS ES 256/384/512
+	Algorithms []string `toml:"algorithms"`
+	Issuer     string   `toml:"issuer"`
+	Audience   string   `toml:"audience"`
+	// ClockSkew 校验exp nbf时允许的时钟偏差
+	ClockSkew time.Duration `toml:"clock_skew"`
+	// RequiredClaims 必须存在的claim 如exp sub
+	RequiredClaims []string `toml:"required_claims"`
+	// RolesClaim 读取角色的claim 默认roles
+	RolesClaim string `toml:"roles_claim"`
+	// Cookie 未携带Authorization头时从该cookie读取token
+	Cookie string `toml:"cookie"`
+}
+
+var algorithmHashes = map[string]crypto.Hash{
+	"HS256": crypto.SHA256, "HS384": crypto.SHA384, "HS512": crypto.SHA512,
+	"RS256": crypto.SHA256, "RS384": crypto.SHA384, "RS512": crypto.SHA512,
+	"ES256": crypto.SHA256, "ES384": crypto.SHA384, "ES512": crypto.SHA512,
+}
+
+var errUnknownKey = errors.New("unknown signing key")
+
+// JWT 返回Bearer token认证中间件 通过后写入*Identity Subject为sub claim
+// 配置错误时panic
+func JWT(conf JWTConfig) gin.HandlerFunc {
+	v := newJWTVerifier(conf)
+	return func(c *gin.Context) {
+		token := bearerToken(c.Request)
+		if token == "" && conf.Cookie != "" {
+			token, _ = c.Cookie(conf.Cookie)
+		}
+		if token == "" {
+			abortAuth(c, CodeUnauthorized, "missing bearer token")
+			return
+		}
+
+		claims, code, err := v.verify(c.Request.Context(), token)
+		if err != nil {
+			logs.WithContext(c.Request.Context()).Warnf("jwt auth %s err:%s", c.Request.URL.Path, err)
+			abortAuth(c, code, err.Error())
+			return
+		}
+		c.Set(IdentityKey, &Identity{
+			Subject: claims.String("sub"),
+			Method:  AuthJWT,
+			Roles:   claims.Strings(v.conf.RolesClaim),
+			Claims:  claims,
+		})
+		c.Next()
+	}
+}
+
+func bearerToken(r *http.Request) string {
+	auth := r.Header.Get("Authorization")
+	if len(auth) > 7 && strings.EqualFold(auth[:7], "Bearer ") {
+		return strings.TrimSpace(auth[7:])
+	}
+	return ""
+}
+
+type jwtVerifier struct {
+	conf    JWTConfig
+	allowed map[string]bool
+	keys    *jwks
+}
+
+func newJWTVerifier(conf JWTConfig) *jwtVerifier {
+	if conf.RolesClaim == "" {
+		conf.RolesClaim = "roles"
+	}
+	if conf.JWKSRefresh == 0 {
+		conf.JWKSRefresh = 10 * time.Minute
+	}
+	v := &jwtVerifier{conf: conf, allowed: make(map[string]bool)}
+
+	hasPublic := conf.JWKSFile != "" || conf.JWKSURL != "" || len(conf.Keys) > 0
+	if conf.Secret == "" && !hasPublic {
+		panic("gin: JWT needs a secret, JWKS or keys")
+	}
+	if hasPublic {
+		v.keys = &jwks{url: conf.JWKSURL, refresh: conf.JWKSRefresh, keys: make(map[string]crypto.PublicKey)}
+		for kid, key := range conf.Keys {
+			v.keys.static(kid, key)
+		}
+		if conf.JWKSFile != "" {
+			data, err := ioutil.ReadFile(conf.JWKSFile)
+			if err != nil {
+				panic(err)
+			}
+			keys, err := parseJWKS(data)
+			if err != nil {
+				panic(fmt.Sprintf("gin: parse %s: %v", conf.JWKSFile, err))
+			}
+			for kid, key := range keys {
+				v.keys.static(kid, key)
+			}
+		}
+	}
+
+	algorithms := conf.Algorithms
+	if len(algorithms) == 0 {
+		if conf.Secret != "" {
+			algorithms = append(algorithms, "HS256", "HS384", "HS512")
+		}
+		if hasPublic {
+			algorithms = append(algorithms, "RS256", "RS384", "RS512", "ES256", "ES384", "ES512")
+		}
+	}
+	for _, alg := range algorithms {
+		if _, ok := algorithmHashes[alg]; !ok {
+			panic(fmt.Sprintf("gin: unsupported JWT algorithm %q", alg))
+		}
+		v.allowed[alg] = true
+	}
+	return v
+}
+
+type jwtHeader struct {
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+}
+
+// verify 校验签名与标准claims 失败时返回错误码
+func (v *jwtVerifier) verify(ctx context.Context, token string) (Claims, int, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, CodeInvalidToken, errors.New("malformed token")
+	}
+	var header jwtHeader
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, CodeInvalidToken, fmt.Errorf("malformed token header: %v", err)
+	}
+	if !v.allowed[header.Alg] {
+		return nil, CodeInvalidToken, fmt.Errorf("algorithm %q not allowed", header.Alg)
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(parts[2], "="))
+	if err != nil {
+		return nil, CodeInvalidToken, errors.New("malformed token signature")
+	}
+	if err := v.verifySignature(ctx, header, parts[0]+"."+parts[1], signature); err != nil {
+		return nil, CodeInvalidToken, err
+	}
+
+	var claims Claims
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return nil, CodeInvalidToken, fmt.Errorf("malformed token claims: %v", err)
+	}
+	code, err := v.validate(claims)
+	return claims, code, err
+}
+
+func (v *jwtVerifier) verifySignature(ctx context.Context, header jwtHeader, signed string, signature []byte) error {
+	hash := algorithmHashes[header.Alg]
+	if header.Alg[:2] == "HS" {
+		if v.conf.Secret == "" {
+			return errUnknownKey
+		}
+		mac := hmac.New(hash.New, []byte(v.conf.Secret))
+		mac.Write([]byte(signed))
+		if !hmac.Equal(mac.Sum(nil), signature) {
+			return errors.New("invalid signature")
+		}
+		return nil
+	}
+
+	if v.keys == nil {
+		return errUnknownKey
+	}
+	key, err := v.keys.get(ctx, header.Kid, header.Alg)
+	if err != nil {
+		return err
+	}
+	h := hash.New()
+	h.Write([]byte(signed))
+	digest := h.Sum(nil)
+
+	switch key := key.(type) {
+	case *rsa.PublicKey:
+		if err := rsa.VerifyPKCS1v15(key, hash, digest, signature); err != nil {
+			return errors.New("invalid signature")
+		}
+		return nil
+	case *ecdsa.PublicKey:
+		size := (key.Curve.Params().BitSize + 7) / 8
+		if len(signature) != 2*size || key.Curve.Params().BitSize != curveBits(header.Alg) {
+			return errors.New("invalid signature")
+		}
+		r := new(big.Int).SetBytes(signature[:size])
+		s := new(big.Int).SetBytes(signature[size:])
+		if !ecdsa.Verify(key, digest, r, s) {
+			return errors.New("invalid signature")
+		}
+		return nil
+	}
+	return errUnknownKey
+}
+
+// curveBits ES算法对应的曲线位数 ES512使用P-521
+func curveBits(alg string) int {
+	switch alg {
+	case "ES256":
+		return 256
+	case "ES384":
+		return 384
+	}
+	return 521
+}
+
+func (v *jwtVerifier) validate(claims Claims) (int, error) {
+	for _, name := range v.conf.RequiredClaims {
+		if _, ok := claims[name]; !ok {
+			return CodeInvalidClaims, fmt.Errorf("missing claim %s", name)
+		}
+	}
+
+	now := time.Now()
+	if _, ok := claims["exp"]; ok {
+		exp, ok := claims.Time("exp")
+		if !ok {
+			return CodeInvalidClaims, errors.New("malformed exp claim")
+		}
+		if !now.Before(exp.Add(v.conf.ClockSkew)) {
+			return CodeTokenExpired, errors.New("token expired")
+		}
+	}
+	if _, ok := claims["nbf"]; ok {
+		nbf, ok := claims.Time("nbf")
+		if !ok {
+			return CodeInvalidClaims, errors.New("malformed nbf claim")
+		}
+		if now.Add(v.conf.ClockSkew).Before(nbf) {
+			return CodeTokenExpired, errors.New("token not valid yet")
+		}
+	}
+
+	if v.conf.Issuer != "" && claims.String("iss") != v.conf.Issuer {
+		return CodeInvalidClaims, errors.New("invalid issuer")
+	}
+	if v.conf.Audience != "" {
+		found := false
+		for _, aud := range claims.Strings("aud") {
+			if aud == v.conf.Audience {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return CodeInvalidClaims, errors.New("invalid audience")
+		}
+	}
+	return 0, nil
+}
+
+func decodeSegment(seg string, v interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(seg, "="))
+	if err != nil {
+		return err
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	return dec.Decode(v)
+}
+
+// jwks 按kid缓存的公钥 配置的静态公钥不会被刷新覆盖
+type jwks struct {
+	url     string
+	refresh time.Duration
+
+	mu       sync.Mutex
+	keys     map[string]crypto.PublicKey
+	fixed    map[string]crypto.PublicKey
+	fetched  time.Time
+	attempts time.Time
+	// refreshing 进行中的下载 完成时关闭
+	refreshing chan struct{}
+}
+
+func (k *jwks) static(kid string, key crypto.PublicKey) {
+	if k.fixed == nil {
+		k.fixed = make(map[string]crypto.PublicKey)
+	}
+	k.fixed[kid] = key
+}
+
+// get 按kid查找公钥 kid为空时使用唯一一个与alg类型匹配的公钥
+// 过期的JWKS在后台刷新 期间使用缓存的公钥 只有kid未知时等待下载
+func (k *jwks) get(ctx context.Context, kid, alg string) (crypto.PublicKey, error) {
+	k.mu.Lock()
+	now := time.Now()
+	if k.url != "" && now.Sub(k.fetched) > k.refresh && now.Sub(k.attempts) > time.Second {
+		k.startFetch()
+	}
+	key := k.lookup(kid, alg)
+	// 密钥轮换时可能出现新的kid 限制刷新频率
+	var wait chan struct{}
+	if key == nil && k.url != "" {
+		wait = k.refreshing
+		if wait == nil && now.Sub(k.attempts) > time.Minute {
+			wait = k.startFetch()
+		}
+	}
+	k.mu.Unlock()
+
+	if wait != nil {
+		select {
+		case <-wait:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+		k.mu.Lock()
+		key = k.lookup(kid, alg)
+		k.mu.Unlock()
+	}
+	if key == nil {
+		return nil, errUnknownKey
+	}
+	return key, nil
+}
+
+// startFetch 在后台下载JWKS 已有下载进行中时复用 调用方持有k.mu
+func (k *jwks) startFetch() chan struct{} {
+	if k.refreshing != nil {
+		return k.refreshing
+	}
+	done := make(chan struct{})
+	k.refreshing = done
+	k.attempts = time.Now()
+	go func() {
+		defer close(done)
+		keys, err := k.fetch()
+		k.mu.Lock()
+		defer k.mu.Unlock()
+		if err == nil {
+			k.keys = keys
+			k.fetched = time.Now()
+		}
+		k.refreshing = nil
+	}()
+	return done
+}
+
+func (k *jwks) lookup(kid, alg string) crypto.PublicKey {
+	if kid != "" {
+		if key, ok := k.fixed[kid]; ok {
+			return key
+		}
+		return k.keys[kid]
+	}
+
+	var found crypto.PublicKey
+	for _, keys := range []map[string]crypto.PublicKey{k.fixed, k.keys} {
+		for _, key := range keys {
+			if !keyMatches(key, alg) {
+				continue
+			}
+			if found != nil {
+				return nil
+			}
+			found = key
+		}
+	}
+	return found
+}
+
+func keyMatches(key crypto.PublicKey, alg string) bool {
+	switch key.(type) {
+	case *rsa.PublicKey:
+		return alg[:2] == "RS"
+	case *ecdsa.PublicKey:
+		return alg[:2] == "ES"
+	}
+	return false
+}
+
+// fetch 下载JWKS 不受请求取消影响 失败时保留之前的公钥
+func (k *jwks) fetch() (map[string]crypto.PublicKey, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	body, r := httpclient.NewFastRequest(k.url).SetContext(ctx).SetName("jwks").ToBytes()
+	if r.Error != nil {
+		logs.Errorf("fetch jwks %s err:%s", k.url, r.Error)
+		return nil, r.Error
+	}
+	keys, err := parseJWKS(body)
+	if err != nil {
+		logs.Errorf("parse jwks %s err:%s", k.url, err)
+		return nil, err
+	}
+	return keys, nil
+}
+
+type jsonWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// parseJWKS 解析RSA与EC公钥 跳过用于加密及不支持的key
+func parseJWKS(data []byte) (map[string]crypto.PublicKey, error) {
+	var set struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &set); err != nil {
+		return nil, err
+	}
+
+	keys := make(map[string]crypto.PublicKey)
+	for _, jwk := range set.Keys {
+		if jwk.Use == "enc" {
+			continue
+		}
+		switch jwk.Kty {
+		case "RSA":
+			n, errN := decodeBigInt(jwk.N)
+			e, errE := decodeBigInt(jwk.E)
+			if errN != nil || errE != nil || !e.IsInt64() {
+				return nil, fmt.Errorf("malformed RSA key %q", jwk.Kid)
+			}
+			keys[jwk.Kid] = &rsa.PublicKey{N: n, E: int(e.Int64())}
+		case "EC":
+			var curve elliptic.Curve
+			switch jwk.Crv {
+			case "P-256":
+				curve = elliptic.P256()
+			case "P-384":
+				curve = elliptic.P384()
+			case "P-521":
+				curve = elliptic.P521()
+			default:
+				continue
+			}
+			x, errX := decodeBigInt(jwk.X)
+			y, errY := decodeBigInt(jwk.Y)
+			if errX != nil || errY != nil || !curve.IsOnCurve(x, y) {
+				return nil, fmt.Errorf("malformed EC key %q", jwk.Kid)
+			}
+			keys[jwk.Kid] = &ecdsa.PublicKey{Curve: curve, X: x, Y: y}
+		}
+	}
+	return keys, nil
+}
+
+func decodeBigInt(s string) (*big.Int, error) {
+	data, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(s, "="))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) == 0 {
+		return nil, errors.New("empty value")
+	}
+	return new(big.Int).SetBytes(data), nil
+}
+
+// APIKey api key凭证 签名认证时Key为AppKey
+type APIKey struct {
+	Key     string
+	Secret  string `json:"-"` // 签名认证的密钥
+	Subject string
+	Roles   []string
+	// ExpiresAt 零值表示不过期
+	ExpiresAt time.Time
+}
+
+// APIKeyStore 凭证存储 key不存在时返回nil, nil
+type APIKeyStore interface {
+	Lookup(ctx context.Context, key string) (*APIKey, error)
+}
+
+type staticAPIKeyStore map[[sha256.Size]byte]*APIKey
+
+// NewStaticAPIKeyStore 内存中的凭证存储 按key的sha256查找
+func NewStaticAPIKeyStore(keys ...*APIKey) APIKeyStore {
+	store := make(staticAPIKeyStore, len(keys))
+	for _, key := range keys {
+		store[sha256.Sum256([]byte(key.Key))] = key
+	}
+	return store
+}
+
+func (s staticAPIKeyStore) Lookup(ctx context.Context, key string) (*APIKey, error) {
+	return s[sha256.Sum256([]byte(key))], nil
+}
+
+// APIKeyConfig api key认证配置
+type APIKeyConfig struct {
+	Store  APIKeyStore `toml:"-"`
+	Header string      `toml:"header"` // 默认X-Api-Key
+	// Query 未携带请求头时从该查询参数读取 默认不读取
+	Query string `toml:"query"`
+}
+
+// APIKeyAuth 返回api key认证中间件 通过后写入*Identity
+func APIKeyAuth(conf APIKeyConfig) gin.HandlerFunc {
+	if conf.Store == nil {
+		panic("gin: APIKeyAuth needs a store")
+	}
+	if conf.Header == "" {
+		conf.Header = "X-Api-Key"
+	}
+	return func(c *gin.Context) {
+		key := c.GetHeader(conf.Header)
+		if key == "" && conf.Query != "" {
+			key = c.Query(conf.Query)
+		}
+		if key == "" {
+			abortAuth(c, CodeUnauthorized, "missing api key")
+			return
+		}
+
+		apiKey, code, err := lookupKey(c.Request.Context(), conf.Store, key)
+		if err != nil {
+			abortAuth(c, code, err.Error())
+			return
+		}
+		c.Set(IdentityKey, &Identity{Subject: apiKey.Subject, Method: AuthAPIKey, Roles: apiKey.Roles, APIKey: apiKey})
+		c.Next()
+	}
+}
+
+func lookupKey(ctx context.Context, store APIKeyStore, key string) (*APIKey, int, error) {
+	apiKey, err := store.Lookup(ctx, key)
+	if err != nil {
+		logs.WithContext(ctx).Errorf("api key store lookup err:%s", err)
+		return nil, CodeAuthUnavailable, errors.New("credential store unavailable")
+	}
+	if apiKey == nil {
+		return nil, CodeInvalidAPIKey, errors.New("invalid api key")
+	}
+	if !apiKey.ExpiresAt.IsZero() && time.Now().After(apiKey.ExpiresAt) {
+		return nil, CodeInvalidAPIKey, errors.New("api key expired")
+	}
+	return apiKey, 0, nil
+}
+
+// SignatureConfig 请求签名校验配置 与net/http.SignRequest的签名规则一致
+type SignatureConfig struct {
+	Store     APIKeyStore          `toml:"-"`
+	Algorithm legocrypto.Algorithm `toml:"algorithm"` // 默认sha256
+	// MaxSkew 请求时间戳与服务器时间的最大偏差 默认5m
+	MaxSkew time.Duration `toml:"max_skew"`
+	// Nonces 设置后拒绝2*MaxSkew时间内重复的nonce 存储出错时拒绝请求
+	Nonces NonceStore `toml:"-"`
+	// MaxBodySize 计算签名时读取的最大请求体 默认10MB
+	MaxBodySize int64 `toml:"max_body_size"`
+
+	// 请求头名称 为空时使用X-App-Key X-Timestamp X-Nonce X-Signature
+	AppKeyHeader    string `toml:"app_key_header"`
+	TimestampHeader string `toml:"timestamp_header"`
+	NonceHeader     string `toml:"nonce_header"`
+	SignatureHeader string `toml:"signature_header"`
+}
+
+// VerifySignature 返回HMAC请求签名校验中间件 参与签名的参数为查询参数
+// 以及application/x-www-form-urlencoded请求的表单参数 请求体以SHA-256哈希参与签名 通过后写入*Identity
+func VerifySignature(conf SignatureConfig) gin.HandlerFunc {
+	if conf.Store == nil {
+		panic("gin: VerifySignature needs a store")
+	}
+	if conf.Algorithm == "" {
+		conf.Algorithm = legocrypto.SHA256
+	}
+	if _, err := conf.Algorithm.New(); err != nil {
+		panic(err)
+	}
+	if conf.MaxSkew == 0 {
+		conf.MaxSkew = 5 * time.Minute
+	}
+	if conf.MaxBodySize <= 0 {
+		conf.MaxBodySize = 10 << 20
+	}
+	if conf.AppKeyHeader == "" {
+		conf.AppKeyHeader = "X-App-Key"
+	}
+	if conf.TimestampHeader == "" {
+		conf.TimestampHeader = "X-Timestamp"
+	}
+	if conf.NonceHeader == "" {
+		conf.NonceHeader = "X-Nonce"
+	}
+	if conf.SignatureHeader == "" {
+		conf.SignatureHeader = "X-Signature"
+	}
+
+	return func(c *gin.Context) {
+		appKey, timestamp := c.GetHeader(conf.AppKeyHeader), c.GetHeader(conf.TimestampHeader)
+		nonce, signature := c.GetHeader(conf.NonceHeader), c.GetHeader(conf.SignatureHeader)
+		if appKey == "" || timestamp == "" || nonce == "" || signature == "" {
+			abortAuth(c, CodeUnauthorized, "missing signature headers")
+			return
+		}
+
+		sec, err := strconv.ParseInt(timestamp, 10, 64)
+		if err != nil {
+			abortAuth(c, CodeRequestExpired, "malformed timestamp")
+			return
+		}
+		if skew := time.Since(time.Unix(sec, 0)); skew > conf.MaxSkew || skew < -conf.MaxSkew {
+			abortAuth(c, CodeRequestExpired, "timestamp out of range")
+			return
+		}
+
+		apiKey, code, err := lookupKey(c.Request.Context(), conf.Store, appKey)
+		if err != nil {
+			abortAuth(c, code, err.Error())
+			return
+		}
+
+		body, err := signedBody(c.Request, conf.MaxBodySize)
+		if err != nil {
+			abortAuth(c, CodeInvalidSignature, err.Error())
+			return
+		}
+		params, err := signedParams(c.Request, body)
+		if err != nil {
+			abortAuth(c, CodeInvalidSignature, "malformed form body")
+			return
+		}
+		canonical := httpclient.CanonicalString(c.Request.Method, c.Request.URL.EscapedPath(), params,
+			httpclient.BodyHash(body), timestamp, nonce)
+		expected, err := legocrypto.HmacWith(conf.Algorithm, apiKey.Secret, canonical)
+		if err != nil || !hmac.Equal([]byte(expected), []byte(strings.ToLower(signature))) {
+			abortAuth(c, CodeInvalidSignature, "invalid signature")
+			return
+		}
+
+		// 签名通过后再记录nonce 避免伪造请求占用
+		if conf.Nonces != nil {
+			ok, err := conf.Nonces.Use(c.Request.Context(), "sign_nonce:"+appKey+":"+nonce, 2*conf.MaxSkew)
+			if err != nil {
+				logs.WithContext(c.Request.Context()).Errorf("signature nonce store err:%s", err)
+				abortAuth(c, CodeAuthUnavailable, "nonce store unavailable")
+				return
+			}
+			if !ok {
+				abortAuth(c, CodeRequestExpired, "nonce reused")
+				return
+			}
+		}
+
+		c.Set(IdentityKey, &Identity{Subject: apiKey.Subject, Method: AuthSignature, Roles: apiKey.Roles, APIKey: apiKey})
+		c.Next()
+	}
+}
+
+// NonceStore 记录签名请求使用过的nonce
+type NonceStore interface {
+	// Use 原子地记录key ttl内已记录过时返回false
+	Use(ctx context.Context, key string, ttl time.Duration) (bool, error)
+}
+
+// RedisNonceStore 基于cache/redis的NonceStore 使用SET NX PX 多实例共享
+type RedisNonceStore struct {
+	cache *redis.Cache
+}
+
+// NewRedisNonceStore 创建RedisNonceStore
+func NewRedisNonceStore(cache *redis.Cache) *RedisNonceStore {
+	return &RedisNonceStore{cache: cache}
+}
+
+// Use 通过SET NX PX记录key
+func (s *RedisNonceStore) Use(ctx context.Context, key string, ttl time.Duration) (bool, error) {
+	reply, err := s.cache.Do("SET", key, 1, "PX", int64(ttl/time.Millisecond), "NX")
+	if err != nil {
+		return false, err
+	}
+	return reply != nil, nil
+}
+
+// MemoryNonceStore 进程内的NonceStore 只适用于单实例部署
+type MemoryNonceStore struct {
+	mu    sync.Mutex
+	keys  map[string]time.Time
+	swept time.Time
+}
+
+// NewMemoryNonceStore 创建MemoryNonceStore
+func NewMemoryNonceStore() *MemoryNonceStore {
+	return &MemoryNonceStore{keys: make(map[string]time.Time)}
+}
+
+// Use 记录key 每分钟清理一次过期的key
+func (s *MemoryNonceStore) Use(ctx context.Context, key string, ttl time.Duration) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	if now.Sub(s.swept) > time.Minute {
+		for k, expiry := range s.keys {
+			if now.After(expiry) {
+				delete(s.keys, k)
+			}
+		}
+		s.swept = now
+	}
+	if expiry, ok := s.keys[key]; ok && now.Before(expiry) {
+		return false, nil
+	}
+	s.keys[key] = now.Add(ttl)
+	return true, nil
+}
+
+// signedBody 读取请求体并恢复 超过limit时返回错误
+func signedBody(r *http.Request, limit int64) ([]byte, error) {
+	if r.Body == nil || r.Body == http.NoBody {
+		return nil, nil
+	}
+	body, err := ioutil.ReadAll(io.LimitReader(r.Body, limit+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(body)) > limit {
+		return nil, errors.New("request body too large")
+	}
+	r.Body = ioutil.NopCloser(bytes.NewReader(body))
+	return body, nil
+}
+
+// signedParams 合并查询参数与表单参数
+func signedParams(r *http.Request, body []byte) (url.Values, error) {
+	params := r.URL.Query()
+	if !strings.HasPrefix(r.Header.Get("Content-Type"), "application/x-www-form-urlencoded") {
+		return params, nil
+	}
+
+	form, err := url.ParseQuery(string(body))
+	if err != nil {
+		return nil, err
+	}
+	for key, values := range form {
+		params[key] = append(params[key], values...)
+	}
+	return params, nil
+}
@@ -0,0 +1,307 @@
+package gin
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/Tokumicn/lego-lib/logs"
+	httpclient "github.com/Tokumicn/lego-lib/net/http"
+)
+
+func TestMain(m *testing.M) {
+	logs.Init(&logs.Config{Writer: "console", Level: "error"})
+	gin.SetMode(gin.TestMode)
+	os.Exit(m.Run())
+}
+
+// signJWT 按alg签发token key为HS的secret或RS ES的私钥
+func signJWT(t *testing.T, alg, kid string, claims map[string]interface{}, key interface{}) string {
+	header, _ := json.Marshal(map[string]string{"alg": alg, "kid": kid, "typ": "JWT"})
+	payload, _ := json.Marshal(claims)
+	signed := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+
+	hash := algorithmHashes[alg]
+	var signature []byte
+	switch key := key.(type) {
+	case string:
+		mac := hmac.New(hash.New, []byte(key))
+		mac.Write([]byte(signed))
+		signature = mac.Sum(nil)
+	case *rsa.PrivateKey:
+		h := hash.New()
+		h.Write([]byte(signed))
+		var err error
+		if signature, err = rsa.SignPKCS1v15(rand.Reader, key, hash, h.Sum(nil)); err != nil {
+			t.Fatal(err)
+		}
+	case *ecdsa.PrivateKey:
+		h := hash.New()
+		h.Write([]byte(signed))
+		r, s, err := ecdsa.Sign(rand.Reader, key, h.Sum(nil))
+		if err != nil {
+			t.Fatal(err)
+		}
+		size := (key.Curve.Params().BitSize + 7) / 8
+		signature = make([]byte, 2*size)
+		rb, sb := r.Bytes(), s.Bytes()
+		copy(signature[size-len(rb):size], rb)
+		copy(signature[2*size-len(sb):], sb)
+	}
+	return signed + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+// serve 发送请求并返回状态码与ErrorResponse的错误码
+func serve(h http.Handler, req *http.Request) (int, int) {
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	var resp JSONResponse
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	return w.Code, resp.Code
+}
+
+func bearer(token string) *http.Request {
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	return req
+}
+
+func identityHandler(c *gin.Context) {
+	identity, _ := GetIdentity(c)
+	c.String(http.StatusOK, identity.Subject)
+}
+
+func TestJWT(t *testing.T) {
+	rsaKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	ecKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	r := gin.New()
+	r.GET("/", JWT(JWTConfig{
+		Secret:     "secret",
+		Keys:       map[string]crypto.PublicKey{"rsa": &rsaKey.PublicKey, "ec": &ecKey.PublicKey},
+		Algorithms: []string{"HS256", "RS256", "ES256"},
+		ClockSkew:  30 * time.Second,
+	}), identityHandler)
+
+	now := time.Now().Unix()
+	claims := func(name string, offset int64) map[string]interface{} {
+		return map[string]interface{}{"sub": "alice", name: now + offset}
+	}
+	cases := []struct {
+		name   string
+		token  string
+		status int
+		code   int
+	}{
+		{"HS256", signJWT(t, "HS256", "", claims("exp", 60), "secret"), http.StatusOK, 0},
+		{"RS256", signJWT(t, "RS256", "rsa", claims("exp", 60), rsaKey), http.StatusOK, 0},
+		{"ES256", signJWT(t, "ES256", "ec", claims("exp", 60), ecKey), http.StatusOK, 0},
+		{"RS256 without kid", signJWT(t, "RS256", "", claims("exp", 60), rsaKey), http.StatusOK, 0},
+		{"wrong secret", signJWT(t, "HS256", "", claims("exp", 60), "other"), http.StatusUnauthorized, CodeInvalidToken},
+		{"disallowed alg", signJWT(t, "HS512", "", claims("exp", 60), "secret"), http.StatusUnauthorized, CodeInvalidToken},
+		{"alg none", "eyJhbGciOiJub25lIn0.eyJzdWIiOiJhbGljZSJ9.", http.StatusUnauthorized, CodeInvalidToken},
+		{"unknown kid", signJWT(t, "RS256", "missing", claims("exp", 60), rsaKey), http.StatusUnauthorized, CodeInvalidToken},
+		{"key type mismatch", signJWT(t, "ES256", "rsa", claims("exp", 60), ecKey), http.StatusUnauthorized, CodeInvalidToken},
+		{"exp within skew", signJWT(t, "HS256", "", claims("exp", -20), "secret"), http.StatusOK, 0},
+		{"exp beyond skew", signJWT(t, "HS256", "", claims("exp", -40), "secret"), http.StatusUnauthorized, CodeTokenExpired},
+		{"nbf within skew", signJWT(t, "HS256", "", claims("nbf", 20), "secret"), http.StatusOK, 0},
+		{"nbf beyond skew", signJWT(t, "HS256", "", claims("nbf", 40), "secret"), http.StatusUnauthorized, CodeTokenExpired},
+	}
+	for _, tc := range cases {
+		status, code := serve(r, bearer(tc.token))
+		if status != tc.status || code != tc.code {
+			t.Errorf("%s got %d %d, want %d %d", tc.name, status, code, tc.status, tc.code)
+		}
+	}
+
+	if status, code := serve(r, httptest.NewRequest(http.MethodGet, "/", nil)); status != http.StatusUnauthorized || code != CodeUnauthorized {
+		t.Errorf("missing token got %d %d", status, code)
+	}
+}
+
+func rsaJWK(kid string, key *rsa.PublicKey) map[string]string {
+	return map[string]string{
+		"kty": "RSA",
+		"kid": kid,
+		"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+		"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+	}
+}
+
+// TestJWKSRefresh 未知kid等待首次下载 过期后在后台刷新 刷新期间使用缓存的公钥
+func TestJWKSRefresh(t *testing.T) {
+	key, _ := rsa.GenerateKey(rand.Reader, 2048)
+	block := make(chan struct{})
+	var fetches int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&fetches, 1) > 1 {
+			<-block
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"keys": []interface{}{rsaJWK("k1", &key.PublicKey)}})
+	}))
+	defer srv.Close()
+	defer close(block)
+
+	r := gin.New()
+	r.GET("/", JWT(JWTConfig{JWKSURL: srv.URL, JWKSRefresh: 10 * time.Millisecond}), identityHandler)
+	token := signJWT(t, "RS256", "k1", map[string]interface{}{"sub": "alice"}, key)
+
+	if status, _ := serve(r, bearer(token)); status != http.StatusOK {
+		t.Fatalf("first request got %d", status)
+	}
+	// 一分钟内不再为未知kid刷新
+	if status, code := serve(r, bearer(signJWT(t, "RS256", "k2", map[string]interface{}{}, key))); status != http.StatusUnauthorized || code != CodeInvalidToken {
+		t.Errorf("unknown kid got %d %d", status, code)
+	}
+
+	time.Sleep(1100 * time.Millisecond)
+	start := time.Now()
+	if status, _ := serve(r, bearer(token)); status != http.StatusOK {
+		t.Errorf("request during refresh got %d", status)
+	}
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("request blocked on refresh for %s", elapsed)
+	}
+}
+
+func TestAPIKeyAuth(t *testing.T) {
+	store := NewStaticAPIKeyStore(
+		&APIKey{Key: "valid", Subject: "svc-a", Roles: []string{"viewer"}},
+		&APIKey{Key: "future", Subject: "svc-b", ExpiresAt: time.Now().Add(time.Hour)},
+		&APIKey{Key: "expired", Subject: "svc-c", ExpiresAt: time.Now().Add(-time.Second)},
+	)
+	r := gin.New()
+	r.GET("/", APIKeyAuth(APIKeyConfig{Store: store, Query: "api_key"}), identityHandler)
+
+	cases := []struct {
+		name   string
+		header string
+		query  string
+		status int
+		code   int
+	}{
+		{"valid", "valid", "", http.StatusOK, 0},
+		{"not expired", "future", "", http.StatusOK, 0},
+		{"query", "", "valid", http.StatusOK, 0},
+		{"expired", "expired", "", http.StatusUnauthorized, CodeInvalidAPIKey},
+		{"unknown", "unknown", "", http.StatusUnauthorized, CodeInvalidAPIKey},
+		{"missing", "", "", http.StatusUnauthorized, CodeUnauthorized},
+	}
+	for _, tc := range cases {
+		req := httptest.NewRequest(http.MethodGet, "/?api_key="+tc.query, nil)
+		if tc.header != "" {
+			req.Header.Set("X-Api-Key", tc.header)
+		}
+		status, code := serve(r, req)
+		if status != tc.status || code != tc.code {
+			t.Errorf("%s got %d %d, want %d %d", tc.name, status, code, tc.status, tc.code)
+		}
+	}
+}
+
+type failingNonceStore struct{}
+
+func (failingNonceStore) Use(ctx context.Context, key string, ttl time.Duration) (bool, error) {
+	return false, errors.New("store down")
+}
+
+func signedRequest(t *testing.T, secret, timestamp, nonce, form string) *http.Request {
+	req := httptest.NewRequest(http.MethodPost, "/orders?b=2&a=1", strings.NewReader(form))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	params, _ := url.ParseQuery("b=2&a=1&" + form)
+	signature, err := httpclient.Sign(httpclient.SignConfig{Secret: secret}, http.MethodPost, "/orders", params,
+		httpclient.BodyHash([]byte(form)), timestamp, nonce)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("X-App-Key", "app")
+	req.Header.Set("X-Timestamp", timestamp)
+	req.Header.Set("X-Nonce", nonce)
+	req.Header.Set("X-Signature", signature)
+	return req
+}
+
+func TestVerifySignature(t *testing.T) {
+	store := NewStaticAPIKeyStore(&APIKey{Key: "app", Secret: "secret", Subject: "svc-a"})
+	r := gin.New()
+	r.POST("/orders", VerifySignature(SignatureConfig{Store: store, Nonces: NewMemoryNonceStore()}), func(c *gin.Context) {
+		// 校验后请求体仍可读取
+		c.String(http.StatusOK, c.PostForm("name"))
+	})
+
+	now := strconv.FormatInt(time.Now().Unix(), 10)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, signedRequest(t, "secret", now, "n1", "name=x"))
+	if w.Code != http.StatusOK || w.Body.String() != "x" {
+		t.Fatalf("valid signature got %d %q", w.Code, w.Body.String())
+	}
+
+	tampered := signedRequest(t, "secret", now, "n2", "name=x")
+	tampered.Body = httptest.NewRequest(http.MethodPost, "/", strings.NewReader("name=y")).Body
+	old := strconv.FormatInt(time.Now().Add(-10*time.Minute).Unix(), 10)
+	cases := []struct {
+		name   string
+		req    *http.Request
+		status int
+		code   int
+	}{
+		{"nonce reused", signedRequest(t, "secret", now, "n1", "name=x"), http.StatusUnauthorized, CodeRequestExpired},
+		{"bad signature", signedRequest(t, "other", now, "n3", "name=x"), http.StatusUnauthorized, CodeInvalidSignature},
+		{"tampered body", tampered, http.StatusUnauthorized, CodeInvalidSignature},
+		{"timestamp skew", signedRequest(t, "secret", old, "n4", "name=x"), http.StatusUnauthorized, CodeRequestExpired},
+		{"missing headers", httptest.NewRequest(http.MethodPost, "/orders", nil), http.StatusUnauthorized, CodeUnauthorized},
+	}
+	for _, tc := range cases {
+		status, code := serve(r, tc.req)
+		if status != tc.status || code != tc.code {
+			t.Errorf("%s got %d %d, want %d %d", tc.name, status, code, tc.status, tc.code)
+		}
+	}
+
+	// nonce存储出错时拒绝请求
+	failing := gin.New()
+	failing.POST("/orders", VerifySignature(SignatureConfig{Store: store, Nonces: failingNonceStore{}}), identityHandler)
+	if status, code := serve(failing, signedRequest(t, "secret", now, "n5", "name=x")); status != http.StatusServiceUnavailable || code != CodeAuthUnavailable {
+		t.Errorf("nonce store error got %d %d", status, code)
+	}
+}
+
+// TestVerifySignatureClient 与net/http.SignRequest签名的请求互通
+func TestVerifySignatureClient(t *testing.T) {
+	store := NewStaticAPIKeyStore(&APIKey{Key: "app", Secret: "secret", Subject: "svc-a"})
+	r := gin.New()
+	r.Use(VerifySignature(SignatureConfig{Store: store, Nonces: NewMemoryNonceStore()}))
+	r.Any("/orders", identityHandler)
+	srv := httptest.NewServer(r)
+	defer srv.Close()
+
+	client := httpclient.NewClient()
+	client.Use(httpclient.SignRequest(httpclient.SignConfig{AppKey: "app", Secret: "secret"}))
+	if body, resp := client.NewRequest(srv.URL+"/orders").SetParam("a", 1).ToString(); resp.Error != nil || body != "svc-a" {
+		t.Errorf("GET got %q %v", body, resp.Error)
+	}
+	if body, resp := client.NewRequest(srv.URL+"/orders").Post().AddFormField("name", "x").ToString(); resp.Error != nil || body != "svc-a" {
+		t.Errorf("form got %q %v", body, resp.Error)
+	}
+	if body, resp := client.NewRequest(srv.URL + "/orders").Post().SetJSONBody(map[string]int{"amount": 1}).ToString(); resp.Error != nil || body != "svc-a" {
+		t.Errorf("json got %q %v", body, resp.Error)
+	}
+}
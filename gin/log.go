@@ -23,7 +23,7 @@ func Logger() gin.HandlerFunc {
 				logs.Error(e)
 			}
 		} else {
-			logs.Infof("%s status:%d method:%s query:%s ip:%s user-agent:%s latency:%d",
+			logs.WithContext(c.Request.Context()).Infof("%s status:%d method:%s query:%s ip:%s user-agent:%s latency:%d",
 				c.Request.URL.Path, c.Writer.Status(), c.Request.Method, c.Request.URL.RawQuery,
 				c.ClientIP(), c.Request.UserAgent(), latency)
 		}
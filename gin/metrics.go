@@ -0,0 +1,79 @@
+package gin
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// 与net/http客户端监控使用相同的标签名 tag为路由模板
+var serverLabels = []string{"domain", "code", "protocol", "method", "tag"}
+
+// Metrics gin监控插件 记录请求数与耗时 指标注册到prometheus.DefaultRegisterer
+// domain标签为服务名 默认为namespace 不使用客户端可控的Host头
+func Metrics(namespace string, domain ...string) gin.HandlerFunc {
+	service := namespace
+	if len(domain) > 0 {
+		service = domain[0]
+	}
+
+	requests := registerCollector(prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "http_server",
+		Name:      "requests_total",
+		Help:      "Total number of http server requests.",
+	}, serverLabels)).(*prometheus.CounterVec)
+	latency := registerCollector(prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "http_server",
+		Name:      "request_duration_seconds",
+		Help:      "Latency of http server requests.",
+		Buckets:   prometheus.DefBuckets,
+	}, serverLabels)).(*prometheus.HistogramVec)
+
+	return func(c *gin.Context) {
+		start := time.Now()
+
+		c.Next()
+
+		// 未匹配路由时使用固定值 避免路径作为标签导致指标膨胀
+		tag := c.FullPath()
+		if tag == "" {
+			tag = "unmatched"
+		}
+		values := []string{service, strconv.Itoa(c.Writer.Status()), c.Request.Proto, metricMethod(c.Request.Method), tag}
+		requests.WithLabelValues(values...).Inc()
+		latency.WithLabelValues(values...).Observe(time.Since(start).Seconds())
+	}
+}
+
+// metricMethod 非标准method归为OTHER
+func metricMethod(method string) string {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch,
+		http.MethodDelete, http.MethodConnect, http.MethodOptions, http.MethodTrace:
+		return method
+	}
+	return "OTHER"
+}
+
+// Prometheus 注册/metrics路由 输出prometheus.DefaultGatherer中的指标 handlers为访问控制中间件
+func Prometheus(r *gin.Engine, handlers ...gin.HandlerFunc) {
+	r.GET("/metrics", append(append([]gin.HandlerFunc{}, handlers...), gin.WrapH(promhttp.Handler()))...)
+}
+
+// registerCollector 重复调用Metrics时复用已注册的指标
+func registerCollector(c prometheus.Collector) prometheus.Collector {
+	if err := prometheus.Register(c); err != nil {
+		are, ok := err.(prometheus.AlreadyRegisteredError)
+		if !ok {
+			panic(err)
+		}
+		return are.ExistingCollector
+	}
+	return c
+}
@@ -7,9 +7,14 @@ import (
 	"github.com/gin-gonic/gin"
 )
 
-// Prof used in gin
-func Prof(r *gin.Engine) {
-	p := r.Group("/debug/pprof/")
+// Prof 注册/debug/pprof路由 handlers为访问控制中间件 如RequireRole("admin")
+// 未指定handlers时只允许本机访问 服务前有同机的代理或sidecar(如mTLS)时所有请求都来自本机
+// LocalOnly不再起作用 需指定认证与鉴权中间件
+func Prof(r *gin.Engine, handlers ...gin.HandlerFunc) {
+	if len(handlers) == 0 {
+		handlers = []gin.HandlerFunc{LocalOnly()}
+	}
+	p := r.Group("/debug/pprof/", handlers...)
 	{
 		p.GET("/", pprofHandler(pprof.Index))
 		p.GET("/cmdline", pprofHandler(pprof.Cmdline))
@@ -0,0 +1,490 @@
+package gin
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/Tokumicn/lego-lib/cache"
+	"github.com/Tokumicn/lego-lib/logs"
+)
+
+// CodeForbidden 权限不足时ErrorResponse使用的错误码
+const CodeForbidden = 40300
+
+// Policy RBAC策略 通过JSON文件配置
+//
+//	{
+//	  "roles": {
+//	    "viewer": {"permissions": ["orders:read"]},
+//	    "editor": {"inherits": ["viewer"], "grants": [
+//	      {"permission": "orders:write", "when": {"claim.tenant": "$param.tenant"}}
+//	    ]},
+//	    "admin": {"inherits": ["editor"], "permissions": ["*"]}
+//	  },
+//	  "subjects": {"svc-billing": ["editor"]}
+//	}
+type Policy struct {
+	Roles map[string]*RoleDef `json:"roles"`
+	// Subjects 按Subject额外绑定的角色 与Identity.Roles合并
+	Subjects map[string][]string `json:"subjects"`
+
+	version string
+}
+
+// RoleDef 角色定义 继承父角色的全部权限
+type RoleDef struct {
+	Inherits []string `json:"inherits"`
+	// Permissions 无条件授予的权限 支持*与orders:*通配
+	Permissions []string `json:"permissions"`
+	// Grants 满足属性条件时授予的权限
+	Grants []Grant `json:"grants"`
+}
+
+// Grant 带属性条件的权限 When中所有条件均满足时授予
+// key为属性 value以$开头时为属性否则为字面值
+// 属性支持subject method claim.<name> param.<name> query.<name> header.<name>
+type Grant struct {
+	Permission string            `json:"permission"`
+	When       map[string]string `json:"when"`
+}
+
+// LoadPolicy 读取JSON策略文件
+func LoadPolicy(file string) (*Policy, error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	return ParsePolicy(data)
+}
+
+// ParsePolicy 解析并校验策略 角色不存在或继承成环时返回错误
+func ParsePolicy(data []byte) (*Policy, error) {
+	p := &Policy{}
+	if err := json.Unmarshal(data, p); err != nil {
+		return nil, err
+	}
+	if err := p.prepare(); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// prepare 校验策略并按内容计算版本 版本是角色缓存key的一部分
+func (p *Policy) prepare() error {
+	if err := p.validate(); err != nil {
+		return err
+	}
+	data, err := json.Marshal(p)
+	if err != nil {
+		return err
+	}
+	sum := sha256.Sum256(data)
+	p.version = hex.EncodeToString(sum[:8])
+	return nil
+}
+
+func (p *Policy) validate() error {
+	for name, role := range p.Roles {
+		if role == nil {
+			return fmt.Errorf("rbac: role %s is empty", name)
+		}
+		for _, parent := range role.Inherits {
+			if _, ok := p.Roles[parent]; !ok {
+				return fmt.Errorf("rbac: role %s inherits unknown role %s", name, parent)
+			}
+		}
+		for _, grant := range role.Grants {
+			for key, value := range grant.When {
+				if !validAttribute(key) || strings.HasPrefix(value, "$") && !validAttribute(value[1:]) {
+					return fmt.Errorf("rbac: role %s grant %s has invalid condition %s=%s", name, grant.Permission, key, value)
+				}
+			}
+		}
+		if p.cyclic(name, map[string]bool{}) {
+			return fmt.Errorf("rbac: role %s inherits itself", name)
+		}
+	}
+	for subject, roles := range p.Subjects {
+		for _, role := range roles {
+			if _, ok := p.Roles[role]; !ok {
+				return fmt.Errorf("rbac: subject %s bound to unknown role %s", subject, role)
+			}
+		}
+	}
+	return nil
+}
+
+func (p *Policy) cyclic(name string, path map[string]bool) bool {
+	if path[name] {
+		return true
+	}
+	path[name] = true
+	defer delete(path, name)
+	for _, parent := range p.Roles[name].Inherits {
+		if p.cyclic(parent, path) {
+			return true
+		}
+	}
+	return false
+}
+
+// expand 展开角色继承 返回全部角色与权限
+func (p *Policy) expand(roles []string) *roleSet {
+	set := &roleSet{}
+	seen := make(map[string]bool)
+	var visit func(name string)
+	visit = func(name string) {
+		role, ok := p.Roles[name]
+		if !ok || seen[name] {
+			return
+		}
+		seen[name] = true
+		set.Roles = append(set.Roles, name)
+		set.Permissions = append(set.Permissions, role.Permissions...)
+		set.Grants = append(set.Grants, role.Grants...)
+		for _, parent := range role.Inherits {
+			visit(parent)
+		}
+	}
+	for _, name := range roles {
+		visit(name)
+	}
+	return set
+}
+
+// roleSet 展开后的角色与权限 缓存时以JSON保存
+type roleSet struct {
+	Roles       []string `json:"roles"`
+	Permissions []string `json:"permissions"`
+	Grants      []Grant  `json:"grants"`
+}
+
+func (s *roleSet) hasRole(role string) bool {
+	for _, r := range s.Roles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+// allowed 判断是否拥有权限 条件通过attr读取请求属性
+func (s *roleSet) allowed(permission string, attr func(string) (string, bool)) bool {
+	for _, p := range s.Permissions {
+		if matchPermission(p, permission) {
+			return true
+		}
+	}
+next:
+	for _, grant := range s.Grants {
+		if !matchPermission(grant.Permission, permission) {
+			continue
+		}
+		for key, value := range grant.When {
+			actual, ok := attr(key)
+			if !ok {
+				continue next
+			}
+			if strings.HasPrefix(value, "$") {
+				if value, ok = attr(value[1:]); !ok {
+					continue next
+				}
+			}
+			if actual != value {
+				continue next
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// matchPermission *匹配全部 orders:*匹配orders:下的全部权限
+func matchPermission(pattern, permission string) bool {
+	if pattern == "*" || pattern == permission {
+		return true
+	}
+	return strings.HasSuffix(pattern, ":*") && strings.HasPrefix(permission, pattern[:len(pattern)-1])
+}
+
+func validAttribute(attr string) bool {
+	if attr == "subject" || attr == "method" {
+		return true
+	}
+	for _, prefix := range []string{"claim.", "param.", "query.", "header."} {
+		if strings.HasPrefix(attr, prefix) && len(attr) > len(prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// requestAttribute 读取条件中的请求属性 值为空时视为不存在
+func requestAttribute(c *gin.Context, identity *Identity) func(string) (string, bool) {
+	return func(attr string) (string, bool) {
+		var value string
+		switch {
+		case attr == "subject":
+			value = identity.Subject
+		case attr == "method":
+			value = c.Request.Method
+		case strings.HasPrefix(attr, "claim."):
+			if v, ok := identity.Claims[attr[6:]]; ok && v != nil {
+				value = fmt.Sprint(v)
+			}
+		case strings.HasPrefix(attr, "param."):
+			value = c.Param(attr[6:])
+		case strings.HasPrefix(attr, "query."):
+			value = c.Query(attr[6:])
+		case strings.HasPrefix(attr, "header."):
+			value = c.GetHeader(attr[7:])
+		}
+		return value, value != ""
+	}
+}
+
+// RBACConfig 鉴权配置 Policy与PolicyFile二选一
+type RBACConfig struct {
+	Policy     *Policy `toml:"-"`
+	PolicyFile string  `toml:"policy_file"`
+	// ReloadInterval 检查策略文件修改时间的间隔 默认不重新加载
+	ReloadInterval time.Duration `toml:"reload_interval"`
+	// Cache 缓存角色展开结果 为nil时不缓存
+	Cache       cache.Cache   `toml:"-"`
+	CachePrefix string        `toml:"cache_prefix"` // 默认rbac:
+	CacheTTL    time.Duration `toml:"cache_ttl"`    // 默认1m
+}
+
+// Authorizer 基于角色与权限的鉴权 需放在认证中间件之后
+type Authorizer struct {
+	conf RBACConfig
+
+	mu      sync.RWMutex
+	policy  *Policy
+	modTime time.Time
+	checked time.Time
+}
+
+// NewAuthorizer 创建Authorizer 策略加载或校验失败时panic
+func NewAuthorizer(conf RBACConfig) *Authorizer {
+	if conf.CachePrefix == "" {
+		conf.CachePrefix = "rbac:"
+	}
+	if conf.CacheTTL == 0 {
+		conf.CacheTTL = time.Minute
+	}
+	a := &Authorizer{conf: conf}
+	if conf.Policy != nil {
+		if err := a.SetPolicy(conf.Policy); err != nil {
+			panic(err)
+		}
+	}
+	if conf.PolicyFile != "" {
+		if err := a.Reload(); err != nil {
+			panic(err)
+		}
+	}
+	if a.policy == nil {
+		panic("gin: NewAuthorizer needs a policy or policy file")
+	}
+	return a
+}
+
+// Reload 重新读取策略文件 失败时保留当前策略
+func (a *Authorizer) Reload() error {
+	info, err := os.Stat(a.conf.PolicyFile)
+	if err != nil {
+		return err
+	}
+	policy, err := LoadPolicy(a.conf.PolicyFile)
+	if err != nil {
+		return err
+	}
+	a.mu.Lock()
+	a.policy, a.modTime, a.checked = policy, info.ModTime(), time.Now()
+	a.mu.Unlock()
+	return nil
+}
+
+// SetPolicy 校验并替换当前策略 校验失败时保留当前策略
+// 替换后不要再修改p 修改后需重新调用SetPolicy
+func (a *Authorizer) SetPolicy(p *Policy) error {
+	if err := p.prepare(); err != nil {
+		return err
+	}
+	a.mu.Lock()
+	a.policy = p
+	a.mu.Unlock()
+	return nil
+}
+
+func (a *Authorizer) current() *Policy {
+	a.mu.RLock()
+	policy, checked, modTime := a.policy, a.checked, a.modTime
+	a.mu.RUnlock()
+	if a.conf.PolicyFile == "" || a.conf.ReloadInterval <= 0 || time.Since(checked) < a.conf.ReloadInterval {
+		return policy
+	}
+
+	a.mu.Lock()
+	a.checked = time.Now()
+	a.mu.Unlock()
+	if info, err := os.Stat(a.conf.PolicyFile); err == nil && !info.ModTime().Equal(modTime) {
+		if err := a.Reload(); err != nil {
+			logs.Errorf("reload rbac policy %s err:%s", a.conf.PolicyFile, err)
+		}
+	}
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	return a.policy
+}
+
+// roles 展开调用方的角色 结果按策略版本缓存
+func (a *Authorizer) roles(identity *Identity) *roleSet {
+	policy := a.current()
+	roles := append(append([]string{}, identity.Roles...), policy.Subjects[identity.Subject]...)
+	sort.Strings(roles)
+	if a.conf.Cache == nil {
+		return policy.expand(roles)
+	}
+
+	key := a.conf.CachePrefix + policy.version + ":" + strings.Join(roles, ",")
+	var data []byte
+	switch v := a.conf.Cache.Get(key).(type) {
+	case []byte:
+		data = v
+	case string:
+		data = []byte(v)
+	}
+	if data != nil {
+		set := &roleSet{}
+		if json.Unmarshal(data, set) == nil {
+			return set
+		}
+	}
+
+	set := policy.expand(roles)
+	if data, err := json.Marshal(set); err == nil {
+		if err := a.conf.Cache.Put(key, data, a.conf.CacheTTL); err != nil {
+			logs.Warnf("rbac cache put %s err:%s", key, err)
+		}
+	}
+	return set
+}
+
+// Allowed 判断当前请求的调用方是否拥有permission
+func (a *Authorizer) Allowed(c *gin.Context, permission string) bool {
+	identity, ok := GetIdentity(c)
+	if !ok {
+		return false
+	}
+	return a.roles(identity).allowed(permission, requestAttribute(c, identity))
+}
+
+// RequirePermission 要求拥有全部permissions 未认证返回401 权限不足返回403
+func (a *Authorizer) RequirePermission(permissions ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		identity, ok := GetIdentity(c)
+		if !ok {
+			abortAuth(c, CodeUnauthorized, "unauthenticated")
+			return
+		}
+		set, attr := a.roles(identity), requestAttribute(c, identity)
+		for _, permission := range permissions {
+			if !set.allowed(permission, attr) {
+				c.AbortWithStatusJSON(http.StatusForbidden, ErrorResponse(CodeForbidden, "permission denied: "+permission))
+				return
+			}
+		}
+		c.Next()
+	}
+}
+
+// RequireRole 要求拥有任一角色 继承的角色同样满足
+func (a *Authorizer) RequireRole(roles ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		identity, ok := GetIdentity(c)
+		if !ok {
+			abortAuth(c, CodeUnauthorized, "unauthenticated")
+			return
+		}
+		set := a.roles(identity)
+		for _, role := range roles {
+			if set.hasRole(role) {
+				c.Next()
+				return
+			}
+		}
+		c.AbortWithStatusJSON(http.StatusForbidden, ErrorResponse(CodeForbidden, "role required: "+strings.Join(roles, ",")))
+	}
+}
+
+var (
+	defaultAuthorizerMu sync.RWMutex
+	defaultAuthorizer   *Authorizer
+)
+
+// DefaultAuthorizer 返回RequirePermission RequireRole使用的Authorizer 未调用InitRBAC时为nil
+func DefaultAuthorizer() *Authorizer {
+	defaultAuthorizerMu.RLock()
+	defer defaultAuthorizerMu.RUnlock()
+	return defaultAuthorizer
+}
+
+// InitRBAC 初始化DefaultAuthorizer 可在路由注册后与请求并发调用
+func InitRBAC(conf RBACConfig) {
+	a := NewAuthorizer(conf)
+	defaultAuthorizerMu.Lock()
+	defaultAuthorizer = a
+	defaultAuthorizerMu.Unlock()
+}
+
+// RequirePermission 使用DefaultAuthorizer校验权限 路由可在InitRBAC之前注册
+func RequirePermission(permissions ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		a := DefaultAuthorizer()
+		if a == nil {
+			logs.Error("rbac: RequirePermission used before InitRBAC")
+			c.AbortWithStatusJSON(http.StatusForbidden, ErrorResponse(CodeForbidden, "permission denied"))
+			return
+		}
+		a.RequirePermission(permissions...)(c)
+	}
+}
+
+// RequireRole 使用DefaultAuthorizer校验角色 路由可在InitRBAC之前注册
+func RequireRole(roles ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		a := DefaultAuthorizer()
+		if a == nil {
+			logs.Error("rbac: RequireRole used before InitRBAC")
+			c.AbortWithStatusJSON(http.StatusForbidden, ErrorResponse(CodeForbidden, "role required"))
+			return
+		}
+		a.RequireRole(roles...)(c)
+	}
+}
+
+// LocalOnly 只允许本机访问 按连接地址判断 不信任X-Forwarded-For
+func LocalOnly() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		host, _, err := net.SplitHostPort(c.Request.RemoteAddr)
+		if ip := net.ParseIP(host); err != nil || ip == nil || !ip.IsLoopback() {
+			c.AbortWithStatusJSON(http.StatusForbidden, ErrorResponse(CodeForbidden, "local access only"))
+			return
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,230 @@
+package gin
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+type memoryCache struct {
+	mu   sync.Mutex
+	data map[string]interface{}
+}
+
+func (m *memoryCache) Get(key string) interface{} {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.data[key]
+}
+func (m *memoryCache) GetMulti(keys []string) []interface{} { return nil }
+func (m *memoryCache) Put(key string, val interface{}, timeout time.Duration) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.data[key] = val
+	return nil
+}
+func (m *memoryCache) Delete(key string) error        { return nil }
+func (m *memoryCache) Incr(key string) error          { return nil }
+func (m *memoryCache) Decr(key string) error          { return nil }
+func (m *memoryCache) IsExist(key string) bool        { return m.Get(key) != nil }
+func (m *memoryCache) ClearAll() error                { return nil }
+func (m *memoryCache) StartAndGC(config string) error { return nil }
+
+const testPolicy = `{
+  "roles": {
+    "viewer": {"permissions": ["orders:read"]},
+    "editor": {"inherits": ["viewer"], "grants": [
+      {"permission": "orders:write", "when": {"claim.tenant": "$param.tenant"}}
+    ]},
+    "ops": {"permissions": ["orders:*"]},
+    "admin": {"inherits": ["editor"], "permissions": ["*"]}
+  },
+  "subjects": {"svc-billing": ["editor"]}
+}`
+
+// fakeAuth 按X-Subject X-Roles X-Tenant写入Identity 未携带X-Subject时不认证
+func fakeAuth(c *gin.Context) {
+	subject := c.GetHeader("X-Subject")
+	if subject == "" {
+		c.Next()
+		return
+	}
+	var roles []string
+	if v := c.GetHeader("X-Roles"); v != "" {
+		roles = strings.Split(v, ",")
+	}
+	c.Set(IdentityKey, &Identity{Subject: subject, Roles: roles, Claims: Claims{"tenant": c.GetHeader("X-Tenant")}})
+	c.Next()
+}
+
+func rbacRequest(method, path, subject, roles, tenant string) *http.Request {
+	req := httptest.NewRequest(method, path, nil)
+	if subject != "" {
+		req.Header.Set("X-Subject", subject)
+	}
+	req.Header.Set("X-Roles", roles)
+	req.Header.Set("X-Tenant", tenant)
+	return req
+}
+
+func TestAuthorizer(t *testing.T) {
+	policy, err := ParsePolicy([]byte(testPolicy))
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := NewAuthorizer(RBACConfig{Policy: policy, Cache: &memoryCache{data: map[string]interface{}{}}})
+	r := gin.New()
+	r.Use(fakeAuth)
+	r.GET("/tenants/:tenant/orders", a.RequirePermission("orders:read"), identityHandler)
+	r.POST("/tenants/:tenant/orders", a.RequirePermission("orders:write"), identityHandler)
+	r.GET("/users", a.RequirePermission("users:read"), identityHandler)
+	r.GET("/viewer", a.RequireRole("viewer"), identityHandler)
+
+	cases := []struct {
+		name   string
+		req    *http.Request
+		status int
+	}{
+		{"unauthenticated", rbacRequest("GET", "/tenants/t1/orders", "", "", ""), http.StatusUnauthorized},
+		{"viewer read", rbacRequest("GET", "/tenants/t1/orders", "u1", "viewer", ""), http.StatusOK},
+		{"viewer write", rbacRequest("POST", "/tenants/t1/orders", "u1", "viewer", "t1"), http.StatusForbidden},
+		{"inherited read", rbacRequest("GET", "/tenants/t1/orders", "u2", "editor", ""), http.StatusOK},
+		{"grant when matched", rbacRequest("POST", "/tenants/t1/orders", "u2", "editor", "t1"), http.StatusOK},
+		{"grant when mismatched", rbacRequest("POST", "/tenants/t1/orders", "u2", "editor", "t2"), http.StatusForbidden},
+		{"grant when missing claim", rbacRequest("POST", "/tenants/t1/orders", "u2", "editor", ""), http.StatusForbidden},
+		{"subject binding", rbacRequest("POST", "/tenants/t1/orders", "svc-billing", "", "t1"), http.StatusOK},
+		{"prefix wildcard", rbacRequest("POST", "/tenants/t1/orders", "u3", "ops", ""), http.StatusOK},
+		{"prefix wildcard other resource", rbacRequest("GET", "/users", "u3", "ops", ""), http.StatusForbidden},
+		{"full wildcard", rbacRequest("GET", "/users", "u4", "admin", ""), http.StatusOK},
+		{"no roles", rbacRequest("GET", "/tenants/t1/orders", "u5", "", ""), http.StatusForbidden},
+		{"inherited role", rbacRequest("GET", "/viewer", "u4", "admin", ""), http.StatusOK},
+		{"missing role", rbacRequest("GET", "/viewer", "u3", "ops", ""), http.StatusForbidden},
+		{"role unauthenticated", rbacRequest("GET", "/viewer", "", "", ""), http.StatusUnauthorized},
+	}
+	for _, tc := range cases {
+		status, code := serve(r, tc.req)
+		want := 0
+		switch tc.status {
+		case http.StatusUnauthorized:
+			want = CodeUnauthorized
+		case http.StatusForbidden:
+			want = CodeForbidden
+		}
+		if status != tc.status || code != want {
+			t.Errorf("%s got %d %d, want %d %d", tc.name, status, code, tc.status, want)
+		}
+	}
+}
+
+// TestSetPolicy 替换策略后缓存的角色展开结果失效
+func TestSetPolicy(t *testing.T) {
+	a := NewAuthorizer(RBACConfig{
+		Policy: &Policy{Roles: map[string]*RoleDef{"viewer": {Permissions: []string{"orders:read"}}}},
+		Cache:  &memoryCache{data: map[string]interface{}{}},
+	})
+	r := gin.New()
+	r.Use(fakeAuth)
+	r.GET("/", a.RequirePermission("orders:read"), identityHandler)
+
+	if status, _ := serve(r, rbacRequest("GET", "/", "u1", "viewer", "")); status != http.StatusOK {
+		t.Fatalf("before SetPolicy got %d", status)
+	}
+	if err := a.SetPolicy(&Policy{Roles: map[string]*RoleDef{"viewer": {}}}); err != nil {
+		t.Fatal(err)
+	}
+	if status, _ := serve(r, rbacRequest("GET", "/", "u1", "viewer", "")); status != http.StatusForbidden {
+		t.Errorf("after SetPolicy got %d", status)
+	}
+
+	if err := a.SetPolicy(&Policy{Roles: map[string]*RoleDef{"viewer": nil}}); err == nil {
+		t.Error("nil role accepted")
+	}
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Error("NewAuthorizer accepted an invalid policy")
+			}
+		}()
+		NewAuthorizer(RBACConfig{Policy: &Policy{Roles: map[string]*RoleDef{"a": {Inherits: []string{"b"}}}}})
+	}()
+}
+
+// TestInitRBACAfterRoutes 路由注册后与请求并发调用InitRBAC 需配合-race运行
+func TestInitRBACAfterRoutes(t *testing.T) {
+	r := gin.New()
+	r.Use(fakeAuth)
+	r.GET("/orders", RequirePermission("orders:read"), identityHandler)
+	r.GET("/viewer", RequireRole("viewer"), identityHandler)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 20; j++ {
+				serve(r, rbacRequest("GET", "/orders", "u1", "viewer", ""))
+				serve(r, rbacRequest("GET", "/viewer", "u1", "viewer", ""))
+			}
+		}()
+	}
+	policy, err := ParsePolicy([]byte(testPolicy))
+	if err != nil {
+		t.Fatal(err)
+	}
+	InitRBAC(RBACConfig{Policy: policy, Cache: &memoryCache{data: map[string]interface{}{}}})
+	wg.Wait()
+
+	if status, _ := serve(r, rbacRequest("GET", "/orders", "u1", "viewer", "")); status != http.StatusOK {
+		t.Errorf("permission after InitRBAC got %d", status)
+	}
+	if status, _ := serve(r, rbacRequest("GET", "/viewer", "u1", "viewer", "")); status != http.StatusOK {
+		t.Errorf("role after InitRBAC got %d", status)
+	}
+}
+
+func TestParsePolicyInvalid(t *testing.T) {
+	cases := map[string]string{
+		"unknown parent":    `{"roles": {"a": {"inherits": ["b"]}}}`,
+		"cycle":             `{"roles": {"a": {"inherits": ["b"]}, "b": {"inherits": ["a"]}}}`,
+		"empty role":        `{"roles": {"a": null}}`,
+		"unknown subject":   `{"roles": {"a": {}}, "subjects": {"s": ["b"]}}`,
+		"invalid condition": `{"roles": {"a": {"grants": [{"permission": "x", "when": {"body.id": "1"}}]}}}`,
+	}
+	for name, data := range cases {
+		if _, err := ParsePolicy([]byte(data)); err == nil {
+			t.Errorf("%s accepted", name)
+		}
+	}
+}
+
+func TestLocalOnly(t *testing.T) {
+	r := gin.New()
+	r.GET("/", LocalOnly(), func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	cases := []struct {
+		remote  string
+		forward string
+		status  int
+	}{
+		{"127.0.0.1:1234", "", http.StatusOK},
+		{"[::1]:1234", "", http.StatusOK},
+		{"192.0.2.1:1234", "", http.StatusForbidden},
+		{"192.0.2.1:1234", "127.0.0.1", http.StatusForbidden},
+		{"127.0.0.1", "", http.StatusForbidden},
+	}
+	for _, tc := range cases {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.RemoteAddr = tc.remote
+		if tc.forward != "" {
+			req.Header.Set("X-Forwarded-For", tc.forward)
+		}
+		if status, _ := serve(r, req); status != tc.status {
+			t.Errorf("%s %s got %d, want %d", tc.remote, tc.forward, status, tc.status)
+		}
+	}
+}
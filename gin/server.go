@@ -0,0 +1,267 @@
+package gin
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+
+	"github.com/Tokumicn/lego-lib/logs"
+)
+
+// ServerConfig 服务配置 零值字段使用默认值
+type ServerConfig struct {
+	Addr string `toml:"addr"` // 默认:8080
+	Mode string `toml:"mode"` // gin运行模式 debug release test 默认release
+
+	ReadTimeout  time.Duration `toml:"read_timeout"`  // 默认15s
+	WriteTimeout time.Duration `toml:"write_timeout"` // 默认15s 开启Pprof时需大于采样时间
+	IdleTimeout  time.Duration `toml:"idle_timeout"`  // 默认60s
+
+	// ShutdownDelay 收到退出信号后readyz先返回503 等待该时长让负载均衡摘除实例 默认0
+	ShutdownDelay time.Duration `toml:"shutdown_delay"`
+	// ShutdownTimeout 等待处理中请求完成的时长 超时后强制关闭连接 默认30s
+	ShutdownTimeout time.Duration `toml:"shutdown_timeout"`
+	// CheckTimeout readyz中每个依赖检查的超时 默认3s
+	CheckTimeout time.Duration `toml:"check_timeout"`
+
+	Pprof bool `toml:"pprof"` // 注册/debug/pprof路由
+	H2C   bool `toml:"h2c"`   // 同一端口支持明文HTTP/2
+
+	// AdminHandlers /debug/pprof的访问控制 如JWT与RequireRole("admin") 开启Pprof时必填
+	// 确认服务前没有同机代理时可使用LocalOnly()
+	AdminHandlers []gin.HandlerFunc `toml:"-"`
+}
+
+// Checker 依赖检查 postgresql.Pool redis.Cache mq.KafkaAdmin均已实现
+type Checker interface {
+	Ping(ctx context.Context) error
+}
+
+// CheckFunc 函数形式的Checker
+type CheckFunc func(ctx context.Context) error
+
+// Ping 调用f
+func (f CheckFunc) Ping(ctx context.Context) error {
+	return f(ctx)
+}
+
+type check struct {
+	name    string
+	checker Checker
+}
+
+// Server 带优雅退出与健康检查的gin服务 路由直接注册在Server上
+type Server struct {
+	*gin.Engine
+	conf   ServerConfig
+	server *http.Server
+
+	mu       sync.RWMutex
+	checks   []check
+	draining int32
+	// h2c连接被劫持 http.Server.Shutdown不会等待 单独计数
+	h2cConns sync.WaitGroup
+}
+
+// NewServer 创建注册了Recover Logger /healthz /readyz的服务
+// /healthz 进程存活即返回200 /readyz 所有依赖检查通过且未退出时返回200
+func NewServer(conf ServerConfig) *Server {
+	if conf.Addr == "" {
+		conf.Addr = ":8080"
+	}
+	if conf.Mode == "" {
+		conf.Mode = gin.ReleaseMode
+	}
+	if conf.ReadTimeout == 0 {
+		conf.ReadTimeout = 15 * time.Second
+	}
+	if conf.WriteTimeout == 0 {
+		conf.WriteTimeout = 15 * time.Second
+	}
+	if conf.IdleTimeout == 0 {
+		conf.IdleTimeout = 60 * time.Second
+	}
+	if conf.ShutdownTimeout == 0 {
+		conf.ShutdownTimeout = 30 * time.Second
+	}
+	if conf.CheckTimeout == 0 {
+		conf.CheckTimeout = 3 * time.Second
+	}
+
+	gin.SetMode(conf.Mode)
+	engine := gin.New()
+	engine.Use(Recover(), Logger())
+	if conf.Pprof {
+		if len(conf.AdminHandlers) == 0 {
+			panic("gin: ServerConfig.Pprof needs AdminHandlers to protect /debug/pprof")
+		}
+		Prof(engine, conf.AdminHandlers...)
+	}
+
+	s := &Server{Engine: engine, conf: conf}
+	engine.GET("/healthz", s.healthz)
+	engine.GET("/readyz", s.readyz)
+
+	s.server = &http.Server{
+		Addr:         conf.Addr,
+		Handler:      engine,
+		ReadTimeout:  conf.ReadTimeout,
+		WriteTimeout: conf.WriteTimeout,
+		IdleTimeout:  conf.IdleTimeout,
+	}
+	if conf.H2C {
+		h2s := &http2.Server{IdleTimeout: conf.IdleTimeout}
+		// Shutdown时向h2连接发送GOAWAY 处理中的stream完成后关闭连接
+		if err := http2.ConfigureServer(s.server, h2s); err != nil {
+			panic(err)
+		}
+		handler := h2c.NewHandler(engine, h2s)
+		s.server.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			s.h2cConns.Add(1)
+			defer s.h2cConns.Done()
+			handler.ServeHTTP(w, r)
+		})
+	}
+	return s
+}
+
+// AddCheck 注册readyz检查的依赖 如srv.AddCheck("postgres", pool)
+func (s *Server) AddCheck(name string, checker Checker) {
+	s.mu.Lock()
+	s.checks = append(s.checks, check{name: name, checker: checker})
+	s.mu.Unlock()
+}
+
+// HTTPServer 返回底层的http.Server 可在Run之前调整TLS等配置
+func (s *Server) HTTPServer() *http.Server {
+	return s.server
+}
+
+// Run 监听Addr并服务 收到SIGTERM或SIGINT后优雅退出
+// 正常退出返回nil 等待超时返回context.DeadlineExceeded
+func (s *Server) Run() error {
+	ln, err := net.Listen("tcp", s.conf.Addr)
+	if err != nil {
+		return err
+	}
+	return s.Serve(ln)
+}
+
+// Serve 在ln上服务 收到SIGTERM或SIGINT后优雅退出
+func (s *Server) Serve(ln net.Listener) error {
+	quit := make(chan os.Signal, 1)
+	signal.Notify(quit, syscall.SIGTERM, syscall.SIGINT)
+	defer signal.Stop(quit)
+
+	errCh := make(chan error, 1)
+	go func() {
+		logs.Infof("http server listen on %s", ln.Addr())
+		errCh <- s.server.Serve(ln)
+	}()
+
+	select {
+	case err := <-errCh:
+		if err == http.ErrServerClosed {
+			return nil
+		}
+		return err
+	case sig := <-quit:
+		logs.Infof("http server receive signal %s, shutting down", sig)
+	}
+	return s.Shutdown(context.Background())
+}
+
+// Shutdown readyz返回503并等待ShutdownDelay 然后停止接收新连接并等待处理中的请求完成
+// 超过ShutdownTimeout或ctx结束时强制关闭剩余的HTTP/1连接 h2c连接随进程退出关闭
+func (s *Server) Shutdown(ctx context.Context) error {
+	atomic.StoreInt32(&s.draining, 1)
+	if s.conf.ShutdownDelay > 0 {
+		select {
+		case <-time.After(s.conf.ShutdownDelay):
+		case <-ctx.Done():
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, s.conf.ShutdownTimeout)
+	defer cancel()
+	if err := s.server.Shutdown(ctx); err != nil {
+		logs.Errorf("http server shutdown err:%s, closing remaining connections", err)
+		s.server.Close()
+		return err
+	}
+
+	done := make(chan struct{})
+	go func() {
+		s.h2cConns.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-ctx.Done():
+		logs.Errorf("http server shutdown err:%s, h2c connections still active", ctx.Err())
+		return ctx.Err()
+	}
+	logs.Infof("http server shutdown finish")
+	return nil
+}
+
+type checkResult struct {
+	Status string            `json:"status"`
+	Checks map[string]string `json:"checks,omitempty"`
+}
+
+func (s *Server) healthz(c *gin.Context) {
+	c.JSON(http.StatusOK, checkResult{Status: "ok"})
+}
+
+// readyz 并发执行所有依赖检查
+func (s *Server) readyz(c *gin.Context) {
+	s.mu.RLock()
+	checks := s.checks
+	s.mu.RUnlock()
+
+	result := checkResult{Status: "ok", Checks: make(map[string]string, len(checks))}
+	if atomic.LoadInt32(&s.draining) == 1 {
+		result.Status = "shutting down"
+	}
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for _, ck := range checks {
+		wg.Add(1)
+		go func(ck check) {
+			defer wg.Done()
+			ctx, cancel := context.WithTimeout(c.Request.Context(), s.conf.CheckTimeout)
+			defer cancel()
+
+			state := "ok"
+			if err := ck.checker.Ping(ctx); err != nil {
+				state = err.Error()
+				logs.WithContext(c.Request.Context()).Warnf("readyz check %s err:%s", ck.name, err)
+			}
+			mu.Lock()
+			result.Checks[ck.name] = state
+			if state != "ok" && result.Status == "ok" {
+				result.Status = "fail"
+			}
+			mu.Unlock()
+		}(ck)
+	}
+	wg.Wait()
+
+	status := http.StatusOK
+	if result.Status != "ok" {
+		status = http.StatusServiceUnavailable
+	}
+	c.JSON(status, result)
+}
@@ -0,0 +1,67 @@
+package gin
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestReadyz(t *testing.T) {
+	s := NewServer(ServerConfig{Mode: gin.TestMode, ShutdownDelay: 300 * time.Millisecond})
+	var fail error
+	s.AddCheck("db", CheckFunc(func(ctx context.Context) error { return fail }))
+
+	get := func(path string) int {
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		return w.Code
+	}
+	if status := get("/readyz"); status != http.StatusOK {
+		t.Fatalf("readyz got %d", status)
+	}
+	fail = errors.New("down")
+	if status := get("/readyz"); status != http.StatusServiceUnavailable {
+		t.Errorf("failing check got %d", status)
+	}
+	fail = nil
+
+	done := make(chan error, 1)
+	go func() { done <- s.Shutdown(context.Background()) }()
+	time.Sleep(100 * time.Millisecond)
+	// 退出等待期间readyz返回503 healthz仍返回200
+	if status := get("/readyz"); status != http.StatusServiceUnavailable {
+		t.Errorf("readyz while draining got %d", status)
+	}
+	if status := get("/healthz"); status != http.StatusOK {
+		t.Errorf("healthz while draining got %d", status)
+	}
+	if err := <-done; err != nil {
+		t.Errorf("shutdown err %v", err)
+	}
+}
+
+func TestPprofAdminHandlers(t *testing.T) {
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Error("Pprof without AdminHandlers accepted")
+			}
+		}()
+		NewServer(ServerConfig{Mode: gin.TestMode, Pprof: true})
+	}()
+
+	s := NewServer(ServerConfig{Mode: gin.TestMode, Pprof: true, AdminHandlers: []gin.HandlerFunc{LocalOnly()}})
+	req := httptest.NewRequest(http.MethodGet, "/debug/pprof/", nil)
+	if status, _ := serve(s, req); status != http.StatusForbidden {
+		t.Errorf("remote pprof got %d", status)
+	}
+	req.RemoteAddr = "127.0.0.1:1234"
+	if status, _ := serve(s, req); status != http.StatusOK {
+		t.Errorf("local pprof got %d", status)
+	}
+}
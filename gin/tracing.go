@@ -0,0 +1,38 @@
+package gin
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/Tokumicn/lego-lib/tracing"
+)
+
+// Tracing gin链路插件 读取上游traceparent创建server span 并写入c.Request的context
+// 之后的handler通过c.Request.Context()继续传递链路
+func Tracing() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx := tracing.ExtractHeader(c.Request.Context(), c.Request.Header)
+
+		name := c.FullPath()
+		if name == "" {
+			name = "unmatched"
+		}
+		ctx, span := tracing.StartSpan(ctx, c.Request.Method+" "+name, tracing.KindServer)
+		span.SetAttribute("http.method", c.Request.Method)
+		span.SetAttribute("http.target", c.Request.URL.Path)
+		c.Request = c.Request.WithContext(ctx)
+
+		c.Next()
+
+		status := c.Writer.Status()
+		span.SetAttribute("http.status_code", strconv.Itoa(status))
+		if len(c.Errors) > 0 {
+			span.SetError(c.Errors.Last())
+		} else if status >= 500 {
+			span.SetError(fmt.Errorf("http status %d", status))
+		}
+		span.End()
+	}
+}
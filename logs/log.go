@@ -1,8 +1,14 @@
 package logs
 
 import (
+	"context"
+
+	sirupsen "github.com/sirupsen/logrus"
+	uberzap "go.uber.org/zap"
+
 	"github.com/Tokumicn/lego-lib/logs/logrus"
 	"github.com/Tokumicn/lego-lib/logs/zap"
+	"github.com/Tokumicn/lego-lib/tracing"
 )
 
 // FileConfig 日志配置项 文件类型时需要配置
@@ -81,6 +87,25 @@ func initLogrus(conf *Config) *logrus.Logger {
 	})
 }
 
+// WithContext 返回带trace_id span_id字段的Logger ctx中无链路信息时返回默认Logger
+// logs.WithContext(ctx).Infof("hello %s", "world")
+func WithContext(ctx context.Context) Logger {
+	traceID := tracing.GetTraceID(ctx)
+	if traceID == "" {
+		return defaultLogger
+	}
+	spanID := tracing.GetSpanID(ctx)
+
+	switch l := defaultLogger.(type) {
+	case *zap.Logger:
+		// 默认Logger为包级函数跳过了一层调用栈 直接调用时需要还原
+		return l.Desugar().WithOptions(uberzap.AddCallerSkip(-1)).Sugar().With("trace_id", traceID, "span_id", spanID)
+	case *logrus.Logger:
+		return l.WithFields(sirupsen.Fields{"trace_id": traceID, "span_id": spanID})
+	}
+	return defaultLogger
+}
+
 // Debug 打印Debug日志
 func Debug(v ...interface{}) {
 	defaultLogger.Debug(v...)
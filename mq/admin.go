@@ -0,0 +1,261 @@
+package mq
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/Shopify/sarama"
+)
+
+// PartitionLag 消费组在单个分区上的积压
+type PartitionLag struct {
+	Topic     string
+	Partition int32
+	Committed int64 // 消费组已提交位点 未提交过为-1
+	Latest    int64 // 分区最新位点
+	Lag       int64
+}
+
+// TopicInfo topic信息
+type TopicInfo struct {
+	Name              string
+	Partitions        int32
+	ReplicationFactor int16
+}
+
+// KafkaAdmin kafka运维接口 查询积压 重置位点 管理topic
+type KafkaAdmin struct {
+	client sarama.Client
+	admin  sarama.ClusterAdmin
+	group  string
+	topics map[string]TopicConfig
+}
+
+// NewKafkaAdmin 创建KafkaAdmin 作用于conf.Group与conf.Topics
+func NewKafkaAdmin(conf *Config) (*KafkaAdmin, error) {
+	config := sarama.NewConfig()
+	config.Version = sarama.V2_3_0_0
+	config.Consumer.Return.Errors = true
+
+	client, err := sarama.NewClient(conf.Endpoints, config)
+	if err != nil {
+		return nil, err
+	}
+
+	admin, err := sarama.NewClusterAdminFromClient(client)
+	if err != nil {
+		client.Close()
+		return nil, err
+	}
+
+	ka := &KafkaAdmin{
+		client: client,
+		admin:  admin,
+		group:  conf.Group,
+		topics: make(map[string]TopicConfig),
+	}
+	for _, tc := range conf.Topics {
+		ka.topics[tc.Name] = tc
+	}
+	return ka, nil
+}
+
+// Lag 查询消费组在所有配置topic上的分区积压
+func (a *KafkaAdmin) Lag() ([]PartitionLag, error) {
+	partitions := make(map[string][]int32)
+	for _, tc := range a.topics {
+		ps, err := a.client.Partitions(tc.Topic)
+		if err != nil {
+			return nil, fmt.Errorf("kafka admin topic:%s partitions err:%v", tc.Topic, err)
+		}
+		partitions[tc.Topic] = ps
+	}
+
+	committed, err := a.admin.ListConsumerGroupOffsets(a.group, partitions)
+	if err != nil {
+		return nil, err
+	}
+
+	lags := make([]PartitionLag, 0)
+	for topic, ps := range partitions {
+		for _, p := range ps {
+			latest, err := a.client.GetOffset(topic, p, sarama.OffsetNewest)
+			if err != nil {
+				return nil, fmt.Errorf("kafka admin topic:%s partition:%d offset err:%v", topic, p, err)
+			}
+
+			lag := PartitionLag{Topic: topic, Partition: p, Committed: -1, Latest: latest, Lag: latest}
+			if block := committed.GetBlock(topic, p); block != nil && block.Offset >= 0 {
+				lag.Committed = block.Offset
+				lag.Lag = latest - block.Offset
+			}
+			lags = append(lags, lag)
+		}
+	}
+
+	sort.Slice(lags, func(i, j int) bool {
+		if lags[i].Topic != lags[j].Topic {
+			return lags[i].Topic < lags[j].Topic
+		}
+		return lags[i].Partition < lags[j].Partition
+	})
+	return lags, nil
+}
+
+// ResetOffsetsToEarliest 消费组位点重置到最早
+func (a *KafkaAdmin) ResetOffsetsToEarliest(name string) error {
+	return a.resetOffsets(name, sarama.OffsetOldest)
+}
+
+// ResetOffsetsToLatest 消费组位点重置到最新
+func (a *KafkaAdmin) ResetOffsetsToLatest(name string) error {
+	return a.resetOffsets(name, sarama.OffsetNewest)
+}
+
+// ResetOffsetsToTime 消费组位点重置到t之后的第一条消息 没有则重置到最新
+func (a *KafkaAdmin) ResetOffsetsToTime(name string, t time.Time) error {
+	return a.resetOffsets(name, t.UnixNano()/int64(time.Millisecond))
+}
+
+// resetOffsets 消费组有在线成员时位点会被覆盖 要求消费组为空
+func (a *KafkaAdmin) resetOffsets(name string, position int64) error {
+	tc, ok := a.topics[name]
+	if !ok {
+		return errors.New("kafka admin find topic failed")
+	}
+
+	groups, err := a.admin.DescribeConsumerGroups([]string{a.group})
+	if err != nil {
+		return err
+	}
+	for _, g := range groups {
+		if len(g.Members) > 0 {
+			return fmt.Errorf("kafka admin group:%s has %d active members, stop consumers first", a.group, len(g.Members))
+		}
+	}
+
+	partitions, err := a.client.Partitions(tc.Topic)
+	if err != nil {
+		return err
+	}
+
+	om, err := sarama.NewOffsetManagerFromClient(a.group, a.client)
+	if err != nil {
+		return err
+	}
+	defer om.Close()
+
+	poms := make([]sarama.PartitionOffsetManager, 0, len(partitions))
+	defer func() {
+		for _, pom := range poms {
+			pom.AsyncClose()
+		}
+	}()
+
+	for _, p := range partitions {
+		offset, err := a.client.GetOffset(tc.Topic, p, position)
+		if err != nil {
+			return fmt.Errorf("kafka admin topic:%s partition:%d offset err:%v", tc.Topic, p, err)
+		}
+		// 按时间查找不到消息时返回-1
+		if offset < 0 {
+			if offset, err = a.client.GetOffset(tc.Topic, p, sarama.OffsetNewest); err != nil {
+				return err
+			}
+		}
+
+		pom, err := om.ManagePartition(tc.Topic, p)
+		if err != nil {
+			return err
+		}
+		poms = append(poms, pom)
+
+		// ResetOffset只能回退位点 MarkOffset只能前进
+		if current, _ := pom.NextOffset(); offset < current {
+			pom.ResetOffset(offset, "")
+		} else {
+			pom.MarkOffset(offset, "")
+		}
+	}
+
+	om.Commit()
+	for _, pom := range poms {
+		select {
+		case err := <-pom.Errors():
+			return err
+		default:
+		}
+	}
+	return nil
+}
+
+// ListTopics 列出集群中的topic
+func (a *KafkaAdmin) ListTopics() ([]TopicInfo, error) {
+	details, err := a.admin.ListTopics()
+	if err != nil {
+		return nil, err
+	}
+
+	topics := make([]TopicInfo, 0, len(details))
+	for name, detail := range details {
+		topics = append(topics, TopicInfo{
+			Name:              name,
+			Partitions:        detail.NumPartitions,
+			ReplicationFactor: detail.ReplicationFactor,
+		})
+	}
+	sort.Slice(topics, func(i, j int) bool { return topics[i].Name < topics[j].Name })
+	return topics, nil
+}
+
+// CreateTopics 按配置创建不存在的topic 未配置分区数与副本数时使用1
+func (a *KafkaAdmin) CreateTopics() error {
+	existing, err := a.admin.ListTopics()
+	if err != nil {
+		return err
+	}
+
+	for _, tc := range a.topics {
+		if _, ok := existing[tc.Topic]; ok {
+			continue
+		}
+
+		detail := &sarama.TopicDetail{
+			NumPartitions:     tc.Partitions,
+			ReplicationFactor: tc.Replication,
+		}
+		if detail.NumPartitions <= 0 {
+			detail.NumPartitions = 1
+		}
+		if detail.ReplicationFactor <= 0 {
+			detail.ReplicationFactor = 1
+		}
+		if err := a.admin.CreateTopic(tc.Topic, detail, false); err != nil {
+			return fmt.Errorf("kafka admin create topic:%s err:%v", tc.Topic, err)
+		}
+	}
+	return nil
+}
+
+// Ping 查询集群信息检查broker是否可用 用于健康检查
+func (a *KafkaAdmin) Ping(ctx context.Context) error {
+	done := make(chan error, 1)
+	go func() {
+		_, _, err := a.admin.DescribeCluster()
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Close 关闭KafkaAdmin
+func (a *KafkaAdmin) Close() error {
+	return a.admin.Close()
+}
@@ -0,0 +1,140 @@
+package mq
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Shopify/sarama"
+)
+
+const adminTestGroup = "billing"
+
+// newMockAdmin orders有0 1两个分区 最早位点0 最新位点分别为100 50 消费组已提交40 -1
+func newMockAdmin(t *testing.T, members int) (*KafkaAdmin, *sarama.MockBroker, *sarama.MockOffsetResponse) {
+	broker := sarama.NewMockBroker(t, 1)
+
+	// DescribeGroups按V2_3_0_0使用version 4 MockDescribeGroupsResponse只支持version 0
+	description := &sarama.GroupDescription{Version: 4, GroupId: adminTestGroup, State: "Empty",
+		Members: map[string]*sarama.GroupMemberDescription{}}
+	for i := 0; i < members; i++ {
+		description.State = "Stable"
+		description.Members[string(rune('a'+i))] = &sarama.GroupMemberDescription{Version: 4}
+	}
+	offsets := sarama.NewMockOffsetResponse(t).
+		SetOffset("orders", 0, sarama.OffsetOldest, 0).
+		SetOffset("orders", 0, sarama.OffsetNewest, 100).
+		SetOffset("orders", 1, sarama.OffsetOldest, 0).
+		SetOffset("orders", 1, sarama.OffsetNewest, 50)
+	broker.SetHandlerByMap(map[string]sarama.MockResponse{
+		"MetadataRequest": sarama.NewMockMetadataResponse(t).
+			SetBroker(broker.Addr(), broker.BrokerID()).
+			SetController(broker.BrokerID()).
+			SetLeader("orders", 0, broker.BrokerID()).
+			SetLeader("orders", 1, broker.BrokerID()),
+		"OffsetRequest": offsets,
+		"FindCoordinatorRequest": sarama.NewMockFindCoordinatorResponse(t).
+			SetCoordinator(sarama.CoordinatorGroup, adminTestGroup, broker),
+		"OffsetFetchRequest": sarama.NewMockOffsetFetchResponse(t).
+			SetOffset(adminTestGroup, "orders", 0, 40, "", sarama.ErrNoError).
+			SetOffset(adminTestGroup, "orders", 1, -1, "", sarama.ErrNoError),
+		"DescribeGroupsRequest": sarama.NewMockWrapper(&sarama.DescribeGroupsResponse{
+			Version: 4, Groups: []*sarama.GroupDescription{description},
+		}),
+		"OffsetCommitRequest": sarama.NewMockOffsetCommitResponse(t),
+	})
+
+	admin, err := NewKafkaAdmin(&Config{
+		Endpoints: []string{broker.Addr()},
+		Group:     adminTestGroup,
+		Topics:    []TopicConfig{{Name: "order", Topic: "orders"}},
+	})
+	if err != nil {
+		broker.Close()
+		t.Fatal(err)
+	}
+	return admin, broker, offsets
+}
+
+// committedOffsets 最后一次OffsetCommitRequest中各分区的位点
+func committedOffsets(t *testing.T, broker *sarama.MockBroker) map[int32]int64 {
+	var req *sarama.OffsetCommitRequest
+	for _, rr := range broker.History() {
+		if r, ok := rr.Request.(*sarama.OffsetCommitRequest); ok {
+			req = r
+		}
+	}
+	if req == nil {
+		t.Fatal("no offset commit")
+	}
+	offsets := make(map[int32]int64)
+	for _, p := range []int32{0, 1} {
+		if offset, _, err := req.Offset("orders", p); err == nil {
+			offsets[p] = offset
+		}
+	}
+	return offsets
+}
+
+func TestAdminLag(t *testing.T) {
+	admin, broker, _ := newMockAdmin(t, 0)
+	defer broker.Close()
+	defer admin.Close()
+
+	lags, err := admin.Lag()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []PartitionLag{
+		{Topic: "orders", Partition: 0, Committed: 40, Latest: 100, Lag: 60},
+		{Topic: "orders", Partition: 1, Committed: -1, Latest: 50, Lag: 50},
+	}
+	if len(lags) != len(want) {
+		t.Fatalf("lag got %+v", lags)
+	}
+	for i := range want {
+		if lags[i] != want[i] {
+			t.Errorf("partition %d lag got %+v, want %+v", i, lags[i], want[i])
+		}
+	}
+}
+
+func TestAdminResetOffsets(t *testing.T) {
+	at := time.Now().Add(-time.Hour)
+	ms := at.UnixNano() / int64(time.Millisecond)
+
+	cases := []struct {
+		name  string
+		reset func(a *KafkaAdmin) error
+		want  map[int32]int64
+	}{
+		{"earliest", func(a *KafkaAdmin) error { return a.ResetOffsetsToEarliest("order") }, map[int32]int64{0: 0, 1: 0}},
+		{"latest", func(a *KafkaAdmin) error { return a.ResetOffsetsToLatest("order") }, map[int32]int64{0: 100, 1: 50}},
+		// 分区1在该时间之后没有消息 重置到最新
+		{"timestamp", func(a *KafkaAdmin) error { return a.ResetOffsetsToTime("order", at) }, map[int32]int64{0: 70, 1: 50}},
+	}
+	for _, tc := range cases {
+		admin, broker, offsets := newMockAdmin(t, 0)
+		offsets.SetOffset("orders", 0, ms, 70).SetOffset("orders", 1, ms, -1)
+
+		if err := tc.reset(admin); err != nil {
+			t.Errorf("%s reset err %v", tc.name, err)
+		} else if got := committedOffsets(t, broker); len(got) != 2 || got[0] != tc.want[0] || got[1] != tc.want[1] {
+			t.Errorf("%s committed %v, want %v", tc.name, got, tc.want)
+		}
+		admin.Close()
+		broker.Close()
+	}
+}
+
+func TestAdminResetOffsetsActiveGroup(t *testing.T) {
+	admin, broker, _ := newMockAdmin(t, 1)
+	defer broker.Close()
+	defer admin.Close()
+
+	if err := admin.ResetOffsetsToEarliest("order"); err == nil {
+		t.Error("reset with active members accepted")
+	}
+	if err := admin.ResetOffsetsToEarliest("unknown"); err == nil {
+		t.Error("reset unknown topic accepted")
+	}
+}
@@ -3,6 +3,7 @@ package mq
 import (
 	"context"
 	"errors"
+	"time"
 )
 
 const (
@@ -21,9 +22,10 @@ type Event interface {
 
 // Message 消息结构
 type Message struct {
-	Tag   string
-	Key   string
-	Value []byte
+	Tag     string
+	Key     string
+	Value   []byte
+	Headers map[string]string
 }
 
 // Consumer 消费接口
@@ -56,6 +58,8 @@ func NewConsumer(broker int, conf *Config) Consumer {
 // SyncProducer 同步生产接口
 type SyncProducer interface {
 	Send(ctx context.Context, topicName string, msg *Message) error
+	// SendDelayed 发送延时消息 消费者不早于delay后收到
+	SendDelayed(ctx context.Context, topicName string, msg *Message, delay time.Duration) error
 	Close() error
 }
 
@@ -82,6 +86,8 @@ func NewSyncProducer(broker int, conf *Config) SyncProducer {
 // AsyncProducer 异步生产接口
 type AsyncProducer interface {
 	Send(ctx context.Context, topicName string, msg *Message) error
+	// SendDelayed 发送延时消息 消费者不早于delay后收到
+	SendDelayed(ctx context.Context, topicName string, msg *Message, delay time.Duration) error
 	Close() error
 }
 
@@ -105,10 +111,49 @@ func NewAsyncProducer(broker int, conf Config) AsyncProducer {
 	return producer
 }
 
+// Offset 消费位点 Offset为下一条待消费消息的位点
+type Offset struct {
+	Topic     string
+	Partition int32
+	Offset    int64
+}
+
+// TransactionalProducer 事务生产接口 Begin与Commit/Abort之间发送的消息和提交的消费位点原子生效
+type TransactionalProducer interface {
+	Begin() error
+	Send(ctx context.Context, topicName string, msg *Message) error
+	SendOffsets(group string, offsets []Offset) error
+	Commit() error
+	Abort() error
+	Close() error
+}
+
+// NewTransactionalProducer 创建TransactionalProducer
+func NewTransactionalProducer(broker int, conf *Config) TransactionalProducer {
+	var (
+		producer TransactionalProducer
+		err      error
+	)
+
+	switch broker {
+	case KAFKA:
+		producer, err = NewKafkaTransactionalProducer(conf)
+	default:
+		producer, err = nil, errors.New("unknow broker type")
+	}
+
+	if err != nil {
+		panic(err)
+	}
+	return producer
+}
+
 // TopicConfig topic配置
 type TopicConfig struct {
-	Name  string `toml:"name"`
-	Topic string `toml:"topic"`
+	Name        string `toml:"name"`
+	Topic       string `toml:"topic"`
+	Partitions  int32  `toml:"partitions"`  // 创建topic时的分区数
+	Replication int16  `toml:"replication"` // 创建topic时的副本数
 }
 
 // Config 消息队列配置项
@@ -120,4 +165,10 @@ type Config struct {
 	Instance  string        `toml:"instance"`
 	Group     string        `toml:"group"`
 	Topics    []TopicConfig `toml:"topics"`
+	// TransactionID 事务生产者ID 同一时刻每个生产者实例需唯一
+	TransactionID string `toml:"transaction_id"`
+	// ReadCommitted 消费者只读取已提交事务的消息 事务生产者Abort的消息不可见 默认读取全部消息
+	ReadCommitted bool `toml:"read_committed"`
+	// Delay 延时消息配置
+	Delay DelayConfig `toml:"delay"`
 }
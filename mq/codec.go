@@ -0,0 +1,164 @@
+package mq
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+
+	"google.golang.org/protobuf/proto"
+)
+
+const (
+	// HeaderContentType 消息头 标识Value的编码格式
+	HeaderContentType = "content-type"
+
+	FormatJSON  = "json"
+	FormatProto = "proto"
+)
+
+// Serializer 消息体编解码接口
+type Serializer interface {
+	Marshal(v interface{}) ([]byte, error)
+	Unmarshal(data []byte, v interface{}) error
+}
+
+var (
+	serializersMu sync.RWMutex
+	serializers   = make(map[string]Serializer)
+)
+
+// RegisterSerializer 按格式名注册Serializer
+// 重复注册同名格式或serializer为nil时panic
+func RegisterSerializer(format string, serializer Serializer) {
+	serializersMu.Lock()
+	defer serializersMu.Unlock()
+
+	if serializer == nil {
+		panic("mq: RegisterSerializer serializer is nil")
+	}
+	if _, ok := serializers[format]; ok {
+		panic("mq: RegisterSerializer called twice for format " + format)
+	}
+	serializers[format] = serializer
+}
+
+// GetSerializer 获取已注册的Serializer
+func GetSerializer(format string) (Serializer, error) {
+	serializersMu.RLock()
+	defer serializersMu.RUnlock()
+
+	serializer, ok := serializers[format]
+	if !ok {
+		return nil, fmt.Errorf("mq: unknown serializer format %q", format)
+	}
+	return serializer, nil
+}
+
+// Sender 发送接口 SyncProducer AsyncProducer TransactionalProducer均满足
+type Sender interface {
+	Send(ctx context.Context, topicName string, msg *Message) error
+}
+
+// NewMessage 按format编码v 生成带格式消息头的Message
+func NewMessage(format, key string, v interface{}) (*Message, error) {
+	serializer, err := GetSerializer(format)
+	if err != nil {
+		return nil, err
+	}
+
+	value, err := serializer.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Message{
+		Key:     key,
+		Value:   value,
+		Headers: map[string]string{HeaderContentType: format},
+	}, nil
+}
+
+// SendJSON json编码v后发送
+func SendJSON(ctx context.Context, producer Sender, topicName, key string, v interface{}) error {
+	msg, err := NewMessage(FormatJSON, key, v)
+	if err != nil {
+		return err
+	}
+	return producer.Send(ctx, topicName, msg)
+}
+
+// SendProto protobuf编码v后发送
+func SendProto(ctx context.Context, producer Sender, topicName, key string, v proto.Message) error {
+	msg, err := NewMessage(FormatProto, key, v)
+	if err != nil {
+		return err
+	}
+	return producer.Send(ctx, topicName, msg)
+}
+
+// Decode 按消息头中的格式解码消息体到dst 未标识格式的消息按json解码
+// 通过UseSchemaRegistry设置注册中心后 以0字节开头的消息按schema帧头校验schema ID并去除帧头
+// 未设置注册中心时不识别帧头 带帧头的消息需先设置注册中心
+func Decode(event Event, dst interface{}) error {
+	msg := event.GetMessage()
+
+	format := msg.Headers[HeaderContentType]
+	if format == "" {
+		format = FormatJSON
+	}
+
+	value := msg.Value
+	if registry := schemaRegistry(); registry != nil {
+		if id, payload, ok := unframe(value); ok {
+			schema, err := registry.GetByID(id)
+			if err != nil {
+				return err
+			}
+			if schema != nil && schema.Format != "" {
+				format = schema.Format
+			}
+			value = payload
+		}
+	}
+
+	serializer, err := GetSerializer(format)
+	if err != nil {
+		return err
+	}
+	return serializer.Unmarshal(value, dst)
+}
+
+type jsonSerializer struct{}
+
+func (jsonSerializer) Marshal(v interface{}) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+func (jsonSerializer) Unmarshal(data []byte, v interface{}) error {
+	return json.Unmarshal(data, v)
+}
+
+type protoSerializer struct{}
+
+func (protoSerializer) Marshal(v interface{}) ([]byte, error) {
+	pm, ok := v.(proto.Message)
+	if !ok {
+		return nil, errors.New("mq: proto serializer value is not proto.Message")
+	}
+	return proto.Marshal(pm)
+}
+
+func (protoSerializer) Unmarshal(data []byte, v interface{}) error {
+	pm, ok := v.(proto.Message)
+	if !ok {
+		return errors.New("mq: proto serializer dst is not proto.Message")
+	}
+	return proto.Unmarshal(data, pm)
+}
+
+func init() {
+	RegisterSerializer(FormatJSON, jsonSerializer{})
+	RegisterSerializer(FormatProto, protoSerializer{})
+}
@@ -0,0 +1,132 @@
+package mq
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+type testOrder struct {
+	ID    int    `json:"id"`
+	Title string `json:"title"`
+}
+
+func TestDecodeJSON(t *testing.T) {
+	msg, err := NewMessage(FormatJSON, "k", &testOrder{ID: 1, Title: "a"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var order testOrder
+	if err := Decode(&KafkaEvent{Message: *msg}, &order); err != nil {
+		t.Fatal(err)
+	}
+	if order.ID != 1 || order.Title != "a" {
+		t.Errorf("decode got %+v", order)
+	}
+}
+
+func TestDecodeProto(t *testing.T) {
+	msg, err := NewMessage(FormatProto, "k", wrapperspb.String("order-1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var order wrapperspb.StringValue
+	if err := Decode(&KafkaEvent{Message: *msg}, &order); err != nil {
+		t.Fatal(err)
+	}
+	if order.GetValue() != "order-1" {
+		t.Errorf("decode got %q", order.GetValue())
+	}
+}
+
+type rawSerializer struct{}
+
+func (rawSerializer) Marshal(v interface{}) ([]byte, error) { return v.([]byte), nil }
+
+func (rawSerializer) Unmarshal(data []byte, v interface{}) error {
+	*v.(*[]byte) = append([]byte(nil), data...)
+	return nil
+}
+
+func init() {
+	RegisterSerializer("raw", rawSerializer{})
+}
+
+// TestDecodeZeroPrefix 未设置注册中心时以0字节开头的消息不按帧头处理
+func TestDecodeZeroPrefix(t *testing.T) {
+	value := []byte{0, 0, 0, 0, 1, 'a', 'b'}
+	msg := Message{Value: value, Headers: map[string]string{HeaderContentType: "raw"}}
+
+	var got []byte
+	if err := Decode(&KafkaEvent{Message: msg}, &got); err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != string(value) {
+		t.Errorf("decode got %v, want %v", got, value)
+	}
+}
+
+func TestSchemaEncoder(t *testing.T) {
+	dir, err := ioutil.TempDir("", "schemas")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "schemas.json")
+	registry, err := NewFileSchemaRegistry(path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	v1 := `{"type":"object","required":["id"]}`
+	encoder, err := NewSchemaEncoder(registry, "order", FormatJSON, v1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := registry.Register("order", FormatJSON, `{"type":"object","required":["id","title"]}`); err == nil {
+		t.Error("register incompatible schema should fail")
+	}
+	v2, err := registry.Register("order", FormatJSON, `{"type":"object","required":[]}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v2.Version != 2 {
+		t.Errorf("version got %d", v2.Version)
+	}
+
+	// 重新加载文件后ID保持不变
+	reloaded, err := NewFileSchemaRegistry(path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	UseSchemaRegistry(reloaded)
+	defer UseSchemaRegistry(nil)
+
+	msg, err := encoder.NewMessage("k", &testOrder{ID: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg.Value[0] != magicByte {
+		t.Fatal("message not framed")
+	}
+
+	var order testOrder
+	if err := Decode(&KafkaEvent{Message: *msg}, &order); err != nil {
+		t.Fatal(err)
+	}
+	if order.ID != 2 {
+		t.Errorf("decode got %+v", order)
+	}
+
+	msg.Value = frame(99, msg.Value[frameBytes:])
+	if err := Decode(&KafkaEvent{Message: *msg}, &order); err == nil {
+		t.Error("decode unknown schema id should fail")
+	}
+}
@@ -0,0 +1,368 @@
+package mq
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/Shopify/sarama"
+
+	"github.com/Tokumicn/lego-lib/logs"
+)
+
+const (
+	// headerDelayTopic 延时消息的目标topic
+	headerDelayTopic = "x-delay-topic"
+	// headerDelayDeliverAt 延时消息的投递时间 unix毫秒
+	headerDelayDeliverAt = "x-delay-deliver-at"
+
+	defaultDelayPollInterval = time.Second
+	defaultDelayPollLimit    = 100
+)
+
+// DelayTierConfig 延时层级配置 消息在该topic中至少停留Delay后再转发
+type DelayTierConfig struct {
+	Delay string `toml:"delay"` // 如 10s 1m 1h
+	Topic string `toml:"topic"`
+}
+
+// DelayConfig 延时消息配置
+type DelayConfig struct {
+	Group        string            `toml:"group"`         // 转发器消费组 默认为 Group.delay
+	PollInterval string            `toml:"poll_interval"` // 使用DelayStore时的轮询间隔 默认1s
+	Tiers        []DelayTierConfig `toml:"tiers"`
+}
+
+type delayTier struct {
+	delay time.Duration
+	topic string
+}
+
+// delayTiers 按delay升序排列
+type delayTiers []delayTier
+
+func newDelayTiers(conf DelayConfig) (delayTiers, error) {
+	tiers := make(delayTiers, 0, len(conf.Tiers))
+	for _, tc := range conf.Tiers {
+		d, err := time.ParseDuration(tc.Delay)
+		if err != nil {
+			return nil, fmt.Errorf("kafka delay tier %s parse delay err:%v", tc.Topic, err)
+		}
+		if d <= 0 || tc.Topic == "" {
+			return nil, fmt.Errorf("kafka delay tier %s invalid", tc.Topic)
+		}
+		tiers = append(tiers, delayTier{delay: d, topic: tc.Topic})
+	}
+	sort.Slice(tiers, func(i, j int) bool { return tiers[i].delay < tiers[j].delay })
+	return tiers, nil
+}
+
+// pick 选择不超过remaining的最大层级 remaining小于所有层级时选择最小层级
+func (t delayTiers) pick(remaining time.Duration) (delayTier, bool) {
+	if len(t) == 0 {
+		return delayTier{}, false
+	}
+	tier := t[0]
+	for _, candidate := range t[1:] {
+		if candidate.delay > remaining {
+			break
+		}
+		tier = candidate
+	}
+	return tier, true
+}
+
+func (t delayTiers) find(topic string) (delayTier, bool) {
+	for _, tier := range t {
+		if tier.topic == topic {
+			return tier, true
+		}
+	}
+	return delayTier{}, false
+}
+
+// delayer 生产者共用的延时投递逻辑 配置了store时写入store 否则写入延时层级topic
+type delayer struct {
+	tiers delayTiers
+	store DelayStore
+}
+
+// route 返回需要写入延时层级topic的消息 已写入store时返回nil
+func (d *delayer) route(ctx context.Context, topic string, msg *Message, delay time.Duration) (*sarama.ProducerMessage, error) {
+	deliverAt := time.Now().Add(delay)
+	if d.store != nil {
+		return nil, d.store.Save(ctx, &DelayedMessage{
+			Topic:     topic,
+			DeliverAt: deliverAt,
+			Message:   *msg,
+		})
+	}
+
+	tier, ok := d.tiers.pick(delay)
+	if !ok {
+		return nil, errors.New("kafka delay tiers not configured")
+	}
+	return newDelayedProducerMessage(tier.topic, topic, deliverAt, msg), nil
+}
+
+func newDelayedProducerMessage(tierTopic, topic string, deliverAt time.Time, msg *Message) *sarama.ProducerMessage {
+	headers := make(map[string]string, len(msg.Headers)+2)
+	for k, v := range msg.Headers {
+		headers[k] = v
+	}
+	headers[headerDelayTopic] = topic
+	headers[headerDelayDeliverAt] = strconv.FormatInt(deliverAt.UnixNano()/int64(time.Millisecond), 10)
+
+	delayed := *msg
+	delayed.Headers = headers
+	return newProducerMessage(tierTopic, &delayed)
+}
+
+// KafkaDelayRepublisher 延时消息转发器
+// 消费延时层级topic 到期后投递到目标topic 未到期的转入更小的层级; 配置DelayStore时轮询到期消息投递
+type KafkaDelayRepublisher struct {
+	client   sarama.SyncProducer
+	consumer sarama.ConsumerGroup
+	tiers    delayTiers
+	store    DelayStore
+	interval time.Duration
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// NewKafkaDelayRepublisher 创建KafkaDelayRepublisher store可为nil
+func NewKafkaDelayRepublisher(conf *Config, store DelayStore) (*KafkaDelayRepublisher, error) {
+	tiers, err := newDelayTiers(conf.Delay)
+	if err != nil {
+		return nil, err
+	}
+	if len(tiers) == 0 && store == nil {
+		return nil, errors.New("kafka delay republisher neither tiers nor store configured")
+	}
+
+	interval := defaultDelayPollInterval
+	if conf.Delay.PollInterval != "" {
+		if interval, err = time.ParseDuration(conf.Delay.PollInterval); err != nil {
+			return nil, err
+		}
+	}
+
+	config := sarama.NewConfig()
+	config.Version = sarama.V2_3_0_0
+	config.Producer.Return.Successes = true
+	config.Producer.Return.Errors = true
+
+	client, err := sarama.NewSyncProducer(conf.Endpoints, config)
+	if err != nil {
+		return nil, err
+	}
+
+	republisher := &KafkaDelayRepublisher{
+		client:   client,
+		tiers:    tiers,
+		store:    store,
+		interval: interval,
+	}
+	republisher.ctx, republisher.cancel = context.WithCancel(context.Background())
+
+	if len(tiers) > 0 {
+		group := conf.Delay.Group
+		if group == "" {
+			group = conf.Group + ".delay"
+		}
+
+		config := sarama.NewConfig()
+		config.Version = sarama.V2_3_0_0
+		config.Consumer.Offsets.Initial = sarama.OffsetOldest
+		config.Consumer.Return.Errors = true
+
+		republisher.consumer, err = sarama.NewConsumerGroup(conf.Endpoints, group, config)
+		if err != nil {
+			client.Close()
+			return nil, err
+		}
+	}
+	return republisher, nil
+}
+
+// Start 启动转发
+func (r *KafkaDelayRepublisher) Start() error {
+	if r.consumer != nil {
+		topics := make([]string, 0, len(r.tiers))
+		for _, tier := range r.tiers {
+			topics = append(topics, tier.topic)
+		}
+
+		r.wg.Add(2)
+		go func() {
+			defer r.wg.Done()
+			for err := range r.consumer.Errors() {
+				logs.Errorf("kafka delay consume recv err:%v", err)
+			}
+		}()
+		go func() {
+			defer r.wg.Done()
+			for r.ctx.Err() == nil {
+				if err := r.consumer.Consume(r.ctx, topics, r); err != nil {
+					logs.Errorf("kafka delay consume invoke err:%v", err)
+					r.sleep(time.Second)
+				}
+			}
+		}()
+	}
+
+	if r.store != nil {
+		r.wg.Add(1)
+		go func() {
+			defer r.wg.Done()
+			r.pollStore()
+		}()
+	}
+	return nil
+}
+
+// Close 停止转发
+func (r *KafkaDelayRepublisher) Close() error {
+	r.cancel()
+	var err error
+	if r.consumer != nil {
+		err = r.consumer.Close()
+	}
+	r.wg.Wait()
+	if e := r.client.Close(); e != nil && err == nil {
+		err = e
+	}
+	return err
+}
+
+// Setup ...
+func (r *KafkaDelayRepublisher) Setup(sarama.ConsumerGroupSession) error {
+	return nil
+}
+
+// Cleanup ...
+func (r *KafkaDelayRepublisher) Cleanup(sarama.ConsumerGroupSession) error {
+	return nil
+}
+
+// ConsumeClaim 同一层级内消息按写入顺序到期 队首未到期时阻塞等待
+func (r *KafkaDelayRepublisher) ConsumeClaim(sess sarama.ConsumerGroupSession, claim sarama.ConsumerGroupClaim) error {
+	defer doRecover()
+	tier, _ := r.tiers.find(claim.Topic())
+
+	for msg := range claim.Messages() {
+		topic, deliverAt, ok := getDelayHeaders(msg.Headers)
+		if !ok {
+			logs.Errorf("kafka delay drop message without delay headers topic:%s partition:%d offset:%d",
+				msg.Topic, msg.Partition, msg.Offset)
+			sess.MarkMessage(msg, "")
+			continue
+		}
+
+		due := msg.Timestamp.Add(tier.delay)
+		if deliverAt.Before(due) {
+			due = deliverAt
+		}
+		if !r.waitUntil(sess.Context(), due) {
+			return nil
+		}
+
+		message := &Message{
+			Key:     string(msg.Key),
+			Value:   msg.Value,
+			Headers: getMessageHeaders(msg.Headers),
+		}
+		for !r.forward(topic, deliverAt, message) {
+			if !r.waitUntil(sess.Context(), time.Now().Add(time.Second)) {
+				return nil
+			}
+		}
+		sess.MarkMessage(msg, "")
+	}
+	return nil
+}
+
+// forward 到期消息投递到目标topic 未到期消息转入下一层级
+func (r *KafkaDelayRepublisher) forward(topic string, deliverAt time.Time, msg *Message) bool {
+	var message *sarama.ProducerMessage
+	remaining := time.Until(deliverAt)
+	if tier, ok := r.tiers.pick(remaining); ok && remaining > 0 {
+		message = newDelayedProducerMessage(tier.topic, topic, deliverAt, msg)
+	} else {
+		delete(msg.Headers, headerDelayTopic)
+		delete(msg.Headers, headerDelayDeliverAt)
+		message = newProducerMessage(topic, msg)
+	}
+
+	if _, _, err := r.client.SendMessage(message); err != nil {
+		logs.Errorf("kafka delay forward topic:%s err:%v", message.Topic, err)
+		return false
+	}
+	return true
+}
+
+func (r *KafkaDelayRepublisher) pollStore() {
+	for {
+		for {
+			n, err := r.store.Due(r.ctx, time.Now(), defaultDelayPollLimit, func(msg *DelayedMessage) error {
+				_, _, err := r.client.SendMessage(newProducerMessage(msg.Topic, &msg.Message))
+				return err
+			})
+			if err != nil {
+				logs.Errorf("kafka delay poll store err:%v", err)
+			}
+			if err != nil || n < defaultDelayPollLimit {
+				break
+			}
+		}
+		if !r.sleep(r.interval) {
+			return
+		}
+	}
+}
+
+func (r *KafkaDelayRepublisher) sleep(d time.Duration) bool {
+	return r.waitUntil(r.ctx, time.Now().Add(d))
+}
+
+func (r *KafkaDelayRepublisher) waitUntil(ctx context.Context, t time.Time) bool {
+	d := time.Until(t)
+	if d <= 0 {
+		return ctx.Err() == nil
+	}
+
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return false
+	case <-r.ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
+
+func getDelayHeaders(headers []*sarama.RecordHeader) (topic string, deliverAt time.Time, ok bool) {
+	var ms string
+	for _, header := range headers {
+		switch string(header.Key) {
+		case headerDelayTopic:
+			topic = string(header.Value)
+		case headerDelayDeliverAt:
+			ms = string(header.Value)
+		}
+	}
+
+	n, err := strconv.ParseInt(ms, 10, 64)
+	if topic == "" || err != nil {
+		return "", time.Time{}, false
+	}
+	return topic, time.Unix(0, n*int64(time.Millisecond)), true
+}
@@ -0,0 +1,31 @@
+package mq
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"time"
+)
+
+// DelayedMessage 存储中的延时消息 Topic为目标topic
+type DelayedMessage struct {
+	ID        string    `json:"id"`
+	Topic     string    `json:"topic"`
+	DeliverAt time.Time `json:"deliver_at"`
+	Message   Message   `json:"message"`
+}
+
+// DelayStore 延时消息存储接口 实现位于delaystore下的子包 如delaystore/redis delaystore/postgresql
+type DelayStore interface {
+	// Save 保存延时消息 ID为空时生成
+	Save(ctx context.Context, msg *DelayedMessage) error
+	// Due 取出最多limit条now之前到期的消息交给fn投递 fn成功的消息从存储中删除
+	// 返回投递成功的条数 fn出错时停止投递并返回该错误
+	// 多个实例同时调用时同一条消息只会被一个实例取出
+	Due(ctx context.Context, now time.Time, limit int, fn func(msg *DelayedMessage) error) (int, error)
+}
+
+// NewDelayedMessageID 生成延时消息ID 供DelayStore实现使用
+func NewDelayedMessageID() string {
+	return fmt.Sprintf("%d-%d", time.Now().UnixNano(), rand.Int63())
+}
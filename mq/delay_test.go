@@ -0,0 +1,146 @@
+package mq
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Shopify/sarama/mocks"
+
+	"github.com/Tokumicn/lego-lib/logs"
+)
+
+func TestDelayTiersPick(t *testing.T) {
+	tiers, err := newDelayTiers(DelayConfig{Tiers: []DelayTierConfig{
+		{Delay: "1m", Topic: "delay-1m"},
+		{Delay: "10s", Topic: "delay-10s"},
+		{Delay: "1h", Topic: "delay-1h"},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := map[time.Duration]string{
+		time.Second:      "delay-10s",
+		30 * time.Second: "delay-10s",
+		time.Minute:      "delay-1m",
+		59 * time.Minute: "delay-1m",
+		48 * time.Hour:   "delay-1h",
+	}
+	for remaining, want := range cases {
+		if tier, _ := tiers.pick(remaining); tier.topic != want {
+			t.Errorf("pick %s got %s want %s", remaining, tier.topic, want)
+		}
+	}
+}
+
+// memoryDelayStore 按保存顺序投递 fn失败时保留失败及其后的消息
+type memoryDelayStore struct {
+	mu    sync.Mutex
+	msgs  []*DelayedMessage
+	calls int
+}
+
+func (s *memoryDelayStore) Save(ctx context.Context, msg *DelayedMessage) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.msgs = append(s.msgs, msg)
+	return nil
+}
+
+func (s *memoryDelayStore) Due(ctx context.Context, now time.Time, limit int, fn func(msg *DelayedMessage) error) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.calls++
+	n := 0
+	for n < limit && n < len(s.msgs) && !s.msgs[n].DeliverAt.After(now) {
+		if err := fn(s.msgs[n]); err != nil {
+			s.msgs = s.msgs[n:]
+			return n, err
+		}
+		n++
+	}
+	s.msgs = s.msgs[n:]
+	return n, nil
+}
+
+func (s *memoryDelayStore) state() (int, int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.msgs), s.calls
+}
+
+func runPollStore(producer *mocks.SyncProducer, store DelayStore, interval time.Duration) func() {
+	r := &KafkaDelayRepublisher{client: producer, store: store, interval: interval}
+	r.ctx, r.cancel = context.WithCancel(context.Background())
+	done := make(chan struct{})
+	stop := func() {
+		r.cancel()
+		<-done
+		producer.Close()
+	}
+	go func() {
+		defer close(done)
+		r.pollStore()
+	}()
+	return stop
+}
+
+func waitDrained(t *testing.T, store *memoryDelayStore) int {
+	deadline := time.Now().Add(3 * time.Second)
+	for {
+		left, calls := store.state()
+		if left == 0 {
+			return calls
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("%d messages left after %d polls", left, calls)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// TestPollStoreBatches 取满一批时立即继续取 不等待轮询间隔
+func TestPollStoreBatches(t *testing.T) {
+	store := &memoryDelayStore{}
+	total := defaultDelayPollLimit + defaultDelayPollLimit/2
+	for i := 0; i < total; i++ {
+		store.Save(context.Background(), &DelayedMessage{
+			ID: fmt.Sprint(i), Topic: "orders", DeliverAt: time.Now(), Message: Message{Value: []byte("v")},
+		})
+	}
+
+	producer := mocks.NewSyncProducer(t, mocks.NewTestConfig())
+	for i := 0; i < total; i++ {
+		producer.ExpectSendMessageAndSucceed()
+	}
+	defer runPollStore(producer, store, time.Hour)()
+
+	if calls := waitDrained(t, store); calls != 2 {
+		t.Errorf("polled %d times", calls)
+	}
+}
+
+// TestPollStoreRetry 投递失败的消息在下一次轮询时重新投递
+func TestPollStoreRetry(t *testing.T) {
+	logs.Init(&logs.Config{Writer: "console", Level: "error"})
+	store := &memoryDelayStore{}
+	for _, id := range []string{"a", "b"} {
+		store.Save(context.Background(), &DelayedMessage{
+			ID: id, Topic: "orders", DeliverAt: time.Now(), Message: Message{Value: []byte(id)},
+		})
+	}
+
+	producer := mocks.NewSyncProducer(t, mocks.NewTestConfig())
+	producer.ExpectSendMessageAndSucceed()
+	producer.ExpectSendMessageAndFail(errors.New("broker down"))
+	producer.ExpectSendMessageAndSucceed()
+	defer runPollStore(producer, store, 10*time.Millisecond)()
+
+	if calls := waitDrained(t, store); calls < 2 {
+		t.Errorf("polled %d times", calls)
+	}
+}
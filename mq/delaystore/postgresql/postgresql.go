@@ -0,0 +1,101 @@
+// Package postgresql 基于database/postgresql的mq.DelayStore
+package postgresql
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	legopostgresql "github.com/Tokumicn/lego-lib/database/postgresql"
+	"github.com/Tokumicn/lego-lib/mq"
+)
+
+// delayedMessageModel postgresql中的延时消息表
+type delayedMessageModel struct {
+	ID        string    `gorm:"primary_key"`
+	Topic     string    `gorm:"not null"`
+	MsgKey    string    `gorm:"column:msg_key"`
+	Value     []byte    `gorm:"column:value"`
+	Headers   string    `gorm:"column:headers"`
+	DeliverAt time.Time `gorm:"index;not null"`
+}
+
+func (delayedMessageModel) TableName() string {
+	return "mq_delayed_messages"
+}
+
+// Store 基于database/postgresql的mq.DelayStore
+type Store struct {
+	db *legopostgresql.DB
+}
+
+// NewStore 创建Store 表不存在时自动创建
+func NewStore(pool *legopostgresql.Pool) (*Store, error) {
+	db := pool.DB()
+	if err := db.AutoMigrate(&delayedMessageModel{}).Error; err != nil {
+		return nil, err
+	}
+	return &Store{db: db}, nil
+}
+
+// Save 保存延时消息
+func (s *Store) Save(ctx context.Context, msg *mq.DelayedMessage) error {
+	if msg.ID == "" {
+		msg.ID = mq.NewDelayedMessageID()
+	}
+	headers, err := json.Marshal(msg.Message.Headers)
+	if err != nil {
+		return err
+	}
+
+	return s.db.Create(&delayedMessageModel{
+		ID:        msg.ID,
+		Topic:     msg.Topic,
+		MsgKey:    msg.Message.Key,
+		Value:     msg.Message.Value,
+		Headers:   string(headers),
+		DeliverAt: msg.DeliverAt,
+	}).Error
+}
+
+// Due 在事务中以FOR UPDATE SKIP LOCKED锁定到期消息 投递成功的消息随事务删除
+func (s *Store) Due(ctx context.Context, now time.Time, limit int, fn func(msg *mq.DelayedMessage) error) (int, error) {
+	var rows []delayedMessageModel
+	var delivered []string
+	var fnErr error
+
+	err := s.db.Transaction(func(tx *legopostgresql.DB) error {
+		if err := tx.Raw(`SELECT * FROM mq_delayed_messages WHERE deliver_at <= ?
+			ORDER BY deliver_at LIMIT ? FOR UPDATE SKIP LOCKED`, now, limit).Scan(&rows).Error; err != nil {
+			return err
+		}
+
+		delivered = make([]string, 0, len(rows))
+		for _, row := range rows {
+			msg := &mq.DelayedMessage{
+				ID:        row.ID,
+				Topic:     row.Topic,
+				DeliverAt: row.DeliverAt,
+				Message:   mq.Message{Key: row.MsgKey, Value: row.Value},
+			}
+			if row.Headers != "" {
+				if fnErr = json.Unmarshal([]byte(row.Headers), &msg.Message.Headers); fnErr != nil {
+					break
+				}
+			}
+			if fnErr = fn(msg); fnErr != nil {
+				break
+			}
+			delivered = append(delivered, row.ID)
+		}
+
+		if len(delivered) == 0 {
+			return nil
+		}
+		return tx.Where("id IN (?)", delivered).Delete(&delayedMessageModel{}).Error
+	})
+	if err != nil {
+		return 0, err
+	}
+	return len(delivered), fnErr
+}
@@ -0,0 +1,115 @@
+package postgresql
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/jinzhu/gorm"
+
+	"github.com/Tokumicn/lego-lib/mq"
+)
+
+func newTestStore(t *testing.T) (*Store, sqlmock.Sqlmock) {
+	sqlDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	db, err := gorm.Open("postgres", sqlDB)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &Store{db: db}, mock
+}
+
+func dueRows(ids ...string) *sqlmock.Rows {
+	rows := sqlmock.NewRows([]string{"id", "topic", "msg_key", "value", "headers", "deliver_at"})
+	for _, id := range ids {
+		rows.AddRow(id, "orders", id, []byte(id), `{"trace":"t1"}`, time.Now())
+	}
+	return rows
+}
+
+func TestStoreDue(t *testing.T) {
+	s, mock := newTestStore(t)
+	mock.ExpectBegin()
+	mock.ExpectQuery(`SELECT \* FROM mq_delayed_messages`).WillReturnRows(dueRows("a", "b"))
+	mock.ExpectExec(`DELETE FROM "mq_delayed_messages"`).WithArgs("a", "b").WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectCommit()
+
+	var msgs []*mq.DelayedMessage
+	n, err := s.Due(context.Background(), time.Now(), 10, func(msg *mq.DelayedMessage) error {
+		msgs = append(msgs, msg)
+		return nil
+	})
+	if n != 2 || err != nil {
+		t.Fatalf("due got %d %v", n, err)
+	}
+	if msgs[0].ID != "a" || msgs[0].Message.Headers["trace"] != "t1" || string(msgs[1].Message.Value) != "b" {
+		t.Errorf("delivered %+v %+v", msgs[0], msgs[1])
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+// TestStoreDueError 投递失败时只删除已投递的消息 返回已投递数量
+func TestStoreDueError(t *testing.T) {
+	s, mock := newTestStore(t)
+	mock.ExpectBegin()
+	mock.ExpectQuery(`SELECT \* FROM mq_delayed_messages`).WillReturnRows(dueRows("a", "b", "c"))
+	mock.ExpectExec(`DELETE FROM "mq_delayed_messages"`).WithArgs("a").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	fail := errors.New("send failed")
+	n, err := s.Due(context.Background(), time.Now(), 10, func(msg *mq.DelayedMessage) error {
+		if msg.ID == "b" {
+			return fail
+		}
+		return nil
+	})
+	if n != 1 || err != fail {
+		t.Errorf("failed due got %d %v", n, err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestStoreDueQueryError(t *testing.T) {
+	s, mock := newTestStore(t)
+	mock.ExpectBegin()
+	mock.ExpectQuery(`SELECT \* FROM mq_delayed_messages`).WillReturnError(errors.New("connection reset"))
+	mock.ExpectRollback()
+
+	called := false
+	n, err := s.Due(context.Background(), time.Now(), 10, func(msg *mq.DelayedMessage) error {
+		called = true
+		return nil
+	})
+	if n != 0 || err == nil || called {
+		t.Errorf("query error got %d %v called:%v", n, err, called)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+// TestStoreDueDeleteError 删除失败时事务回滚 消息稍后重新投递 不计入已投递数量
+func TestStoreDueDeleteError(t *testing.T) {
+	s, mock := newTestStore(t)
+	mock.ExpectBegin()
+	mock.ExpectQuery(`SELECT \* FROM mq_delayed_messages`).WillReturnRows(dueRows("a"))
+	mock.ExpectExec(`DELETE FROM "mq_delayed_messages"`).WillReturnError(errors.New("connection reset"))
+	mock.ExpectRollback()
+
+	n, err := s.Due(context.Background(), time.Now(), 10, func(msg *mq.DelayedMessage) error { return nil })
+	if n != 0 || err == nil {
+		t.Errorf("delete error got %d %v", n, err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,110 @@
+// Package redis 基于cache/redis的mq.DelayStore 到期时间保存在有序集合中
+package redis
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	redigo "github.com/gomodule/redigo/redis"
+
+	legoredis "github.com/Tokumicn/lego-lib/cache/redis"
+	"github.com/Tokumicn/lego-lib/mq"
+)
+
+const (
+	queueKey   = "mq:delay:queue"
+	payloadKey = "mq:delay:payload"
+	// lease 取出的消息在有序集合中顺延的时长 进程在投递完成前退出时租约到期后重新投递
+	lease = 30 * time.Second
+	// retryDelay 投递失败的消息重新到期的延时
+	retryDelay = time.Second
+)
+
+// saveScript 在同一个脚本中写入payload与到期时间 避免只写入payload的消息永远不被投递
+var saveScript = redigo.NewScript(2, `
+redis.call('HSET', KEYS[2], ARGV[1], ARGV[3])
+return redis.call('ZADD', KEYS[1], ARGV[2], ARGV[1])
+`)
+
+// claimScript 取出到期消息并将到期时间顺延为租约到期时间 返回id与payload交替的列表
+var claimScript = redigo.NewScript(2, `
+local ids = redis.call('ZRANGEBYSCORE', KEYS[1], '-inf', ARGV[1], 'LIMIT', 0, ARGV[2])
+local result = {}
+for _, id in ipairs(ids) do
+	local payload = redis.call('HGET', KEYS[2], id)
+	if payload then
+		redis.call('ZADD', KEYS[1], ARGV[3], id)
+		table.insert(result, id)
+		table.insert(result, payload)
+	else
+		redis.call('ZREM', KEYS[1], id)
+	end
+end
+return result
+`)
+
+// ackScript 删除投递成功的消息
+var ackScript = redigo.NewScript(2, `
+redis.call('ZREM', KEYS[1], ARGV[1])
+return redis.call('HDEL', KEYS[2], ARGV[1])
+`)
+
+// Store 基于cache/redis的mq.DelayStore
+type Store struct {
+	cache *legoredis.Cache
+}
+
+// NewStore 创建Store
+func NewStore(cache *legoredis.Cache) *Store {
+	return &Store{cache: cache}
+}
+
+// Save 通过lua脚本原子地保存消息与到期时间
+func (s *Store) Save(ctx context.Context, msg *mq.DelayedMessage) error {
+	if msg.ID == "" {
+		msg.ID = mq.NewDelayedMessageID()
+	}
+	payload, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	_, err = s.cache.Eval(saveScript, []string{queueKey, payloadKey}, msg.ID, unixMilli(msg.DeliverAt), payload)
+	return err
+}
+
+// Due 通过lua脚本原子地取出消息并顺延租约 fn成功后才删除 进程崩溃时租约到期后重新投递
+// 投递失败的消息及其后未投递的消息1秒后重试
+func (s *Store) Due(ctx context.Context, now time.Time, limit int, fn func(msg *mq.DelayedMessage) error) (int, error) {
+	keys := []string{queueKey, payloadKey}
+	claimed, err := redigo.ByteSlices(s.cache.Eval(claimScript, keys,
+		unixMilli(now), limit, unixMilli(time.Now().Add(lease))))
+	if err != nil {
+		return 0, err
+	}
+
+	n := len(claimed) / 2
+	for i := 0; i < n; i++ {
+		id, payload := string(claimed[2*i]), claimed[2*i+1]
+		var msg mq.DelayedMessage
+		err := json.Unmarshal(payload, &msg)
+		if err == nil {
+			err = fn(&msg)
+		}
+		if err != nil {
+			retryAt := unixMilli(time.Now().Add(retryDelay))
+			for j := i; j < n; j++ {
+				s.cache.Do("ZADD", queueKey, "XX", retryAt, claimed[2*j])
+			}
+			return i, err
+		}
+		if _, err := s.cache.Eval(ackScript, keys, id); err != nil {
+			return i + 1, err
+		}
+	}
+	return n, nil
+}
+
+func unixMilli(t time.Time) int64 {
+	return t.UnixNano() / int64(time.Millisecond)
+}
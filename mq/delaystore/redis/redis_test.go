@@ -0,0 +1,140 @@
+package redis
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+
+	legoredis "github.com/Tokumicn/lego-lib/cache/redis"
+	"github.com/Tokumicn/lego-lib/mq"
+)
+
+func newTestStore(t *testing.T) (*Store, *miniredis.Miniredis) {
+	mr, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cache := legoredis.NewRedisCache().(*legoredis.Cache)
+	if err := cache.StartAndGC(fmt.Sprintf(`{"conn": "%s"}`, mr.Addr())); err != nil {
+		mr.Close()
+		t.Fatal(err)
+	}
+	return NewStore(cache), mr
+}
+
+func saveMessages(t *testing.T, s *Store, deliverAt time.Time, ids ...string) {
+	for i, id := range ids {
+		msg := &mq.DelayedMessage{
+			ID:        id,
+			Topic:     "orders",
+			DeliverAt: deliverAt.Add(time.Duration(i) * time.Millisecond),
+			Message:   mq.Message{Key: id, Value: []byte(id)},
+		}
+		if err := s.Save(context.Background(), msg); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func collect(ids *[]string) func(msg *mq.DelayedMessage) error {
+	return func(msg *mq.DelayedMessage) error {
+		*ids = append(*ids, msg.ID)
+		return nil
+	}
+}
+
+func TestStoreDue(t *testing.T) {
+	s, mr := newTestStore(t)
+	defer mr.Close()
+	ctx := context.Background()
+	now := time.Now()
+	saveMessages(t, s, now.Add(time.Minute), "a", "b")
+
+	var ids []string
+	if n, err := s.Due(ctx, now, 10, collect(&ids)); n != 0 || err != nil {
+		t.Fatalf("before due got %d %v", n, err)
+	}
+	if n, err := s.Due(ctx, now.Add(2*time.Minute), 10, collect(&ids)); n != 2 || err != nil {
+		t.Fatalf("due got %d %v", n, err)
+	}
+	if len(ids) != 2 || ids[0] != "a" || ids[1] != "b" {
+		t.Errorf("delivered %v", ids)
+	}
+	if keys := mr.Keys(); len(keys) != 0 {
+		t.Errorf("acked messages left %v", keys)
+	}
+}
+
+// TestStoreLease 投递中途进程退出 租约到期前不重复投递 到期后重新投递
+func TestStoreLease(t *testing.T) {
+	s, mr := newTestStore(t)
+	defer mr.Close()
+	ctx := context.Background()
+	now := time.Now()
+	saveMessages(t, s, now.Add(-time.Minute), "a")
+
+	func() {
+		defer func() { recover() }()
+		s.Due(ctx, now, 10, func(msg *mq.DelayedMessage) error { panic("crash") })
+	}()
+
+	var ids []string
+	if n, err := s.Due(ctx, now.Add(lease/2), 10, collect(&ids)); n != 0 || err != nil {
+		t.Fatalf("within lease got %d %v", n, err)
+	}
+	if n, err := s.Due(ctx, now.Add(lease+time.Second), 10, collect(&ids)); n != 1 || err != nil {
+		t.Fatalf("after lease got %d %v", n, err)
+	}
+	if len(ids) != 1 || ids[0] != "a" {
+		t.Errorf("redelivered %v", ids)
+	}
+}
+
+// TestStoreDueError 投递失败时返回已投递数量 失败及其后的消息稍后重试
+func TestStoreDueError(t *testing.T) {
+	s, mr := newTestStore(t)
+	defer mr.Close()
+	ctx := context.Background()
+	now := time.Now()
+	saveMessages(t, s, now.Add(-time.Minute), "a", "b", "c")
+
+	fail := errors.New("send failed")
+	n, err := s.Due(ctx, now, 10, func(msg *mq.DelayedMessage) error {
+		if msg.ID == "b" {
+			return fail
+		}
+		return nil
+	})
+	if n != 1 || err != fail {
+		t.Fatalf("failed due got %d %v", n, err)
+	}
+
+	var ids []string
+	if n, err := s.Due(ctx, now, 10, collect(&ids)); n != 0 || err != nil {
+		t.Fatalf("before retry got %d %v", n, err)
+	}
+	if n, err := s.Due(ctx, now.Add(retryDelay+time.Second), 10, collect(&ids)); n != 2 || err != nil {
+		t.Fatalf("retry got %d %v", n, err)
+	}
+	if len(ids) != 2 || ids[0] != "b" || ids[1] != "c" {
+		t.Errorf("retried %v", ids)
+	}
+}
+
+func TestStoreUnavailable(t *testing.T) {
+	s, mr := newTestStore(t)
+	mr.Close()
+
+	msg := &mq.DelayedMessage{Topic: "orders", DeliverAt: time.Now()}
+	if err := s.Save(context.Background(), msg); err == nil {
+		t.Error("save succeeded without redis")
+	}
+	n, err := s.Due(context.Background(), time.Now(), 10, func(msg *mq.DelayedMessage) error { return nil })
+	if n != 0 || err == nil {
+		t.Errorf("due without redis got %d %v", n, err)
+	}
+}
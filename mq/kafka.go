@@ -5,7 +5,9 @@ import (
 	"errors"
 	"fmt"
 	"github.com/Tokumicn/lego-lib/logs"
+	"github.com/Tokumicn/lego-lib/tracing"
 	"runtime/debug"
+	"sync"
 	"time"
 
 	"github.com/Shopify/sarama"
@@ -14,6 +16,7 @@ import (
 // KafkaConsumer kafka消费者结构
 type KafkaConsumer struct {
 	client sarama.ConsumerGroup
+	group  string
 	topics map[string]string
 }
 
@@ -23,6 +26,9 @@ func NewKafkaConsumer(conf *Config) (*KafkaConsumer, error) {
 	config.Version = sarama.V2_3_0_0
 	config.Consumer.Offsets.Initial = sarama.OffsetNewest
 	config.Consumer.Return.Errors = true
+	if conf.ReadCommitted {
+		config.Consumer.IsolationLevel = sarama.ReadCommitted
+	}
 	config.ChannelBufferSize = 128
 
 	client, err := sarama.NewConsumerGroup(conf.Endpoints, conf.Group, config)
@@ -32,6 +38,7 @@ func NewKafkaConsumer(conf *Config) (*KafkaConsumer, error) {
 
 	consumer := &KafkaConsumer{
 		client: client,
+		group:  conf.Group,
 		topics: make(map[string]string),
 	}
 
@@ -43,6 +50,19 @@ func NewKafkaConsumer(conf *Config) (*KafkaConsumer, error) {
 
 // Recv 消费消息 设置回调函数
 func (c *KafkaConsumer) Recv(name string, callback CallbackHandler) error {
+	return c.recv(name, callback, nil)
+}
+
+// RecvTransactional 在producer的事务内消费消息 回调中通过producer发送的消息与消费位点一同提交
+// 回调返回错误时事务回滚 该消息位点不提交
+func (c *KafkaConsumer) RecvTransactional(name string, producer *KafkaTransactionalProducer, callback CallbackHandler) error {
+	if producer == nil {
+		return errors.New("kafka consume transactional producer nil")
+	}
+	return c.recv(name, callback, producer)
+}
+
+func (c *KafkaConsumer) recv(name string, callback CallbackHandler, producer *KafkaTransactionalProducer) error {
 	topic, ok := c.topics[name]
 	if !ok {
 		return errors.New("kafka consume find topic failed")
@@ -60,6 +80,8 @@ func (c *KafkaConsumer) Recv(name string, callback CallbackHandler) error {
 					TopicName:       name,
 					CallbackHandler: callback,
 					ConsumerGroup:   c.client,
+					Group:           c.group,
+					Producer:        producer,
 				}); err != nil {
 					fmt.Printf("kafka consume invoke err:%v", err)
 				}
@@ -83,6 +105,7 @@ func (c *KafkaConsumer) Close() error {
 type KafkaSyncProducer struct {
 	client sarama.SyncProducer
 	topics map[string]string
+	delay  delayer
 }
 
 // NewKafkaSyncProducer 创建KafkaSyncProducer
@@ -92,6 +115,11 @@ func NewKafkaSyncProducer(conf *Config) (*KafkaSyncProducer, error) {
 	config.Producer.Return.Successes = true
 	config.Producer.Return.Errors = true
 
+	tiers, err := newDelayTiers(conf.Delay)
+	if err != nil {
+		return nil, err
+	}
+
 	client, err := sarama.NewSyncProducer(conf.Endpoints, config)
 	if err != nil {
 		return nil, err
@@ -100,6 +128,7 @@ func NewKafkaSyncProducer(conf *Config) (*KafkaSyncProducer, error) {
 	producer := &KafkaSyncProducer{
 		client: client,
 		topics: make(map[string]string),
+		delay:  delayer{tiers: tiers},
 	}
 
 	for _, tc := range conf.Topics {
@@ -120,18 +149,44 @@ func (p *KafkaSyncProducer) Send(ctx context.Context, name string, msg *Message)
 		return errors.New("kafka sync find topic failed")
 	}
 
-	message := &sarama.ProducerMessage{
-		Topic: topic,
-		Value: sarama.ByteEncoder(msg.Value),
+	ctx, span := tracing.StartSpan(ctx, "kafka send "+topic, tracing.KindProducer)
+	defer span.End()
+
+	message := newProducerMessage(topic, withTraceHeaders(ctx, msg))
+
+	_, _, err := p.client.SendMessage(message)
+	span.SetError(err)
+	return err
+}
+
+// SendDelayed 同步发送延时消息
+func (p *KafkaSyncProducer) SendDelayed(ctx context.Context, name string, msg *Message, delay time.Duration) error {
+	if delay <= 0 {
+		return p.Send(ctx, name, msg)
 	}
-	if len(msg.Key) != 0 {
-		message.Key = sarama.ByteEncoder(msg.Key)
+	if p.client == nil {
+		return errors.New("kafka sync broker client nil")
 	}
 
-	_, _, err := p.client.SendMessage(message)
+	topic, ok := p.topics[name]
+	if !ok {
+		return errors.New("kafka sync find topic failed")
+	}
+
+	message, err := p.delay.route(ctx, topic, withTraceHeaders(ctx, msg), delay)
+	if err != nil || message == nil {
+		return err
+	}
+
+	_, _, err = p.client.SendMessage(message)
 	return err
 }
 
+// SetDelayStore 延时消息改为写入store 由KafkaDelayRepublisher轮询投递
+func (p *KafkaSyncProducer) SetDelayStore(store DelayStore) {
+	p.delay.store = store
+}
+
 // Close 关闭同步生产者
 func (p *KafkaSyncProducer) Close() error {
 	return p.client.Close()
@@ -141,6 +196,7 @@ func (p *KafkaSyncProducer) Close() error {
 type KafkaAsyncProducer struct {
 	client sarama.AsyncProducer
 	topics map[string]string
+	delay  delayer
 }
 
 // NewKafkaAsyncProducer 创建KafkaAsyncProducer
@@ -150,6 +206,11 @@ func NewKafkaAsyncProducer(conf Config) (*KafkaAsyncProducer, error) {
 	config.Producer.Compression = sarama.CompressionSnappy
 	config.Producer.Flush.Frequency = 500 * time.Millisecond
 
+	tiers, err := newDelayTiers(conf.Delay)
+	if err != nil {
+		return nil, err
+	}
+
 	client, err := sarama.NewAsyncProducer(conf.Endpoints, config)
 	if err != nil {
 		return nil, err
@@ -158,6 +219,7 @@ func NewKafkaAsyncProducer(conf Config) (*KafkaAsyncProducer, error) {
 	producer := &KafkaAsyncProducer{
 		client: client,
 		topics: make(map[string]string),
+		delay:  delayer{tiers: tiers},
 	}
 
 	for _, tc := range conf.Topics {
@@ -179,18 +241,43 @@ func (p *KafkaAsyncProducer) Send(ctx context.Context, name string, msg *Message
 		return errors.New("kafka async find topic failed")
 	}
 
-	message := &sarama.ProducerMessage{
-		Topic: topic,
-		Value: sarama.ByteEncoder(msg.Value),
+	ctx, span := tracing.StartSpan(ctx, "kafka send "+topic, tracing.KindProducer)
+	defer span.End()
+
+	message := newProducerMessage(topic, withTraceHeaders(ctx, msg))
+
+	p.client.Input() <- message
+	return nil
+}
+
+// SendDelayed 异步发送延时消息
+func (p *KafkaAsyncProducer) SendDelayed(ctx context.Context, name string, msg *Message, delay time.Duration) error {
+	if delay <= 0 {
+		return p.Send(ctx, name, msg)
 	}
-	if len(msg.Key) != 0 {
-		message.Key = sarama.ByteEncoder(msg.Key)
+	if p.client == nil {
+		return errors.New("kafka async broker client nil")
+	}
+
+	topic, ok := p.topics[name]
+	if !ok {
+		return errors.New("kafka async find topic failed")
+	}
+
+	message, err := p.delay.route(ctx, topic, withTraceHeaders(ctx, msg), delay)
+	if err != nil || message == nil {
+		return err
 	}
 
 	p.client.Input() <- message
 	return nil
 }
 
+// SetDelayStore 延时消息改为写入store 由KafkaDelayRepublisher轮询投递
+func (p *KafkaAsyncProducer) SetDelayStore(store DelayStore) {
+	p.delay.store = store
+}
+
 // Close 关闭异步生产者
 func (p *KafkaAsyncProducer) Close() error {
 	return p.client.Close()
@@ -206,11 +293,145 @@ func (p *KafkaAsyncProducer) asyncRecvErrors() {
 	}
 }
 
+// KafkaTransactionalProducer kafka事务生产者结构
+type KafkaTransactionalProducer struct {
+	client sarama.SyncProducer
+	topics map[string]string
+	// 事务状态属于生产者 多个分区并发消费时需串行使用
+	mu sync.Mutex
+}
+
+// NewKafkaTransactionalProducer 创建KafkaTransactionalProducer
+func NewKafkaTransactionalProducer(conf *Config) (*KafkaTransactionalProducer, error) {
+	if conf.TransactionID == "" {
+		return nil, errors.New("kafka transactional producer transaction_id empty")
+	}
+
+	config := sarama.NewConfig()
+	config.Version = sarama.V2_3_0_0
+	config.Producer.Idempotent = true
+	config.Producer.Transaction.ID = conf.TransactionID
+	config.Producer.RequiredAcks = sarama.WaitForAll
+	config.Producer.Return.Successes = true
+	config.Producer.Return.Errors = true
+	config.Net.MaxOpenRequests = 1
+
+	client, err := sarama.NewSyncProducer(conf.Endpoints, config)
+	if err != nil {
+		return nil, err
+	}
+
+	producer := &KafkaTransactionalProducer{
+		client: client,
+		topics: make(map[string]string),
+	}
+
+	for _, tc := range conf.Topics {
+		producer.topics[tc.Name] = tc.Topic
+	}
+
+	return producer, nil
+}
+
+// Begin 开启事务
+func (p *KafkaTransactionalProducer) Begin() error {
+	return p.client.BeginTxn()
+}
+
+// Send 在事务内发送消息 事务提交后对消费者可见
+func (p *KafkaTransactionalProducer) Send(ctx context.Context, name string, msg *Message) error {
+	if p.client == nil {
+		return errors.New("kafka transactional broker client nil")
+	}
+
+	topic, ok := p.topics[name]
+	if !ok {
+		return errors.New("kafka transactional find topic failed")
+	}
+
+	ctx, span := tracing.StartSpan(ctx, "kafka send "+topic, tracing.KindProducer)
+	defer span.End()
+
+	message := newProducerMessage(topic, withTraceHeaders(ctx, msg))
+
+	_, _, err := p.client.SendMessage(message)
+	span.SetError(err)
+	return err
+}
+
+// SendOffsets 将消费组的消费位点加入当前事务
+func (p *KafkaTransactionalProducer) SendOffsets(group string, offsets []Offset) error {
+	metas := make(map[string][]*sarama.PartitionOffsetMetadata)
+	for _, o := range offsets {
+		metas[o.Topic] = append(metas[o.Topic], &sarama.PartitionOffsetMetadata{
+			Partition: o.Partition,
+			Offset:    o.Offset,
+		})
+	}
+	return p.client.AddOffsetsToTxn(metas, group)
+}
+
+// Commit 提交事务
+func (p *KafkaTransactionalProducer) Commit() error {
+	return p.client.CommitTxn()
+}
+
+// Abort 回滚事务
+func (p *KafkaTransactionalProducer) Abort() error {
+	return p.client.AbortTxn()
+}
+
+// Close 关闭事务生产者
+func (p *KafkaTransactionalProducer) Close() error {
+	return p.client.Close()
+}
+
+// consume 在一个事务内执行回调并提交消息位点 回调panic时回滚事务后继续panic
+func (p *KafkaTransactionalProducer) consume(group string, msg *sarama.ConsumerMessage, fn func() error) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if err := p.Begin(); err != nil {
+		return err
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			if abortErr := p.Abort(); abortErr != nil {
+				logs.Errorf("kafka transactional abort after panic err:%v", abortErr)
+			}
+			panic(r)
+		}
+	}()
+
+	err := fn()
+	if err == nil {
+		err = p.SendOffsets(group, []Offset{{Topic: msg.Topic, Partition: msg.Partition, Offset: msg.Offset + 1}})
+	}
+	if err == nil {
+		err = p.Commit()
+	}
+	if err == nil {
+		return nil
+	}
+
+	if p.client.TxnStatus()&sarama.ProducerTxnFlagFatalError != 0 {
+		return fmt.Errorf("kafka transactional fatal err:%v", err)
+	}
+	if abortErr := p.Abort(); abortErr != nil {
+		return fmt.Errorf("kafka transactional abort err:%v cause:%v", abortErr, err)
+	}
+	return err
+}
+
 // GroupHandler 回调封装 sarama约定
 type GroupHandler struct {
 	TopicName       string
 	CallbackHandler CallbackHandler
 	ConsumerGroup   sarama.ConsumerGroup
+	// Group 消费组名称 Producer非空时用于提交事务位点
+	Group string
+	// Producer 非空时回调在事务内执行 位点随事务提交
+	Producer *KafkaTransactionalProducer
 }
 
 // Setup ...
@@ -227,16 +448,51 @@ func (*GroupHandler) Cleanup(sarama.ConsumerGroupSession) error {
 func (g *GroupHandler) ConsumeClaim(sess sarama.ConsumerGroupSession, claim sarama.ConsumerGroupClaim) error {
 	defer doRecover()
 	for msg := range claim.Messages() {
-		if err := g.CallbackHandler(context.TODO(), &KafkaEvent{
-			Topic:   msg.Topic,
-			Message: Message{Tag: getMessageTag(msg.Headers), Key: string(msg.Key), Value: msg.Value},
-		}); err == nil {
+		event := &KafkaEvent{
+			Topic:     msg.Topic,
+			Partition: msg.Partition,
+			Offset:    msg.Offset,
+			Message: Message{
+				Tag:     getMessageTag(msg.Headers),
+				Key:     string(msg.Key),
+				Value:   msg.Value,
+				Headers: getMessageHeaders(msg.Headers),
+			},
+		}
+
+		if g.Producer != nil {
+			if err := g.Producer.consume(g.Group, msg, func() error {
+				return g.callback(event)
+			}); err != nil {
+				logs.Errorf("kafka transactional consume topic:%s partition:%d offset:%d err:%v",
+					msg.Topic, msg.Partition, msg.Offset, err)
+				// 后续消息提交的位点会越过失败消息 回退位点并结束本次claim 重平衡后从失败消息重新消费
+				sess.ResetOffset(msg.Topic, msg.Partition, msg.Offset, "")
+				return err
+			}
+			continue
+		}
+
+		if err := g.callback(event); err == nil {
 			sess.MarkMessage(msg, "")
 		}
 	}
 	return nil
 }
 
+// callback 从消息头提取上游链路 在consumer span内执行回调
+func (g *GroupHandler) callback(event *KafkaEvent) error {
+	ctx := tracing.Extract(context.Background(), func(key string) string {
+		return event.Message.Headers[key]
+	})
+	ctx, span := tracing.StartSpan(ctx, "kafka consume "+event.Topic, tracing.KindConsumer)
+	defer span.End()
+
+	err := g.CallbackHandler(ctx, event)
+	span.SetError(err)
+	return err
+}
+
 func doRecover() {
 	if r := recover(); r != nil {
 		logs.Errorf("[PANIC] time:%d err:%v stack", time.Now(), r, string(debug.Stack()))
@@ -245,8 +501,10 @@ func doRecover() {
 
 // KafkaEvent kafka消息事件
 type KafkaEvent struct {
-	Topic   string
-	Message Message
+	Topic     string
+	Partition int32
+	Offset    int64
+	Message   Message
 }
 
 // GetTopic 获取事件对应的Topic
@@ -259,6 +517,45 @@ func (k *KafkaEvent) GetMessage() Message {
 	return k.Message
 }
 
+func newProducerMessage(topic string, msg *Message) *sarama.ProducerMessage {
+	message := &sarama.ProducerMessage{
+		Topic: topic,
+		Value: sarama.ByteEncoder(msg.Value),
+	}
+	if len(msg.Key) != 0 {
+		message.Key = sarama.ByteEncoder(msg.Key)
+	}
+	for k, v := range msg.Headers {
+		message.Headers = append(message.Headers, sarama.RecordHeader{Key: []byte(k), Value: []byte(v)})
+	}
+	return message
+}
+
+// withTraceHeaders ctx中有链路信息时返回带traceparent消息头的msg副本
+func withTraceHeaders(ctx context.Context, msg *Message) *Message {
+	traced := *msg
+	tracing.Inject(ctx, func(key, value string) {
+		headers := make(map[string]string, len(msg.Headers)+1)
+		for k, v := range msg.Headers {
+			headers[k] = v
+		}
+		headers[key] = value
+		traced.Headers = headers
+	})
+	return &traced
+}
+
+func getMessageHeaders(headers []*sarama.RecordHeader) map[string]string {
+	if len(headers) == 0 {
+		return nil
+	}
+	result := make(map[string]string, len(headers))
+	for _, header := range headers {
+		result[string(header.Key)] = string(header.Value)
+	}
+	return result
+}
+
 func getMessageTag(headers []*sarama.RecordHeader) string {
 	for _, header := range headers {
 		if string(header.Key) == "TAGS" {
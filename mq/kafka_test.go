@@ -0,0 +1,114 @@
+package mq
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/Shopify/sarama"
+	"github.com/Shopify/sarama/mocks"
+
+	"github.com/Tokumicn/lego-lib/logs"
+)
+
+type fakeSession struct {
+	sarama.ConsumerGroupSession
+	reset int64
+}
+
+func (s *fakeSession) ResetOffset(topic string, partition int32, offset int64, metadata string) {
+	s.reset = offset
+}
+
+type fakeClaim struct {
+	sarama.ConsumerGroupClaim
+	messages chan *sarama.ConsumerMessage
+}
+
+func (c *fakeClaim) Messages() <-chan *sarama.ConsumerMessage {
+	return c.messages
+}
+
+func newMockTransactionalProducer(t *testing.T) *KafkaTransactionalProducer {
+	config := mocks.NewTestConfig()
+	config.Version = sarama.V2_3_0_0
+	config.Producer.Transaction.ID = "test"
+	config.Producer.RequiredAcks = sarama.WaitForAll
+	config.Producer.Idempotent = true
+	config.Net.MaxOpenRequests = 1
+	return &KafkaTransactionalProducer{client: mocks.NewSyncProducer(t, config), topics: map[string]string{}}
+}
+
+// TestTransactionalConsumeRedeliver 回调失败后从失败消息重新消费 后续消息不越过它提交位点
+func TestTransactionalConsumeRedeliver(t *testing.T) {
+	logs.Init(&logs.Config{Writer: "console", Level: "error"})
+	producer := newMockTransactionalProducer(t)
+
+	var delivered []int64
+	failed := false
+	handler := &GroupHandler{
+		Group:    "group",
+		Producer: producer,
+		CallbackHandler: func(ctx context.Context, event Event) error {
+			offset := event.(*KafkaEvent).Offset
+			delivered = append(delivered, offset)
+			if offset == 1 && !failed {
+				failed = true
+				return errors.New("callback failed")
+			}
+			return nil
+		},
+	}
+
+	// 模拟重平衡 每次从上次回退的位点开始分配消息
+	offset := int64(0)
+	for round := 0; round < 2; round++ {
+		claim := &fakeClaim{messages: make(chan *sarama.ConsumerMessage, 3)}
+		for o := offset; o < 3; o++ {
+			claim.messages <- &sarama.ConsumerMessage{Topic: "topic", Offset: o}
+		}
+		close(claim.messages)
+
+		sess := &fakeSession{reset: -1}
+		err := handler.ConsumeClaim(sess, claim)
+		if round == 0 && (err == nil || sess.reset != 1) {
+			t.Fatalf("round 0 err:%v reset:%d, want error and reset to 1", err, sess.reset)
+		}
+		if round == 1 && err != nil {
+			t.Fatal(err)
+		}
+		offset = sess.reset
+	}
+
+	want := []int64{0, 1, 1, 2}
+	if len(delivered) != len(want) {
+		t.Fatalf("delivered %v, want %v", delivered, want)
+	}
+	for i := range want {
+		if delivered[i] != want[i] {
+			t.Fatalf("delivered %v, want %v", delivered, want)
+		}
+	}
+}
+
+// TestTransactionalConsumePanic 回调panic时回滚事务 后续消息可以开启新事务
+func TestTransactionalConsumePanic(t *testing.T) {
+	logs.Init(&logs.Config{Writer: "console", Level: "error"})
+	producer := newMockTransactionalProducer(t)
+	handler := &GroupHandler{
+		Group:    "group",
+		Producer: producer,
+		CallbackHandler: func(ctx context.Context, event Event) error {
+			panic("callback panic")
+		},
+	}
+
+	claim := &fakeClaim{messages: make(chan *sarama.ConsumerMessage, 1)}
+	claim.messages <- &sarama.ConsumerMessage{Topic: "topic"}
+	close(claim.messages)
+	handler.ConsumeClaim(&fakeSession{reset: -1}, claim)
+
+	if status := producer.client.TxnStatus(); status&sarama.ProducerTxnFlagInTransaction != 0 {
+		t.Fatalf("transaction left open, status %v", status)
+	}
+}
@@ -0,0 +1,262 @@
+package mq
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sync"
+)
+
+// schema帧头格式与confluent schema-registry一致: 1字节magic(0) + 4字节大端schema ID
+const (
+	magicByte  byte = 0
+	frameBytes      = 5
+)
+
+// Schema 注册的消息格式
+type Schema struct {
+	ID         int    `json:"id"`
+	Subject    string `json:"subject"`
+	Version    int    `json:"version"`
+	Format     string `json:"format"`
+	Definition string `json:"definition"`
+}
+
+// SchemaRegistry schema注册中心接口
+type SchemaRegistry interface {
+	// Register 注册subject下的schema 定义已存在时返回已有schema
+	Register(subject, format, definition string) (*Schema, error)
+	// GetByID 按ID获取schema
+	GetByID(id int) (*Schema, error)
+	// Latest 获取subject的最新版本
+	Latest(subject string) (*Schema, error)
+}
+
+var (
+	registryMu            sync.RWMutex
+	defaultSchemaRegistry SchemaRegistry
+)
+
+// UseSchemaRegistry 设置Decode校验帧头schema ID时使用的注册中心 可与Decode并发调用
+// registry为nil时Decode不识别帧头
+func UseSchemaRegistry(registry SchemaRegistry) {
+	registryMu.Lock()
+	defaultSchemaRegistry = registry
+	registryMu.Unlock()
+}
+
+func schemaRegistry() SchemaRegistry {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	return defaultSchemaRegistry
+}
+
+func frame(id int, payload []byte) []byte {
+	buf := make([]byte, frameBytes+len(payload))
+	buf[0] = magicByte
+	binary.BigEndian.PutUint32(buf[1:frameBytes], uint32(id))
+	copy(buf[frameBytes:], payload)
+	return buf
+}
+
+// unframe json与protobuf编码结果均不会以0字节开头 以此识别帧头 仅在设置注册中心时使用
+func unframe(value []byte) (id int, payload []byte, ok bool) {
+	if len(value) < frameBytes || value[0] != magicByte {
+		return 0, value, false
+	}
+	return int(binary.BigEndian.Uint32(value[1:frameBytes])), value[frameBytes:], true
+}
+
+// SchemaEncoder 按已注册schema编码消息 消息体带schema帧头
+type SchemaEncoder struct {
+	schema *Schema
+}
+
+// NewSchemaEncoder 在registry中注册schema并创建SchemaEncoder
+func NewSchemaEncoder(registry SchemaRegistry, subject, format, definition string) (*SchemaEncoder, error) {
+	if _, err := GetSerializer(format); err != nil {
+		return nil, err
+	}
+
+	schema, err := registry.Register(subject, format, definition)
+	if err != nil {
+		return nil, err
+	}
+	return &SchemaEncoder{schema: schema}, nil
+}
+
+// Schema 返回编码使用的schema
+func (e *SchemaEncoder) Schema() *Schema {
+	return e.schema
+}
+
+// NewMessage 编码v并加上schema帧头
+func (e *SchemaEncoder) NewMessage(key string, v interface{}) (*Message, error) {
+	msg, err := NewMessage(e.schema.Format, key, v)
+	if err != nil {
+		return nil, err
+	}
+	msg.Value = frame(e.schema.ID, msg.Value)
+	return msg, nil
+}
+
+// CompatibilityChecker 校验同一subject新版本schema能否替换旧版本
+type CompatibilityChecker func(prev, next *Schema) error
+
+// BackwardCompatibleJSON json格式的默认兼容性校验
+// 新版本不能新增required字段 保证新版本消费者能读取旧版本消息
+func BackwardCompatibleJSON(prev, next *Schema) error {
+	if prev.Format != FormatJSON || next.Format != FormatJSON {
+		return nil
+	}
+
+	var p, n struct {
+		Required []string `json:"required"`
+	}
+	if err := json.Unmarshal([]byte(prev.Definition), &p); err != nil {
+		return err
+	}
+	if err := json.Unmarshal([]byte(next.Definition), &n); err != nil {
+		return err
+	}
+
+	old := make(map[string]bool, len(p.Required))
+	for _, field := range p.Required {
+		old[field] = true
+	}
+	for _, field := range n.Required {
+		if !old[field] {
+			return fmt.Errorf("mq: schema %s adds required field %q", next.Subject, field)
+		}
+	}
+	return nil
+}
+
+// FileSchemaRegistry 本地文件实现的SchemaRegistry 所有schema以json数组保存在一个文件中
+type FileSchemaRegistry struct {
+	path       string
+	compatible CompatibilityChecker
+
+	mu      sync.RWMutex
+	schemas []*Schema
+}
+
+// NewFileSchemaRegistry 加载path中的schema 文件不存在时在首次注册时创建
+// compatible为nil时使用BackwardCompatibleJSON
+func NewFileSchemaRegistry(path string, compatible CompatibilityChecker) (*FileSchemaRegistry, error) {
+	if compatible == nil {
+		compatible = BackwardCompatibleJSON
+	}
+	registry := &FileSchemaRegistry{
+		path:       path,
+		compatible: compatible,
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return registry, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(data) == 0 {
+		return registry, nil
+	}
+	if err := json.Unmarshal(data, &registry.schemas); err != nil {
+		return nil, err
+	}
+	return registry, nil
+}
+
+// Register 注册schema 与最新版本不兼容时返回错误
+func (r *FileSchemaRegistry) Register(subject, format, definition string) (*Schema, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var (
+		latest *Schema
+		maxID  int
+	)
+	for _, s := range r.schemas {
+		if s.ID > maxID {
+			maxID = s.ID
+		}
+		if s.Subject != subject {
+			continue
+		}
+		if s.Format == format && s.Definition == definition {
+			return s, nil
+		}
+		if latest == nil || s.Version > latest.Version {
+			latest = s
+		}
+	}
+
+	schema := &Schema{
+		ID:         maxID + 1,
+		Subject:    subject,
+		Version:    1,
+		Format:     format,
+		Definition: definition,
+	}
+	if latest != nil {
+		if err := r.compatible(latest, schema); err != nil {
+			return nil, err
+		}
+		schema.Version = latest.Version + 1
+	}
+
+	schemas := append(r.schemas, schema)
+	if err := r.save(schemas); err != nil {
+		return nil, err
+	}
+	r.schemas = schemas
+	return schema, nil
+}
+
+// GetByID 按ID获取schema
+func (r *FileSchemaRegistry) GetByID(id int) (*Schema, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for _, s := range r.schemas {
+		if s.ID == id {
+			return s, nil
+		}
+	}
+	return nil, fmt.Errorf("mq: schema id %d not found", id)
+}
+
+// Latest 获取subject的最新版本
+func (r *FileSchemaRegistry) Latest(subject string) (*Schema, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var latest *Schema
+	for _, s := range r.schemas {
+		if s.Subject == subject && (latest == nil || s.Version > latest.Version) {
+			latest = s
+		}
+	}
+	if latest == nil {
+		return nil, errors.New("mq: schema subject not found " + subject)
+	}
+	return latest, nil
+}
+
+// save 先写临时文件再rename 避免写入中途失败破坏已有文件
+func (r *FileSchemaRegistry) save(schemas []*Schema) error {
+	data, err := json.MarshalIndent(schemas, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp := r.path + ".tmp"
+	if err := ioutil.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, r.path)
+}
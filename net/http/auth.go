@@ -0,0 +1,346 @@
+package http
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/sync/singleflight"
+
+	"github.com/Tokumicn/lego-lib/utils/crypto"
+)
+
+// BasicAuth 为请求设置Basic认证头
+func BasicAuth(username, password string) Handler {
+	return func(m Middleware) {
+		m.GetRequest().SetBasicAuth(username, password)
+		m.Next()
+	}
+}
+
+// BearerToken 为请求设置Bearer认证头
+func BearerToken(token string) Handler {
+	return func(m Middleware) {
+		m.GetRequest().Header.Set("Authorization", "Bearer "+token)
+		m.Next()
+	}
+}
+
+// SignConfig HMAC签名配置
+type SignConfig struct {
+	AppKey    string           `toml:"app_key"`
+	Secret    string           `toml:"secret"`
+	Algorithm crypto.Algorithm `toml:"algorithm"` // 默认sha256
+
+	// 请求头名称 为空时使用X-App-Key X-Timestamp X-Nonce X-Signature
+	AppKeyHeader    string `toml:"app_key_header"`
+	TimestampHeader string `toml:"timestamp_header"`
+	NonceHeader     string `toml:"nonce_header"`
+	SignatureHeader string `toml:"signature_header"`
+}
+
+func (conf *SignConfig) defaults() {
+	if conf.Algorithm == "" {
+		conf.Algorithm = crypto.SHA256
+	}
+	if conf.AppKeyHeader == "" {
+		conf.AppKeyHeader = "X-App-Key"
+	}
+	if conf.TimestampHeader == "" {
+		conf.TimestampHeader = "X-Timestamp"
+	}
+	if conf.NonceHeader == "" {
+		conf.NonceHeader = "X-Nonce"
+	}
+	if conf.SignatureHeader == "" {
+		conf.SignatureHeader = "X-Signature"
+	}
+}
+
+// ErrUnsignableBody 请求体不可重复读取或为流式请求体 无法计算签名
+var ErrUnsignableBody = errors.New("http: request body cannot be signed, it must be replayable and not streamed")
+
+// CanonicalString 待签名字符串 按行拼接method path 按key排序的参数 请求体哈希 时间戳与nonce
+// 服务端使用相同的规则校验签名 method为空时按GET处理
+func CanonicalString(method, path string, params url.Values, bodyHash, timestamp, nonce string) string {
+	if method == "" {
+		method = http.MethodGet
+	}
+	if path == "" {
+		path = "/"
+	}
+	return strings.Join([]string{strings.ToUpper(method), path, params.Encode(), bodyHash, timestamp, nonce}, "\n")
+}
+
+// BodyHash 请求体的十六进制SHA-256 没有请求体时为空内容的哈希
+func BodyHash(body []byte) string {
+	sum := sha256.Sum256(body)
+	return hex.EncodeToString(sum[:])
+}
+
+// Sign 计算签名 params为查询参数与表单参数 bodyHash为BodyHash(请求体)
+func Sign(conf SignConfig, method, path string, params url.Values, bodyHash, timestamp, nonce string) (string, error) {
+	conf.defaults()
+	return crypto.HmacWith(conf.Algorithm, conf.Secret, CanonicalString(method, path, params, bodyHash, timestamp, nonce))
+}
+
+// SignRequest 返回HMAC签名middleware 参与签名的参数为查询参数
+// 以及application/x-www-form-urlencoded请求的表单参数 请求体以SHA-256哈希参与签名
+// 请求体需可重复读取 multipart与SetCompressedBody的流式请求体返回ErrUnsignableBody
+// 每次重试与对冲请求使用新的时间戳与nonce重新签名
+func SignRequest(conf SignConfig) Handler {
+	conf.defaults()
+	if _, err := conf.Algorithm.New(); err != nil {
+		panic(err)
+	}
+
+	return func(m Middleware) {
+		req := m.GetRequest()
+		body, err := signBody(req)
+		if err != nil {
+			m.Stop(err)
+			return
+		}
+		params, err := signParams(req, body)
+		if err != nil {
+			m.Stop(err)
+			return
+		}
+
+		bodyHash := BodyHash(body)
+		m.onAttempt(func(req *http.Request) error {
+			timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+			nonce := newNonce()
+			signature, err := Sign(conf, req.Method, req.URL.EscapedPath(), params, bodyHash, timestamp, nonce)
+			if err != nil {
+				return err
+			}
+
+			req.Header.Set(conf.AppKeyHeader, conf.AppKey)
+			req.Header.Set(conf.TimestampHeader, timestamp)
+			req.Header.Set(conf.NonceHeader, nonce)
+			req.Header.Set(conf.SignatureHeader, signature)
+			return nil
+		})
+		m.Next()
+	}
+}
+
+// signBody 通过GetBody读取请求体 不影响发送
+func signBody(req *http.Request) ([]byte, error) {
+	if req.Body == nil || req.Body == http.NoBody {
+		return nil, nil
+	}
+	if req.GetBody == nil || req.ContentLength < 0 {
+		return nil, ErrUnsignableBody
+	}
+
+	body, err := req.GetBody()
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+	return ioutil.ReadAll(body)
+}
+
+// signParams 合并查询参数与表单参数
+func signParams(req *http.Request, body []byte) (url.Values, error) {
+	params := req.URL.Query()
+	if !strings.HasPrefix(req.Header.Get("Content-Type"), "application/x-www-form-urlencoded") {
+		return params, nil
+	}
+
+	form, err := url.ParseQuery(string(body))
+	if err != nil {
+		return nil, err
+	}
+	for key, values := range form {
+		params[key] = append(params[key], values...)
+	}
+	return params, nil
+}
+
+// basicAuth client认证 按RFC 6749先对id与secret做表单编码
+func basicAuth(id, secret string) string {
+	return base64.StdEncoding.EncodeToString([]byte(url.QueryEscape(id) + ":" + url.QueryEscape(secret)))
+}
+
+func newNonce() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// OAuth2Config OAuth2 client credentials配置
+type OAuth2Config struct {
+	TokenURL     string   `toml:"token_url"`
+	ClientID     string   `toml:"client_id"`
+	ClientSecret string   `toml:"client_secret"`
+	Scopes       []string `toml:"scopes"`
+	// ExpiryDelta token在过期前多久刷新 默认10s
+	ExpiryDelta time.Duration `toml:"expiry_delta"`
+	// Client 获取token使用的客户端 默认DefaultClient
+	// token请求不经过本TokenSource的Handler 可以在同一个Client上注册
+	Client *Client `toml:"-"`
+}
+
+// OAuth2Error token接口返回的错误
+type OAuth2Error struct {
+	Code        string `json:"error"`
+	Description string `json:"error_description"`
+	StatusCode  int    `json:"-"`
+}
+
+func (e *OAuth2Error) Error() string {
+	return fmt.Sprintf("oauth2: %d %s %s", e.StatusCode, e.Code, e.Description)
+}
+
+type oauth2Token struct {
+	AccessToken string `json:"access_token"`
+	TokenType   string `json:"token_type"`
+	ExpiresIn   int64  `json:"expires_in"`
+}
+
+// OAuth2TokenSource 获取并缓存client credentials token 并发安全
+type OAuth2TokenSource struct {
+	conf OAuth2Config
+	// group 合并并发的刷新 请求token时不持有mu
+	group singleflight.Group
+
+	mu      sync.Mutex
+	token   string
+	expires time.Time
+}
+
+// tokenRequestKey 标记token请求的context key 值为发起请求的*OAuth2TokenSource
+type tokenRequestKey struct{}
+
+// NewOAuth2TokenSource 创建OAuth2TokenSource
+func NewOAuth2TokenSource(conf OAuth2Config) *OAuth2TokenSource {
+	if conf.ExpiryDelta <= 0 {
+		conf.ExpiryDelta = 10 * time.Second
+	}
+	return &OAuth2TokenSource{conf: conf}
+}
+
+// Token 返回缓存的token 过期或不存在时重新获取 并发的刷新只请求一次
+func (s *OAuth2TokenSource) Token(ctx context.Context) (string, error) {
+	s.mu.Lock()
+	if s.token != "" && (s.expires.IsZero() || time.Now().Before(s.expires)) {
+		token := s.token
+		s.mu.Unlock()
+		return token, nil
+	}
+	s.mu.Unlock()
+
+	v, err, _ := s.group.Do("token", func() (interface{}, error) {
+		token, err := s.fetch(ctx)
+		if err != nil {
+			return "", err
+		}
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		s.token = token.AccessToken
+		s.expires = time.Time{}
+		if token.ExpiresIn > 0 {
+			s.expires = time.Now().Add(time.Duration(token.ExpiresIn)*time.Second - s.conf.ExpiryDelta)
+		}
+		return s.token, nil
+	})
+	if err != nil {
+		return "", err
+	}
+	return v.(string), nil
+}
+
+// Invalidate 丢弃token 仅当缓存的仍是token时生效 避免覆盖已刷新的token
+func (s *OAuth2TokenSource) Invalidate(token string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.token == token {
+		s.token = ""
+	}
+}
+
+func (s *OAuth2TokenSource) fetch(ctx context.Context) (token oauth2Token, err error) {
+	client := s.conf.Client
+	if client == nil {
+		client = DefaultClient
+	}
+
+	form := url.Values{"grant_type": {"client_credentials"}}
+	if len(s.conf.Scopes) > 0 {
+		form.Set("scope", strings.Join(s.conf.Scopes, " "))
+	}
+	ctx = context.WithValue(ctx, tokenRequestKey{}, s)
+	req := client.NewRequest(s.conf.TokenURL).Post().SetContext(ctx).SetForm(form)
+	req.AddHeader("Authorization", "Basic "+basicAuth(s.conf.ClientID, s.conf.ClientSecret))
+	req.AddHeader("Accept", "application/json")
+
+	var oerr OAuth2Error
+	r := req.ToJSONWithError(&token, &oerr)
+	if e, ok := IsHTTPError(r.Error); ok {
+		oerr.StatusCode = e.StatusCode
+		return token, &oerr
+	}
+	if r.Error != nil {
+		return token, r.Error
+	}
+	if token.AccessToken == "" {
+		return token, &OAuth2Error{Code: "invalid_token_response", Description: "empty access_token", StatusCode: r.StatusCode}
+	}
+	return token, nil
+}
+
+// Handler 返回设置Bearer token的middleware 响应401时刷新token并重发一次
+// 请求体不可重复读取时不重发 本TokenSource发出的token请求直接放行
+func (s *OAuth2TokenSource) Handler() Handler {
+	return func(m Middleware) {
+		req := m.GetRequest()
+		if req.Context().Value(tokenRequestKey{}) == s {
+			m.Next()
+			return
+		}
+		token, err := s.Token(req.Context())
+		if err != nil {
+			m.Stop(err)
+			return
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+		m.Next()
+
+		resp, _ := m.GetRespone()
+		if resp == nil || resp.StatusCode != http.StatusUnauthorized {
+			return
+		}
+		if req.Body != nil && req.Body != http.NoBody && req.GetBody == nil {
+			return
+		}
+
+		resp.Body.Close()
+		s.Invalidate(token)
+		if token, err = s.Token(req.Context()); err != nil {
+			m.Stop(err)
+			return
+		}
+		if req.GetBody != nil {
+			if req.Body, err = req.GetBody(); err != nil {
+				m.Stop(err)
+				return
+			}
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+		m.Next()
+	}
+}
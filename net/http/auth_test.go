@@ -0,0 +1,177 @@
+package http
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestSignRequest(t *testing.T) {
+	conf := SignConfig{AppKey: "app", Secret: "secret"}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		if r.URL.Query().Get("tamper") != "" {
+			body = append(body, '!')
+		}
+		r.Body = ioutil.NopCloser(bytes.NewReader(body))
+		r.ParseForm()
+		want, _ := Sign(conf, r.Method, r.URL.EscapedPath(), r.Form, BodyHash(body),
+			r.Header.Get("X-Timestamp"), r.Header.Get("X-Nonce"))
+		if r.Header.Get("X-App-Key") != "app" || r.Header.Get("X-Signature") != want {
+			w.WriteHeader(http.StatusUnauthorized)
+		}
+	}))
+	defer srv.Close()
+
+	client := NewClient()
+	client.Use(SignRequest(conf))
+	r := client.NewRequest(srv.URL+"/orders").Post().SetParam("b", 2).SetParam("a", 1).
+		AddFormField("name", "x").ToJSON(new(interface{}))
+	if r.StatusCode == http.StatusUnauthorized {
+		t.Fatalf("form signature mismatch %v", r.Error)
+	}
+	if _, r = client.NewRequest(srv.URL + "/orders").Post().SetJSONBody(map[string]int{"amount": 1}).ToBytes(); r.Error != nil {
+		t.Fatalf("json signature mismatch %v", r.Error)
+	}
+	// 请求体被改写后签名不再有效
+	_, r = client.NewRequest(srv.URL+"/orders").Post().SetParam("tamper", 1).SetJSONBody(map[string]int{"amount": 1}).ToBytes()
+	if r.StatusCode != http.StatusUnauthorized {
+		t.Errorf("tampered body got %d", r.StatusCode)
+	}
+	if _, r = client.NewRequest(srv.URL).Post().AddFile("file", "a.txt", strings.NewReader("a")).ToBytes(); r.Error != ErrUnsignableBody {
+		t.Errorf("streamed body got %v", r.Error)
+	}
+}
+
+// TestSignRequestRetry 每次重试使用新的nonce
+func TestSignRequestRetry(t *testing.T) {
+	var mu sync.Mutex
+	nonces := map[string]bool{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		nonce := r.Header.Get("X-Nonce")
+		if nonces[nonce] {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		nonces[nonce] = true
+		if len(nonces) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer srv.Close()
+
+	client := NewClient()
+	client.Use(SignRequest(SignConfig{AppKey: "app", Secret: "secret"}))
+	policy := &RetryPolicy{MaxAttempts: 2, BaseDelay: time.Millisecond}
+	if _, r := client.NewRequest(srv.URL).Retry(policy).ToBytes(); r.Error != nil {
+		t.Fatalf("retry got %d %v", r.StatusCode, r.Error)
+	}
+	if len(nonces) != 2 {
+		t.Errorf("nonces %d", len(nonces))
+	}
+}
+
+func TestOAuth2RefreshOn401(t *testing.T) {
+	var issued int32
+	tokenSrv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id, secret, _ := r.BasicAuth()
+		if id != "id" || secret != "secret" || r.FormValue("grant_type") != "client_credentials" {
+			w.WriteHeader(http.StatusUnauthorized)
+			w.Write([]byte(`{"error":"invalid_client"}`))
+			return
+		}
+		n := atomic.AddInt32(&issued, 1)
+		fmt.Fprintf(w, `{"access_token":"token-%d","token_type":"bearer","expires_in":3600}`, n)
+	}))
+	defer tokenSrv.Close()
+
+	// 第一个token已被服务端吊销
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer token-2" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Write([]byte("ok"))
+	}))
+	defer api.Close()
+
+	source := NewOAuth2TokenSource(OAuth2Config{TokenURL: tokenSrv.URL, ClientID: "id", ClientSecret: "secret"})
+	client := NewClient()
+	client.Use(source.Handler())
+
+	for i := 0; i < 2; i++ {
+		body, r := client.NewRequest(api.URL).ToString()
+		if r.Error != nil || body != "ok" {
+			t.Fatalf("got %q %v", body, r.Error)
+		}
+	}
+	if issued != 2 {
+		t.Errorf("issued %d tokens", issued)
+	}
+
+	bad := NewOAuth2TokenSource(OAuth2Config{TokenURL: tokenSrv.URL, ClientID: "id"})
+	if _, err := bad.Token(context.Background()); err == nil {
+		t.Error("expected invalid client")
+	} else if e, ok := err.(*OAuth2Error); !ok || e.Code != "invalid_client" {
+		t.Errorf("got %v", err)
+	}
+}
+
+// TestOAuth2DefaultClient token请求使用注册了Handler的DefaultClient时不死锁
+func TestOAuth2DefaultClient(t *testing.T) {
+	var issued int32
+	tokenSrv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Basic "+basicAuth("id", "secret") {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		n := atomic.AddInt32(&issued, 1)
+		fmt.Fprintf(w, `{"access_token":"token-%d","expires_in":3600}`, n)
+	}))
+	defer tokenSrv.Close()
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.Header.Get("Authorization")))
+	}))
+	defer api.Close()
+
+	defaultClient, defaultH2CClient := DefaultClient, DefaultH2CClient
+	DefaultClient, DefaultH2CClient = NewClient(), NewClient(WithProtocol(H2C))
+	defer func() { DefaultClient, DefaultH2CClient = defaultClient, defaultH2CClient }()
+
+	source := NewOAuth2TokenSource(OAuth2Config{TokenURL: tokenSrv.URL, ClientID: "id", ClientSecret: "secret"})
+	UseMiddleware(source.Handler())
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		var wg sync.WaitGroup
+		for i := 0; i < 5; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				if body, r := NewFastRequest(api.URL).ToString(); r.Error != nil || body != "Bearer token-1" {
+					t.Errorf("got %q %v", body, r.Error)
+				}
+			}()
+		}
+		wg.Wait()
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("token request deadlocked")
+	}
+	if issued != 1 {
+		t.Errorf("issued %d tokens", issued)
+	}
+}
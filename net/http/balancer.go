@@ -0,0 +1,309 @@
+package http
+
+import (
+	"context"
+	"errors"
+	"hash/crc32"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ServiceScheme 通过服务发现访问的URL协议 svc://orders/v1/list
+const ServiceScheme = "svc"
+
+// ErrNoEndpoint 服务没有可用实例
+var ErrNoEndpoint = errors.New("http: no endpoint available")
+
+// ErrNoDiscovery 请求svc://地址但Client未设置Discovery
+var ErrNoDiscovery = errors.New("http: svc:// requires a Discovery, see WithDiscovery")
+
+// Strategy 负载均衡策略
+type Strategy int
+
+const (
+	// RoundRobin 轮询
+	RoundRobin Strategy = iota
+	// Weighted 按Endpoint.Weight平滑加权轮询
+	Weighted
+	// LeastInflight 选择进行中请求最少的实例
+	LeastInflight
+	// ConsistentHash 按Request.BalanceKey一致性哈希 未设置key时使用请求URL
+	ConsistentHash
+)
+
+// OutlierConfig 被动异常实例摘除
+type OutlierConfig struct {
+	// ConsecutiveFailures 连续失败次数达到后摘除 默认5 传输错误与5xx为失败
+	ConsecutiveFailures int
+	// EjectDuration 摘除时长 默认30s
+	EjectDuration time.Duration
+	// MaxEjectionPercent 最多摘除的实例比例 默认50
+	MaxEjectionPercent int
+}
+
+type discoveryOptions struct {
+	strategy Strategy
+	refresh  time.Duration
+	outlier  OutlierConfig
+	replicas int
+}
+
+// DiscoveryOption Discovery构造选项
+type DiscoveryOption func(*discoveryOptions)
+
+// WithStrategy 设置负载均衡策略 默认RoundRobin
+func WithStrategy(strategy Strategy) DiscoveryOption {
+	return func(o *discoveryOptions) {
+		o.strategy = strategy
+	}
+}
+
+// WithRefreshInterval 设置重新解析服务实例的间隔 默认10s
+func WithRefreshInterval(interval time.Duration) DiscoveryOption {
+	return func(o *discoveryOptions) {
+		o.refresh = interval
+	}
+}
+
+// WithOutlier 设置异常实例摘除
+func WithOutlier(conf OutlierConfig) DiscoveryOption {
+	return func(o *discoveryOptions) {
+		o.outlier = conf
+	}
+}
+
+// Discovery 服务发现与负载均衡 并发安全
+type Discovery struct {
+	resolver Resolver
+	opts     discoveryOptions
+
+	mu       sync.Mutex
+	services map[string]*service
+}
+
+// NewDiscovery 创建Discovery
+func NewDiscovery(resolver Resolver, opts ...DiscoveryOption) *Discovery {
+	o := discoveryOptions{
+		strategy: RoundRobin,
+		refresh:  10 * time.Second,
+		replicas: 100,
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if o.outlier.ConsecutiveFailures <= 0 {
+		o.outlier.ConsecutiveFailures = 5
+	}
+	if o.outlier.EjectDuration <= 0 {
+		o.outlier.EjectDuration = 30 * time.Second
+	}
+	if o.outlier.MaxEjectionPercent <= 0 {
+		o.outlier.MaxEjectionPercent = 50
+	}
+	return &Discovery{
+		resolver: resolver,
+		opts:     o,
+		services: make(map[string]*service),
+	}
+}
+
+// Pick 为service选择实例 done在请求结束后调用 用于统计进行中请求与异常摘除
+func (d *Discovery) Pick(ctx context.Context, name, key string) (ep Endpoint, done func(resp *http.Response, err error), err error) {
+	svc, err := d.service(ctx, name)
+	if err != nil {
+		return
+	}
+	e := svc.pick(d.opts.strategy, key, time.Now())
+	if e == nil {
+		err = ErrNoEndpoint
+		return
+	}
+	atomic.AddInt64(&e.inflight, 1)
+	done = func(resp *http.Response, err error) {
+		atomic.AddInt64(&e.inflight, -1)
+		failure := err != nil && resp == nil || resp != nil && resp.StatusCode >= 500
+		svc.report(e, failure, d.opts.outlier, time.Now())
+	}
+	return e.Endpoint, done, nil
+}
+
+// service 返回服务状态 超过刷新间隔时重新解析 解析失败时沿用旧实例
+func (d *Discovery) service(ctx context.Context, name string) (*service, error) {
+	d.mu.Lock()
+	svc, ok := d.services[name]
+	if !ok {
+		svc = &service{}
+		d.services[name] = svc
+	}
+	d.mu.Unlock()
+
+	svc.resolveMu.Lock()
+	defer svc.resolveMu.Unlock()
+	if !svc.resolved.IsZero() && time.Since(svc.resolved) < d.opts.refresh {
+		return svc, nil
+	}
+	endpoints, err := d.resolver.Resolve(ctx, name)
+	if err != nil {
+		if svc.resolved.IsZero() {
+			return nil, err
+		}
+		svc.resolved = time.Now()
+		return svc, nil
+	}
+	svc.update(endpoints, d.opts.replicas)
+	svc.resolved = time.Now()
+	return svc, nil
+}
+
+type endpoint struct {
+	Endpoint
+	inflight int64
+
+	// 以下字段由service.mu保护
+	currentWeight int
+	failures      int
+	ejectedUntil  time.Time
+}
+
+type ringNode struct {
+	hash uint32
+	ep   *endpoint
+}
+
+type service struct {
+	resolveMu sync.Mutex
+	resolved  time.Time
+
+	mu        sync.Mutex
+	endpoints []*endpoint
+	ring      []ringNode
+	next      uint64
+}
+
+// update 替换实例列表 保留地址相同实例的统计状态
+func (s *service) update(endpoints []Endpoint, replicas int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	old := make(map[string]*endpoint, len(s.endpoints))
+	for _, e := range s.endpoints {
+		old[e.Addr] = e
+	}
+	list := make([]*endpoint, 0, len(endpoints))
+	for _, ep := range endpoints {
+		if ep.Scheme == "" {
+			ep.Scheme = "http"
+		}
+		if ep.Weight <= 0 {
+			ep.Weight = 1
+		}
+		e, ok := old[ep.Addr]
+		if !ok {
+			e = &endpoint{}
+		}
+		e.Endpoint = ep
+		list = append(list, e)
+	}
+	s.endpoints = list
+
+	s.ring = s.ring[:0]
+	for _, e := range list {
+		for i := 0; i < replicas*e.Weight; i++ {
+			s.ring = append(s.ring, ringNode{hash: crc32.ChecksumIEEE([]byte(e.Addr + "#" + strconv.Itoa(i))), ep: e})
+		}
+	}
+	sort.Slice(s.ring, func(i, j int) bool { return s.ring[i].hash < s.ring[j].hash })
+}
+
+// pick 选择实例 全部实例被摘除时忽略摘除状态
+func (s *service) pick(strategy Strategy, key string, now time.Time) *endpoint {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	available := make([]*endpoint, 0, len(s.endpoints))
+	for _, e := range s.endpoints {
+		if now.After(e.ejectedUntil) {
+			available = append(available, e)
+		}
+	}
+	if len(available) == 0 {
+		available = s.endpoints
+	}
+	if len(available) == 0 {
+		return nil
+	}
+
+	switch strategy {
+	case Weighted:
+		// 平滑加权轮询
+		var best *endpoint
+		total := 0
+		for _, e := range available {
+			e.currentWeight += e.Weight
+			total += e.Weight
+			if best == nil || e.currentWeight > best.currentWeight {
+				best = e
+			}
+		}
+		best.currentWeight -= total
+		return best
+	case LeastInflight:
+		// 进行中请求数相同时轮询 避免总是选中第一个
+		start := int(s.next % uint64(len(available)))
+		s.next++
+		best := available[start]
+		for i := 1; i < len(available); i++ {
+			e := available[(start+i)%len(available)]
+			if atomic.LoadInt64(&e.inflight) < atomic.LoadInt64(&best.inflight) {
+				best = e
+			}
+		}
+		return best
+	case ConsistentHash:
+		if len(s.ring) > 0 {
+			hash := crc32.ChecksumIEEE([]byte(key))
+			i := sort.Search(len(s.ring), func(i int) bool { return s.ring[i].hash >= hash })
+			for n := 0; n < len(s.ring); n++ {
+				e := s.ring[(i+n)%len(s.ring)].ep
+				if now.After(e.ejectedUntil) || len(available) == len(s.endpoints) {
+					return e
+				}
+			}
+		}
+	}
+
+	e := available[s.next%uint64(len(available))]
+	s.next++
+	return e
+}
+
+// report 记录请求结果 连续失败达到阈值且未超过最大摘除比例时摘除实例
+func (s *service) report(e *endpoint, failure bool, conf OutlierConfig, now time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !failure {
+		e.failures = 0
+		return
+	}
+	e.failures++
+	if e.failures < conf.ConsecutiveFailures || now.Before(e.ejectedUntil) {
+		return
+	}
+
+	ejected := 0
+	for _, other := range s.endpoints {
+		if now.Before(other.ejectedUntil) {
+			ejected++
+		}
+	}
+	if (ejected+1)*100 > len(s.endpoints)*conf.MaxEjectionPercent {
+		return
+	}
+	e.failures = 0
+	e.ejectedUntil = now.Add(conf.EjectDuration)
+}
@@ -0,0 +1,130 @@
+package http
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func newBackend(name string, status int) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+		w.Write([]byte(name))
+	}))
+}
+
+func TestDiscovery(t *testing.T) {
+	a, b := newBackend("a", http.StatusOK), newBackend("b", http.StatusOK)
+	defer a.Close()
+	defer b.Close()
+	resolver := StaticResolver{"orders": {
+		{Addr: strings.TrimPrefix(a.URL, "http://")},
+		{Addr: strings.TrimPrefix(b.URL, "http://")},
+	}}
+
+	client := NewClient(WithDiscovery(NewDiscovery(resolver)))
+	seen := map[string]int{}
+	for i := 0; i < 4; i++ {
+		body, r := client.NewRequest("svc://orders/v1/list").ToString()
+		if r.Error != nil {
+			t.Fatal(r.Error)
+		}
+		seen[body]++
+	}
+	if seen["a"] != 2 || seen["b"] != 2 {
+		t.Errorf("round robin got %v", seen)
+	}
+
+	client = NewClient(WithDiscovery(NewDiscovery(resolver, WithStrategy(ConsistentHash))))
+	first, _ := client.NewRequest("svc://orders/v1/list").BalanceKey("user-1").ToString()
+	for i := 0; i < 5; i++ {
+		if body, _ := client.NewRequest("svc://orders/v1/list").BalanceKey("user-1").ToString(); body != first {
+			t.Fatalf("consistent hash moved from %s to %s", first, body)
+		}
+	}
+
+	if _, r := NewClient().NewRequest("svc://orders/v1/list").ToString(); r.Error != ErrNoDiscovery {
+		t.Errorf("got %v", r.Error)
+	}
+}
+
+// TestUseDiscoveryConcurrent 发送请求的同时调用UseDiscovery 需配合-race运行
+func TestUseDiscoveryConcurrent(t *testing.T) {
+	backend := newBackend("a", http.StatusOK)
+	defer backend.Close()
+	d := NewDiscovery(StaticResolver{"orders": {{Addr: strings.TrimPrefix(backend.URL, "http://")}}})
+
+	defaultClient, defaultH2CClient := DefaultClient, DefaultH2CClient
+	DefaultClient, DefaultH2CClient = NewClient(), NewClient(WithProtocol(H2C))
+	defer func() { DefaultClient, DefaultH2CClient = defaultClient, defaultH2CClient }()
+	UseDiscovery(d)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 10; j++ {
+				if _, r := DefaultClient.NewRequest("svc://orders/v1/list").ToString(); r.Error != nil {
+					t.Error(r.Error)
+					return
+				}
+			}
+		}()
+	}
+	for i := 0; i < 10; i++ {
+		UseDiscovery(d)
+	}
+	wg.Wait()
+}
+
+func TestOutlierEjection(t *testing.T) {
+	good, bad := newBackend("good", http.StatusOK), newBackend("bad", http.StatusInternalServerError)
+	defer good.Close()
+	defer bad.Close()
+	resolver := StaticResolver{"orders": {
+		{Addr: strings.TrimPrefix(good.URL, "http://")},
+		{Addr: strings.TrimPrefix(bad.URL, "http://")},
+	}}
+
+	d := NewDiscovery(resolver, WithOutlier(OutlierConfig{ConsecutiveFailures: 2, EjectDuration: time.Minute}))
+	client := NewClient(WithDiscovery(d))
+	for i := 0; i < 4; i++ {
+		client.NewRequest("svc://orders").ToString()
+	}
+	for i := 0; i < 4; i++ {
+		if body, r := client.NewRequest("svc://orders").ToString(); r.Error != nil || body != "good" {
+			t.Fatalf("ejected endpoint still picked: %q %v", body, r.Error)
+		}
+	}
+}
+
+func TestFileResolver(t *testing.T) {
+	dir, err := ioutil.TempDir("", "resolver")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "services.json")
+	ioutil.WriteFile(path, []byte(`{"orders":[{"addr":"10.0.0.1:80"}]}`), 0644)
+
+	r, err := NewFileResolver(path, time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ioutil.WriteFile(path, []byte(`{"orders":[{"addr":"10.0.0.2:80","weight":3}]}`), 0644)
+	os.Chtimes(path, time.Now(), time.Now().Add(time.Second))
+	time.Sleep(2 * time.Millisecond)
+
+	endpoints, err := r.Resolve(context.Background(), "orders")
+	if err != nil || len(endpoints) != 1 || endpoints[0].Addr != "10.0.0.2:80" || endpoints[0].Weight != 3 {
+		t.Errorf("got %+v %v", endpoints, err)
+	}
+}
@@ -0,0 +1,283 @@
+package http
+
+import (
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// ErrCircuitOpen 熔断器打开时请求直接返回的错误
+var ErrCircuitOpen = errors.New("circuit breaker is open")
+
+// BreakerState 熔断器状态
+type BreakerState int
+
+const (
+	// StateClosed 正常放行 统计失败率
+	StateClosed BreakerState = iota
+	// StateOpen 拒绝所有请求 OpenTimeout后进入半开
+	StateOpen
+	// StateHalfOpen 放行少量探测请求 全部成功后关闭 任一失败重新打开
+	StateHalfOpen
+)
+
+func (s BreakerState) String() string {
+	switch s {
+	case StateClosed:
+		return "closed"
+	case StateOpen:
+		return "open"
+	case StateHalfOpen:
+		return "half-open"
+	}
+	return "unknown"
+}
+
+// BreakerKeyByHost 按请求host区分熔断器
+func BreakerKeyByHost(m Middleware) string {
+	return m.GetRequest().URL.Host
+}
+
+// BreakerKeyByName 按SetName设置的标签区分熔断器 未设置时按host
+func BreakerKeyByName(m Middleware) string {
+	if name := m.GetName(); name != "" {
+		return name
+	}
+	return BreakerKeyByHost(m)
+}
+
+// CircuitBreakerConfig 熔断器配置 零值字段使用默认值
+type CircuitBreakerConfig struct {
+	// Key 熔断器分组 默认BreakerKeyByHost
+	Key func(m Middleware) string
+	// Interval 关闭状态下的统计周期 默认10s
+	Interval time.Duration
+	// MinRequests 统计周期内完成的请求数达到该值才计算比例 默认20
+	MinRequests int
+	// FailureRatio 失败比例阈值 默认0.5
+	FailureRatio float64
+	// SlowCallDuration 耗时超过该值记为慢调用 0表示不统计慢调用
+	SlowCallDuration time.Duration
+	// SlowCallRatio 慢调用比例阈值 默认1 即全部为慢调用时熔断
+	SlowCallRatio float64
+	// OpenTimeout 打开后多久进入半开 默认30s
+	OpenTimeout time.Duration
+	// HalfOpenRequests 半开状态允许的探测请求数 默认1
+	HalfOpenRequests int
+	// IsFailure 判断一次请求是否失败 默认网络错误或5xx
+	IsFailure func(resp *http.Response, err error) bool
+	// Fallback 熔断拒绝请求时调用 未调用m.Stop时以ErrCircuitOpen终止请求
+	Fallback func(m Middleware, err error)
+}
+
+// CircuitBreaker 按Key分组的熔断器 通过Handler()注册为middleware
+type CircuitBreaker struct {
+	conf CircuitBreakerConfig
+
+	mu       sync.Mutex
+	breakers map[string]*breaker
+}
+
+// NewCircuitBreaker 创建CircuitBreaker
+func NewCircuitBreaker(conf CircuitBreakerConfig) *CircuitBreaker {
+	if conf.Key == nil {
+		conf.Key = BreakerKeyByHost
+	}
+	if conf.Interval <= 0 {
+		conf.Interval = 10 * time.Second
+	}
+	if conf.MinRequests <= 0 {
+		conf.MinRequests = 20
+	}
+	if conf.FailureRatio <= 0 {
+		conf.FailureRatio = 0.5
+	}
+	if conf.SlowCallRatio <= 0 {
+		conf.SlowCallRatio = 1
+	}
+	if conf.OpenTimeout <= 0 {
+		conf.OpenTimeout = 30 * time.Second
+	}
+	if conf.HalfOpenRequests <= 0 {
+		conf.HalfOpenRequests = 1
+	}
+	if conf.IsFailure == nil {
+		conf.IsFailure = func(resp *http.Response, err error) bool {
+			return err != nil && resp == nil || resp != nil && resp.StatusCode >= 500
+		}
+	}
+	return &CircuitBreaker{
+		conf:     conf,
+		breakers: make(map[string]*breaker),
+	}
+}
+
+// Handler 返回熔断middleware
+func (cb *CircuitBreaker) Handler() Handler {
+	return func(m Middleware) {
+		key := cb.conf.Key(m)
+		b := cb.get(key, m.getMetrics())
+
+		generation, ok := b.allow(m.getMetrics(), time.Now())
+		if !ok {
+			if cb.conf.Fallback != nil {
+				cb.conf.Fallback(m, ErrCircuitOpen)
+			}
+			if !m.getStop() {
+				m.Stop(ErrCircuitOpen)
+			}
+			return
+		}
+
+		start := time.Now()
+		m.Next()
+		resp, err := m.GetRespone()
+		failure := cb.conf.IsFailure(resp, err)
+		slow := cb.conf.SlowCallDuration > 0 && time.Since(start) >= cb.conf.SlowCallDuration
+		b.record(generation, failure, slow, time.Now())
+	}
+}
+
+// State 返回key对应熔断器的当前状态
+func (cb *CircuitBreaker) State(key string) BreakerState {
+	cb.mu.Lock()
+	b, ok := cb.breakers[key]
+	cb.mu.Unlock()
+	if !ok {
+		return StateClosed
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.refresh(time.Now())
+	return b.state
+}
+
+func (cb *CircuitBreaker) get(key string, metrics Prometheus) *breaker {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	b, ok := cb.breakers[key]
+	if !ok {
+		b = &breaker{key: key, conf: &cb.conf, metrics: metrics}
+		b.toState(StateClosed, time.Now())
+		cb.breakers[key] = b
+	}
+	return b
+}
+
+type breaker struct {
+	key  string
+	conf *CircuitBreakerConfig
+	// metrics 最近一次请求所属Client的监控上报
+	metrics Prometheus
+
+	mu         sync.Mutex
+	state      BreakerState
+	generation uint64
+	expiry     time.Time // closed: 统计周期结束时间 open: 进入半开的时间
+	requests   int       // half-open: 已放行的探测数
+	completed  int       // closed: 统计周期内已完成的请求数
+	failures   int
+	slows      int
+	successes  int
+}
+
+func (b *breaker) allow(metrics Prometheus, now time.Time) (uint64, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.metrics = metrics
+	b.refresh(now)
+	switch b.state {
+	case StateOpen:
+		return b.generation, false
+	case StateHalfOpen:
+		if b.requests >= b.conf.HalfOpenRequests {
+			return b.generation, false
+		}
+	}
+	b.requests++
+	return b.generation, true
+}
+
+func (b *breaker) record(generation uint64, failure, slow bool, now time.Time) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.refresh(now)
+	// 状态已切换 丢弃上一阶段的结果
+	if generation != b.generation {
+		return
+	}
+
+	switch b.state {
+	case StateHalfOpen:
+		if failure || slow {
+			b.toState(StateOpen, now)
+			return
+		}
+		b.successes++
+		if b.successes >= b.conf.HalfOpenRequests {
+			b.toState(StateClosed, now)
+		}
+	case StateClosed:
+		// 跨统计周期完成的请求计入当前周期 比例按已完成的请求计算
+		b.completed++
+		if failure {
+			b.failures++
+		}
+		if slow {
+			b.slows++
+		}
+		if b.completed < b.conf.MinRequests {
+			return
+		}
+		total := float64(b.completed)
+		if float64(b.failures)/total >= b.conf.FailureRatio ||
+			b.conf.SlowCallDuration > 0 && float64(b.slows)/total >= b.conf.SlowCallRatio {
+			b.toState(StateOpen, now)
+		}
+	}
+}
+
+// refresh 处理统计周期滚动与open到half-open的超时切换 周期滚动不切换generation
+func (b *breaker) refresh(now time.Time) {
+	switch b.state {
+	case StateClosed:
+		if now.After(b.expiry) {
+			b.reset()
+			b.expiry = now.Add(b.conf.Interval)
+		}
+	case StateOpen:
+		if now.After(b.expiry) {
+			b.toState(StateHalfOpen, now)
+		}
+	}
+}
+
+func (b *breaker) toState(state BreakerState, now time.Time) {
+	b.state = state
+	b.generation++
+	b.reset()
+	switch state {
+	case StateClosed:
+		b.expiry = now.Add(b.conf.Interval)
+	case StateOpen:
+		b.expiry = now.Add(b.conf.OpenTimeout)
+	default:
+		b.expiry = time.Time{}
+	}
+	if m, ok := b.metrics.(BreakerMetrics); ok {
+		m.CircuitBreakerWithLabelValues(b.key, state.String())
+	}
+}
+
+func (b *breaker) reset() {
+	b.requests = 0
+	b.completed = 0
+	b.failures = 0
+	b.slows = 0
+	b.successes = 0
+}
@@ -0,0 +1,94 @@
+package http
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type breakerRecorder struct {
+	states []string
+}
+
+func (r *breakerRecorder) HttpClientWithLabelValues(domain, httpCode, protocol, method, tag string, starTime time.Time) {
+}
+
+func (r *breakerRecorder) CircuitBreakerWithLabelValues(key, state string) {
+	r.states = append(r.states, key+"="+state)
+}
+
+func TestCircuitBreaker(t *testing.T) {
+	var calls, healthy int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		if atomic.LoadInt32(&healthy) == 0 {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer srv.Close()
+
+	cb := NewCircuitBreaker(CircuitBreakerConfig{
+		Key:         BreakerKeyByName,
+		MinRequests: 2,
+		OpenTimeout: 20 * time.Millisecond,
+	})
+	metrics := &breakerRecorder{}
+	client := NewClient(WithMetrics(metrics))
+	client.Use(cb.Handler())
+
+	for i := 0; i < 2; i++ {
+		client.NewRequest(srv.URL).SetName("upstream").ToBytes()
+	}
+	if state := cb.State("upstream"); state != StateOpen {
+		t.Fatalf("state got %s", state)
+	}
+
+	_, r := client.NewRequest(srv.URL).SetName("upstream").ToBytes()
+	if r.Error != ErrCircuitOpen || calls != 2 {
+		t.Fatalf("open breaker got calls %d err %v", calls, r.Error)
+	}
+
+	time.Sleep(30 * time.Millisecond)
+	atomic.StoreInt32(&healthy, 1)
+	if _, r = client.NewRequest(srv.URL).SetName("upstream").ToBytes(); r.Error != nil {
+		t.Fatal(r.Error)
+	}
+	if state := cb.State("upstream"); state != StateClosed {
+		t.Errorf("state got %s", state)
+	}
+
+	// 状态切换通过Client设置的监控上报
+	want := "upstream=closed upstream=open upstream=half-open upstream=closed"
+	if got := strings.Join(metrics.states, " "); got != want {
+		t.Errorf("breaker metrics got %s", got)
+	}
+}
+
+// TestBreakerInFlight 跨统计周期完成的请求计入当前周期 失败率按已完成的请求计算
+func TestBreakerInFlight(t *testing.T) {
+	cb := NewCircuitBreaker(CircuitBreakerConfig{MinRequests: 2, Interval: 10 * time.Second})
+	now := time.Now()
+
+	b := cb.get("rollover", nil)
+	g1, _ := b.allow(nil, now)
+	g2, _ := b.allow(nil, now)
+	b.record(g1, true, false, now.Add(11*time.Second))
+	b.record(g2, true, false, now.Add(11*time.Second))
+	if b.state != StateOpen {
+		t.Errorf("failures completed after rollover got %s", b.state)
+	}
+
+	b = cb.get("inflight", nil)
+	generations := make([]uint64, 10)
+	for i := range generations {
+		generations[i], _ = b.allow(nil, now)
+	}
+	b.record(generations[0], true, false, now)
+	b.record(generations[1], true, false, now)
+	if b.state != StateOpen {
+		t.Errorf("failures with requests in flight got %s", b.state)
+	}
+}
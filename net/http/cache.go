@@ -0,0 +1,326 @@
+package http
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Tokumicn/lego-lib/cache"
+)
+
+// CacheConfig GET响应缓存配置
+type CacheConfig struct {
+	// Cache 缓存实现 必填
+	Cache cache.Cache
+	// Prefix 缓存key前缀 默认httpcache:
+	Prefix string
+	// VaryHeaders 参与缓存key的请求头 如Accept-Language 响应的Vary头始终生效
+	VaryHeaders []string
+	// DefaultTTL 响应没有Cache-Control与Expires时的缓存时间 默认0不缓存
+	DefaultTTL time.Duration
+	// RevalidateTTL 带ETag或Last-Modified的响应过期后继续保留用于条件请求的时间 默认10m
+	RevalidateTTL time.Duration
+	// MaxEntrySize 可缓存的最大响应体 默认1MB
+	MaxEntrySize int64
+}
+
+type cacheEntry struct {
+	StatusCode int         `json:"status"`
+	Proto      string      `json:"proto"`
+	Header     http.Header `json:"header"`
+	Body       []byte      `json:"body"`
+	Stored     time.Time   `json:"stored"`
+	Expires    time.Time   `json:"expires"`
+	// Vary 响应Vary头中各请求头在存储时的取值
+	Vary map[string]string `json:"vary,omitempty"`
+}
+
+func (e *cacheEntry) fresh(now time.Time) bool {
+	return now.Before(e.Expires)
+}
+
+func (e *cacheEntry) validators() bool {
+	return e.Header.Get("ETag") != "" || e.Header.Get("Last-Modified") != ""
+}
+
+// matches 请求在响应Vary列出的头上与存储时一致
+func (e *cacheEntry) matches(req *http.Request) bool {
+	for name, value := range e.Vary {
+		if req.Header.Get(name) != value {
+			return false
+		}
+	}
+	return true
+}
+
+func (e *cacheEntry) response(req *http.Request, now time.Time) *http.Response {
+	header := e.Header.Clone()
+	header.Set("Age", strconv.FormatInt(int64(now.Sub(e.Stored)/time.Second), 10))
+	resp := &http.Response{
+		Status:        strconv.Itoa(e.StatusCode) + " " + http.StatusText(e.StatusCode),
+		StatusCode:    e.StatusCode,
+		Proto:         e.Proto,
+		Header:        header,
+		Body:          ioutil.NopCloser(bytes.NewReader(e.Body)),
+		ContentLength: int64(len(e.Body)),
+		Request:       req,
+	}
+	resp.ProtoMajor, resp.ProtoMinor, _ = http.ParseHTTPVersion(e.Proto)
+	return resp
+}
+
+// ResponseCache 返回GET响应缓存middleware
+// 遵循Cache-Control与Expires 过期后通过If-None-Match与If-Modified-Since重新验证
+// 缓存在请求间共享 不缓存private响应 带Authorization的请求只缓存public响应
+func ResponseCache(conf CacheConfig) Handler {
+	if conf.Cache == nil {
+		panic("http: ResponseCache needs a cache.Cache")
+	}
+	if conf.Prefix == "" {
+		conf.Prefix = "httpcache:"
+	}
+	if conf.RevalidateTTL <= 0 {
+		conf.RevalidateTTL = 10 * time.Minute
+	}
+	if conf.MaxEntrySize <= 0 {
+		conf.MaxEntrySize = 1 << 20
+	}
+	rc := &responseCache{conf: conf}
+	return rc.handle
+}
+
+type responseCache struct {
+	conf CacheConfig
+}
+
+func (rc *responseCache) handle(m Middleware) {
+	req := m.GetRequest()
+	reqCC := parseCacheControl(req.Header.Get("Cache-Control"))
+	if req.Method != "" && req.Method != http.MethodGet || reqCC.has("no-store") {
+		m.Next()
+		return
+	}
+
+	key := rc.key(req)
+	entry := rc.get(key)
+	if entry != nil && !entry.matches(req) {
+		entry = nil
+	}
+	now := time.Now()
+	if entry != nil && entry.fresh(now) && !reqCC.has("no-cache") {
+		m.SetResponse(entry.response(req, now))
+		return
+	}
+
+	// 调用方自带条件请求头时不替换 304直接返回调用方
+	if entry != nil && (req.Header.Get("If-None-Match") != "" || req.Header.Get("If-Modified-Since") != "") {
+		entry = nil
+	}
+	// 条件请求的头只加在每次尝试的请求副本上 不修改调用方的请求
+	if entry != nil {
+		etag, lastModified := entry.Header.Get("ETag"), entry.Header.Get("Last-Modified")
+		m.onAttempt(func(attempt *http.Request) error {
+			if etag != "" {
+				attempt.Header.Set("If-None-Match", etag)
+			}
+			if lastModified != "" {
+				attempt.Header.Set("If-Modified-Since", lastModified)
+			}
+			return nil
+		})
+	}
+
+	m.Next()
+	resp, err := m.GetRespone()
+	if err != nil || resp == nil {
+		return
+	}
+
+	if resp.StatusCode == http.StatusNotModified && entry != nil {
+		resp.Body.Close()
+		for key, values := range resp.Header {
+			entry.Header[key] = values
+		}
+		now = time.Now()
+		entry.Stored = now
+		entry.Expires = now.Add(rc.freshness(resp.Header, now))
+		if vary, ok := storable(req, entry.Header); ok {
+			entry.Vary = vary
+			rc.put(key, entry)
+		}
+		m.SetResponse(entry.response(req, now))
+		return
+	}
+	if resp.StatusCode == http.StatusOK {
+		rc.store(key, req, resp)
+	}
+}
+
+// storable 判断响应能否存入共享缓存 返回响应Vary头中各请求头的取值
+func storable(req *http.Request, header http.Header) (map[string]string, bool) {
+	respCC := parseCacheControl(header.Get("Cache-Control"))
+	if respCC.has("no-store") || respCC.has("private") {
+		return nil, false
+	}
+	if req.Header.Get("Authorization") != "" && !respCC.has("public") {
+		return nil, false
+	}
+
+	var vary map[string]string
+	for _, value := range header["Vary"] {
+		for _, name := range strings.Split(value, ",") {
+			name = http.CanonicalHeaderKey(strings.TrimSpace(name))
+			if name == "" {
+				continue
+			}
+			if name == "*" {
+				return nil, false
+			}
+			if vary == nil {
+				vary = make(map[string]string)
+			}
+			vary[name] = req.Header.Get(name)
+		}
+	}
+	return vary, true
+}
+
+// store 缓存可缓存的响应 并替换resp.Body使调用方仍能读取完整响应体
+func (rc *responseCache) store(key string, req *http.Request, resp *http.Response) {
+	vary, ok := storable(req, resp.Header)
+	if !ok {
+		return
+	}
+	if resp.ContentLength > rc.conf.MaxEntrySize {
+		return
+	}
+
+	body, err := ioutil.ReadAll(io.LimitReader(resp.Body, rc.conf.MaxEntrySize+1))
+	if err != nil || int64(len(body)) > rc.conf.MaxEntrySize {
+		resp.Body = &multiReadCloser{Reader: io.MultiReader(bytes.NewReader(body), resp.Body), Closer: resp.Body}
+		return
+	}
+	resp.Body.Close()
+	resp.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+	now := time.Now()
+	entry := &cacheEntry{
+		StatusCode: resp.StatusCode,
+		Proto:      resp.Proto,
+		Header:     resp.Header.Clone(),
+		Body:       body,
+		Stored:     now,
+		Expires:    now.Add(rc.freshness(resp.Header, now)),
+		Vary:       vary,
+	}
+	if !entry.fresh(now) && !entry.validators() {
+		return
+	}
+	rc.put(key, entry)
+}
+
+// freshness 根据max-age或Expires计算有效期 no-cache为0
+func (rc *responseCache) freshness(header http.Header, now time.Time) time.Duration {
+	cc := parseCacheControl(header.Get("Cache-Control"))
+	if cc.has("no-cache") {
+		return 0
+	}
+	if maxAge, ok := cc["max-age"]; ok {
+		seconds, err := strconv.ParseInt(maxAge, 10, 64)
+		if err != nil || seconds <= 0 {
+			return 0
+		}
+		age, _ := strconv.ParseInt(header.Get("Age"), 10, 64)
+		return time.Duration(seconds-age) * time.Second
+	}
+	if expires := header.Get("Expires"); expires != "" {
+		t, err := http.ParseTime(expires)
+		if err != nil {
+			return 0
+		}
+		if date, err := http.ParseTime(header.Get("Date")); err == nil {
+			now = date
+		}
+		return t.Sub(now)
+	}
+	return rc.conf.DefaultTTL
+}
+
+func (rc *responseCache) key(req *http.Request) string {
+	var b strings.Builder
+	b.WriteString(rc.conf.Prefix)
+	b.WriteString(req.URL.String())
+	for _, name := range rc.conf.VaryHeaders {
+		b.WriteString("|")
+		b.WriteString(req.Header.Get(name))
+	}
+	return b.String()
+}
+
+func (rc *responseCache) get(key string) *cacheEntry {
+	var data []byte
+	switch v := rc.conf.Cache.Get(key).(type) {
+	case []byte:
+		data = v
+	case string:
+		data = []byte(v)
+	default:
+		return nil
+	}
+	entry := &cacheEntry{}
+	if err := json.Unmarshal(data, entry); err != nil || entry.Header == nil {
+		return nil
+	}
+	return entry
+}
+
+func (rc *responseCache) put(key string, entry *cacheEntry) {
+	ttl := entry.Expires.Sub(entry.Stored)
+	if ttl < 0 {
+		ttl = 0
+	}
+	if entry.validators() {
+		ttl += rc.conf.RevalidateTTL
+	}
+	if ttl < time.Second {
+		return
+	}
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return
+	}
+	rc.conf.Cache.Put(key, data, ttl)
+}
+
+type cacheControl map[string]string
+
+func parseCacheControl(value string) cacheControl {
+	cc := cacheControl{}
+	for _, part := range strings.Split(value, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		name, val := part, ""
+		if i := strings.Index(part, "="); i >= 0 {
+			name, val = part[:i], strings.Trim(part[i+1:], `"`)
+		}
+		cc[strings.ToLower(name)] = val
+	}
+	return cc
+}
+
+func (cc cacheControl) has(name string) bool {
+	_, ok := cc[name]
+	return ok
+}
+
+type multiReadCloser struct {
+	io.Reader
+	io.Closer
+}
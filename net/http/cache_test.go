@@ -0,0 +1,158 @@
+package http
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+type memoryCache struct {
+	mu   sync.Mutex
+	data map[string]interface{}
+}
+
+func (m *memoryCache) Get(key string) interface{} {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.data[key]
+}
+func (m *memoryCache) GetMulti(keys []string) []interface{} { return nil }
+func (m *memoryCache) Put(key string, val interface{}, timeout time.Duration) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.data[key] = val
+	return nil
+}
+func (m *memoryCache) Delete(key string) error        { return nil }
+func (m *memoryCache) Incr(key string) error          { return nil }
+func (m *memoryCache) Decr(key string) error          { return nil }
+func (m *memoryCache) IsExist(key string) bool        { return m.Get(key) != nil }
+func (m *memoryCache) ClearAll() error                { return nil }
+func (m *memoryCache) StartAndGC(config string) error { return nil }
+
+func TestResponseCache(t *testing.T) {
+	var hits, revalidated int
+	maxAge := "max-age=60"
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits++
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			revalidated++
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("Cache-Control", maxAge)
+		w.Header().Set("ETag", `"v1"`)
+		w.Write([]byte("config"))
+	}))
+	defer srv.Close()
+
+	client := NewClient()
+	client.Use(ResponseCache(CacheConfig{Cache: &memoryCache{data: map[string]interface{}{}}}))
+
+	for i := 0; i < 3; i++ {
+		body, r := client.NewRequest(srv.URL).ToString()
+		if r.Error != nil || body != "config" {
+			t.Fatalf("got %q %v", body, r.Error)
+		}
+	}
+	if hits != 1 {
+		t.Errorf("fresh entry hit server %d times", hits)
+	}
+
+	// no-cache强制重新验证
+	body, r := client.NewRequest(srv.URL).AddHeader("Cache-Control", "no-cache").ToString()
+	if r.Error != nil || body != "config" || r.StatusCode != http.StatusOK {
+		t.Fatalf("revalidate got %q %+v", body, r)
+	}
+	if revalidated != 1 {
+		t.Errorf("revalidated %d", revalidated)
+	}
+}
+
+// TestResponseCacheConditional 调用方自带的条件请求头原样发送且不被修改 重试时仍带缓存的校验值
+func TestResponseCacheConditional(t *testing.T) {
+	var failNext bool
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if failNext {
+			failNext = false
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Header().Set("ETag", `"v1"`)
+		w.Write([]byte("config"))
+	}))
+	defer srv.Close()
+
+	client := NewClient()
+	client.Use(ResponseCache(CacheConfig{Cache: &memoryCache{data: map[string]interface{}{}}}))
+	if _, r := client.NewRequest(srv.URL).ToString(); r.Error != nil {
+		t.Fatal(r.Error)
+	}
+
+	req := client.NewRequest(srv.URL).AddHeader("If-None-Match", `"v1"`)
+	if _, r := req.ToString(); r.StatusCode != http.StatusNotModified {
+		t.Errorf("caller validator got %d %v", r.StatusCode, r.Error)
+	}
+	if got := req.(*FastRequest).resq.Header.Get("If-None-Match"); got != `"v1"` {
+		t.Errorf("caller header changed to %q", got)
+	}
+
+	req = client.NewRequest(srv.URL)
+	if body, r := req.ToString(); r.Error != nil || body != "config" {
+		t.Fatalf("revalidate got %q %v", body, r.Error)
+	}
+	if got := req.(*FastRequest).resq.Header.Get("If-None-Match"); got != "" {
+		t.Errorf("revalidation left header %q", got)
+	}
+
+	failNext = true
+	body, r := client.NewRequest(srv.URL).Retry(&RetryPolicy{MaxAttempts: 2}).ToString()
+	if r.Error != nil || body != "config" || r.StatusCode != http.StatusOK {
+		t.Errorf("revalidate with retry got %q %d %v", body, r.StatusCode, r.Error)
+	}
+}
+
+// TestResponseCachePrivate 不同凭据与Vary取值的请求不共用缓存
+func TestResponseCachePrivate(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/me":
+			w.Header().Set("Cache-Control", "max-age=60")
+		case "/private":
+			w.Header().Set("Cache-Control", "private, max-age=60")
+		case "/lang":
+			w.Header().Set("Cache-Control", "public, max-age=60")
+			w.Header().Set("Vary", "Accept-Language")
+		}
+		w.Write([]byte(r.Header.Get("Authorization") + r.Header.Get("X-User") + r.Header.Get("Accept-Language")))
+	}))
+	defer srv.Close()
+
+	client := NewClient()
+	client.Use(ResponseCache(CacheConfig{Cache: &memoryCache{data: map[string]interface{}{}}}))
+
+	cases := []struct {
+		path, header, value string
+	}{
+		{"/me", "Authorization", "alice"},
+		{"/me", "Authorization", "bob"},
+		{"/private", "X-User", "alice"},
+		{"/private", "X-User", "bob"},
+		{"/lang", "Accept-Language", "en"},
+		{"/lang", "Accept-Language", "zh"},
+		{"/lang", "Accept-Language", "en"},
+	}
+	for _, c := range cases {
+		body, r := client.NewRequest(srv.URL+c.path).AddHeader(c.header, c.value).ToString()
+		if r.Error != nil || body != c.value {
+			t.Errorf("%s %s=%s got %q %v", c.path, c.header, c.value, body, r.Error)
+		}
+	}
+}
@@ -0,0 +1,336 @@
+package http
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"net"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"golang.org/x/sync/singleflight"
+)
+
+// Protocol 客户端使用的传输协议
+type Protocol int
+
+const (
+	// HTTP1 HTTP/1.1 https下服务端支持时协商为h2
+	HTTP1 Protocol = iota
+	// HTTP2 仅使用基于TLS的h2
+	HTTP2
+	// H2C 明文HTTP/2 https地址使用基于TLS的h2
+	H2C
+)
+
+var (
+	// DefaultClient NewFastRequest使用的客户端
+	DefaultClient *Client
+	// DefaultH2CClient NewH2CRequest使用的客户端
+	DefaultH2CClient *Client
+
+	// Fastclient DefaultClient底层的http.Client
+	// Deprecated: 使用DefaultClient.HTTPClient()
+	Fastclient *http.Client
+)
+
+func init() {
+	NewFastClient(15*time.Second, 512, false)
+	Newh2cClient(15 * time.Second)
+}
+
+// NewFastClient 重建DefaultClient 已注册的middleware与服务发现保留
+func NewFastClient(rwTimeout time.Duration, MaxIdleConns int, disableKeepAlives bool) {
+	client := NewClient(
+		WithTimeout(rwTimeout),
+		WithMaxIdleConns(MaxIdleConns),
+		WithDisableKeepAlives(disableKeepAlives),
+	)
+	if DefaultClient != nil {
+		client.Use(DefaultClient.handlers()...)
+		client.setDiscovery(DefaultClient.getDiscovery())
+	}
+	DefaultClient = client
+	Fastclient = client.client
+}
+
+// Newh2cClient 重建DefaultH2CClient 已注册的middleware与服务发现保留
+func Newh2cClient(rwTimeout time.Duration) {
+	client := NewClient(
+		WithProtocol(H2C),
+		WithTimeout(rwTimeout),
+		WithDialTimeout(6*time.Second),
+	)
+	if DefaultH2CClient != nil {
+		client.Use(DefaultH2CClient.handlers()...)
+		client.setDiscovery(DefaultH2CClient.getDiscovery())
+	}
+	DefaultH2CClient = client
+}
+
+type clientOptions struct {
+	protocol            Protocol
+	timeout             time.Duration
+	dialTimeout         time.Duration
+	keepAlive           time.Duration
+	maxIdleConns        int
+	maxIdleConnsPerHost int
+	idleConnTimeout     time.Duration
+	disableKeepAlives   bool
+	proxy               func(*http.Request) (*url.URL, error)
+	proxyURL            *url.URL
+	tlsConfig           *tls.Config
+	rootCAs             *x509.CertPool
+	certificates        []tls.Certificate
+	localAddr           net.Addr
+	resolver            *net.Resolver
+	dnsCacheTTL         time.Duration
+	readIdleTimeout     time.Duration
+	pingTimeout         time.Duration
+	transport           http.RoundTripper
+	metrics             Prometheus
+	maxBodySize         int64
+	ignoreStatusError   bool
+	attemptTimeout      time.Duration
+	acceptEncoding      []string
+	maxDecodedSize      int64
+	discovery           *Discovery
+}
+
+// ClientOption Client构造选项
+type ClientOption func(*clientOptions)
+
+// WithProtocol 设置传输协议 默认HTTP1
+func WithProtocol(protocol Protocol) ClientOption {
+	return func(o *clientOptions) {
+		o.protocol = protocol
+	}
+}
+
+// WithTimeout 设置单次请求的总超时 默认15s
+func WithTimeout(timeout time.Duration) ClientOption {
+	return func(o *clientOptions) {
+		o.timeout = timeout
+	}
+}
+
+// WithDialTimeout 设置建连超时 默认3s
+func WithDialTimeout(timeout time.Duration) ClientOption {
+	return func(o *clientOptions) {
+		o.dialTimeout = timeout
+	}
+}
+
+// WithKeepAlive 设置tcp keep-alive周期 默认15s
+func WithKeepAlive(keepAlive time.Duration) ClientOption {
+	return func(o *clientOptions) {
+		o.keepAlive = keepAlive
+	}
+}
+
+// WithMaxIdleConns 设置连接池最大空闲连接数 默认512
+func WithMaxIdleConns(n int) ClientOption {
+	return func(o *clientOptions) {
+		o.maxIdleConns = n
+	}
+}
+
+// WithMaxIdleConnsPerHost 设置每个host最大空闲连接数 默认100
+func WithMaxIdleConnsPerHost(n int) ClientOption {
+	return func(o *clientOptions) {
+		o.maxIdleConnsPerHost = n
+	}
+}
+
+// WithIdleConnTimeout 设置空闲连接回收时间 默认90s
+func WithIdleConnTimeout(timeout time.Duration) ClientOption {
+	return func(o *clientOptions) {
+		o.idleConnTimeout = timeout
+	}
+}
+
+// WithDisableKeepAlives 关闭连接复用
+func WithDisableKeepAlives(disable bool) ClientOption {
+	return func(o *clientOptions) {
+		o.disableKeepAlives = disable
+	}
+}
+
+// WithProxy 设置代理 默认读取环境变量 仅HTTP1生效
+func WithProxy(proxy func(*http.Request) (*url.URL, error)) ClientOption {
+	return func(o *clientOptions) {
+		o.proxy = proxy
+	}
+}
+
+// WithTLSConfig 设置TLS配置 根证书与客户端证书选项在其副本上设置
+func WithTLSConfig(cfg *tls.Config) ClientOption {
+	return func(o *clientOptions) {
+		o.tlsConfig = cfg
+	}
+}
+
+// WithTransport 使用自定义RoundTripper 忽略协议 连接池 代理与TLS相关选项
+func WithTransport(transport http.RoundTripper) ClientOption {
+	return func(o *clientOptions) {
+		o.transport = transport
+	}
+}
+
+// WithAttemptTimeout 设置单次尝试的超时 包括读取响应体 默认不限制
+// 每次重试与对冲请求单独计时 与WithTimeout设置的总超时互不影响
+func WithAttemptTimeout(timeout time.Duration) ClientOption {
+	return func(o *clientOptions) {
+		o.attemptTimeout = timeout
+	}
+}
+
+// WithMaxBodySize 设置读取完整响应体时的最大长度 超过返回ErrBodyTooLarge 默认不限制
+// 不影响ToWriter ToFile Stream等流式读取
+func WithMaxBodySize(n int64) ClientOption {
+	return func(o *clientOptions) {
+		o.maxBodySize = n
+	}
+}
+
+// WithIgnoreStatusError 状态码为400~600时不返回HTTPError
+func WithIgnoreStatusError(ignore bool) ClientOption {
+	return func(o *clientOptions) {
+		o.ignoreStatusError = ignore
+	}
+}
+
+// WithDiscovery 设置svc://地址使用的服务发现
+func WithDiscovery(d *Discovery) ClientOption {
+	return func(o *clientOptions) {
+		o.discovery = d
+	}
+}
+
+// WithAcceptEncoding 设置请求的Accept-Encoding 默认为全部已注册的编码
+// 不传参数时不设置 由底层Transport协商gzip
+func WithAcceptEncoding(encodings ...string) ClientOption {
+	return func(o *clientOptions) {
+		o.acceptEncoding = append([]string{}, encodings...)
+	}
+}
+
+// WithMaxDecodedSize 设置响应体解码后的最大长度 超过返回ErrBodyTooLarge 默认不限制
+// 对流式读取同样生效 用于防止解压炸弹
+func WithMaxDecodedSize(n int64) ClientOption {
+	return func(o *clientOptions) {
+		o.maxDecodedSize = n
+	}
+}
+
+// WithMetrics 设置监控上报 默认使用PrometheusImpl
+func WithMetrics(metrics Prometheus) ClientOption {
+	return func(o *clientOptions) {
+		o.metrics = metrics
+	}
+}
+
+// Client 请求客户端 持有连接池 middleware与监控上报 并发安全
+type Client struct {
+	opts   clientOptions
+	client *http.Client
+	group  singleflight.Group
+
+	// middlewares 写时复制 Use可与发送中的请求并发调用 discovery同样由mu保护
+	mu          sync.RWMutex
+	middlewares []Handler
+	discovery   *Discovery
+}
+
+// NewClient 创建Client
+func NewClient(opts ...ClientOption) *Client {
+	o := clientOptions{
+		protocol:            HTTP1,
+		timeout:             15 * time.Second,
+		dialTimeout:         3 * time.Second,
+		keepAlive:           15 * time.Second,
+		maxIdleConns:        512,
+		maxIdleConnsPerHost: 100,
+		idleConnTimeout:     90 * time.Second,
+		proxy:               http.ProxyFromEnvironment,
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	transport := o.transport
+	if transport == nil {
+		transport = newTransport(&o)
+	}
+
+	return &Client{
+		opts: o,
+		client: &http.Client{
+			Transport: transport,
+			Timeout:   o.timeout,
+		},
+		discovery: o.discovery,
+	}
+}
+
+// NewRequest 创建使用该Client发送的Request
+func (c *Client) NewRequest(uri ...string) Request {
+	result := &FastRequest{
+		client: c,
+		resq: &http.Request{
+			Header: make(http.Header),
+		},
+		params: make(url.Values),
+	}
+	if len(uri) > 0 {
+		result.url = uri[0]
+	}
+	return result
+}
+
+// Use 注册middleware 对该Client之后发出的所有请求生效
+func (c *Client) Use(handle ...Handler) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	middlewares := make([]Handler, 0, len(c.middlewares)+len(handle))
+	middlewares = append(middlewares, c.middlewares...)
+	c.middlewares = append(middlewares, handle...)
+}
+
+// handlers 返回当前注册的middleware 返回的切片不会被修改
+func (c *Client) handlers() []Handler {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.middlewares
+}
+
+// UseDiscovery 为DefaultClient与DefaultH2CClient设置服务发现 可与发送中的请求并发调用
+func UseDiscovery(d *Discovery) {
+	DefaultClient.setDiscovery(d)
+	DefaultH2CClient.setDiscovery(d)
+}
+
+func (c *Client) getDiscovery() *Discovery {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.discovery
+}
+
+func (c *Client) setDiscovery(d *Discovery) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.discovery = d
+}
+
+// HTTPClient 返回底层的http.Client
+func (c *Client) HTTPClient() *http.Client {
+	return c.client
+}
+
+func (c *Client) metrics() Prometheus {
+	if c.opts.metrics != nil {
+		return c.opts.metrics
+	}
+	return PrometheusImpl
+}
@@ -0,0 +1,57 @@
+// Package example httpgen生成的客户端示例
+package example
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"time"
+)
+
+//go:generate go run github.com/Tokumicn/lego-lib/net/http/cmd/httpgen -type UserAPI
+
+// User 用户
+type User struct {
+	ID      int64     `json:"id"`
+	Name    string    `json:"name"`
+	Created time.Time `json:"created"`
+}
+
+// APIError 服务端返回的错误
+type APIError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("user api error %d: %s", e.Code, e.Message)
+}
+
+// UserAPI 用户服务
+// @error APIError
+type UserAPI interface {
+	// GetUser 获取用户
+	// @GET /users/{id}
+	// @name user.get
+	// @header token=X-Token
+	GetUser(ctx context.Context, id int64, token string) (*User, error)
+
+	// ListUsers 按名字查询用户
+	// @GET /users
+	// @query limit=page_size
+	// @retry 3
+	ListUsers(ctx context.Context, names []string, limit *int) ([]User, error)
+
+	// CreateUser 创建用户 不重试
+	// @POST /users
+	// @retry 0
+	CreateUser(ctx context.Context, user *User) (*User, error)
+
+	// DeleteUser 删除用户
+	// @DELETE /users/{id}
+	DeleteUser(ctx context.Context, id int64) error
+
+	// Avatar 下载头像 调用方负责Close
+	// @GET /users/{id}/avatar
+	Avatar(ctx context.Context, id string) (io.ReadCloser, error)
+}
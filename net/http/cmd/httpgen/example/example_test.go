@@ -0,0 +1,107 @@
+package example
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	httpclient "github.com/Tokumicn/lego-lib/net/http"
+)
+
+func TestUserAPIClient(t *testing.T) {
+	var failures int
+	mux := http.NewServeMux()
+	mux.HandleFunc("/users/7", func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == http.MethodDelete:
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"code":404,"message":"no such user"}`))
+		case r.Header.Get("X-Token") != "secret":
+			w.WriteHeader(http.StatusUnauthorized)
+		default:
+			json.NewEncoder(w).Encode(User{ID: 7, Name: "lego"})
+		}
+	})
+	mux.HandleFunc("/users", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPost {
+			var u User
+			json.NewDecoder(r.Body).Decode(&u)
+			u.ID = 8
+			json.NewEncoder(w).Encode(u)
+			return
+		}
+		if failures++; failures < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		var users []User
+		for _, name := range r.URL.Query()["names"] {
+			users = append(users, User{Name: name})
+		}
+		if r.URL.Query().Get("page_size") != "2" {
+			users = nil
+		}
+		json.NewEncoder(w).Encode(users)
+	})
+	mux.HandleFunc("/users/a b/avatar", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("png"))
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	var tags []string
+	client := NewUserAPIClient(srv.URL + "/")
+	client.Middlewares = []httpclient.Handler{func(m httpclient.Middleware) {
+		tags = append(tags, m.GetName())
+	}}
+	ctx := context.Background()
+
+	user, err := client.GetUser(ctx, 7, "secret")
+	if err != nil || user.Name != "lego" {
+		t.Fatalf("GetUser %+v %v", user, err)
+	}
+	if _, err := client.GetUser(ctx, 7, "wrong"); err == nil {
+		t.Error("GetUser without token succeeded")
+	} else if e, ok := httpclient.IsHTTPError(err); !ok || e.StatusCode != http.StatusUnauthorized {
+		t.Errorf("GetUser error %v", err)
+	}
+
+	limit := 2
+	users, err := client.ListUsers(ctx, []string{"a", "b"}, &limit)
+	if err != nil || len(users) != 2 || users[1].Name != "b" {
+		t.Errorf("ListUsers %+v %v", users, err)
+	}
+
+	created, err := client.CreateUser(ctx, &User{Name: "new"})
+	if err != nil || created.ID != 8 || created.Name != "new" {
+		t.Errorf("CreateUser %+v %v", created, err)
+	}
+
+	err = client.DeleteUser(ctx, 7)
+	if e, ok := err.(*APIError); !ok || e.Code != 404 || e.Message != "no such user" {
+		t.Errorf("DeleteUser error %v", err)
+	}
+
+	body, err := client.Avatar(ctx, "a b")
+	if err != nil {
+		t.Fatal(err)
+	}
+	png, _ := ioutil.ReadAll(body)
+	body.Close()
+	if string(png) != "png" {
+		t.Errorf("Avatar %q", png)
+	}
+
+	want := []string{"user.get", "user.get", "UserAPI.ListUsers", "UserAPI.CreateUser", "UserAPI.DeleteUser", "UserAPI.Avatar"}
+	if len(tags) != len(want) {
+		t.Fatalf("tags %v", tags)
+	}
+	for i := range want {
+		if tags[i] != want[i] {
+			t.Errorf("tags %v", tags)
+		}
+	}
+}
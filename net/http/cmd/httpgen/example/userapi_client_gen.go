@@ -0,0 +1,123 @@
+// Code generated by httpgen. DO NOT EDIT.
+
+package example
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"strings"
+
+	httpclient "github.com/Tokumicn/lego-lib/net/http"
+)
+
+// UserAPIClient UserAPI的HTTP实现
+type UserAPIClient struct {
+	// BaseURL 服务地址 支持svc://
+	BaseURL string
+	// Client 发送请求的客户端 为nil时使用httpclient.DefaultClient
+	Client *httpclient.Client
+	// Retry 未通过@retry指定时使用的重试策略 为nil时不重试
+	Retry *httpclient.RetryPolicy
+	// Middlewares 每个请求注册的middleware
+	Middlewares []httpclient.Handler
+}
+
+// NewUserAPIClient 创建UserAPIClient
+func NewUserAPIClient(baseURL string) *UserAPIClient {
+	return &UserAPIClient{BaseURL: baseURL}
+}
+
+var _ UserAPI = (*UserAPIClient)(nil)
+
+func (c *UserAPIClient) newRequest(ctx context.Context, name, path string) httpclient.Request {
+	client := c.Client
+	if client == nil {
+		client = httpclient.DefaultClient
+	}
+	req := client.NewRequest(strings.TrimSuffix(c.BaseURL, "/") + path).SetName(name).Use(c.Middlewares...)
+	if ctx != nil {
+		req.SetContext(ctx)
+	}
+	if c.Retry != nil {
+		req.Retry(c.Retry)
+	}
+	return req
+}
+
+// decodeError 将错误响应体解析为APIError 解析失败时返回原错误
+func (c *UserAPIClient) decodeError(err error) error {
+	if e, ok := httpclient.IsHTTPError(err); ok && len(e.Body) > 0 {
+		apiErr := new(APIError)
+		if json.Unmarshal(e.Body, apiErr) == nil {
+			return apiErr
+		}
+	}
+	return err
+}
+
+// GetUser GET /users/{id}
+func (c *UserAPIClient) GetUser(ctx context.Context, id int64, token string) (*User, error) {
+	req := c.newRequest(ctx, "user.get", "/users/"+url.PathEscape(fmt.Sprint(id))).Get()
+	req.AddHeader("X-Token", token)
+	out := new(User)
+	r := req.ToJSON(out)
+	if r.Error != nil {
+		return nil, c.decodeError(r.Error)
+	}
+	return out, nil
+}
+
+// ListUsers GET /users
+func (c *UserAPIClient) ListUsers(ctx context.Context, names []string, limit *int) ([]User, error) {
+	req := c.newRequest(ctx, "UserAPI.ListUsers", "/users").Get()
+	retry := httpclient.DefaultRetryPolicy()
+	retry.MaxAttempts = 3
+	req.Retry(retry)
+	for _, v := range names {
+		req.SetParam("names", v)
+	}
+	if limit != nil {
+		req.SetParam("page_size", *limit)
+	}
+	var out []User
+	r := req.ToJSON(&out)
+	if r.Error != nil {
+		return nil, c.decodeError(r.Error)
+	}
+	return out, nil
+}
+
+// CreateUser POST /users
+func (c *UserAPIClient) CreateUser(ctx context.Context, user *User) (*User, error) {
+	req := c.newRequest(ctx, "UserAPI.CreateUser", "/users").Post()
+	req.Retry(nil)
+	req.SetJSONBody(user)
+	out := new(User)
+	r := req.ToJSON(out)
+	if r.Error != nil {
+		return nil, c.decodeError(r.Error)
+	}
+	return out, nil
+}
+
+// DeleteUser DELETE /users/{id}
+func (c *UserAPIClient) DeleteUser(ctx context.Context, id int64) error {
+	req := c.newRequest(ctx, "UserAPI.DeleteUser", "/users/"+url.PathEscape(fmt.Sprint(id))).Delete()
+	if _, r := req.ToBytes(); r.Error != nil {
+		return c.decodeError(r.Error)
+	}
+	return nil
+}
+
+// Avatar GET /users/{id}/avatar
+func (c *UserAPIClient) Avatar(ctx context.Context, id string) (io.ReadCloser, error) {
+	req := c.newRequest(ctx, "UserAPI.Avatar", "/users/"+url.PathEscape(id)+"/avatar").Get()
+	out, r := req.Stream()
+	if r.Error != nil {
+		return nil, c.decodeError(r.Error)
+	}
+	return out, nil
+}
@@ -0,0 +1,258 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const clientImport = `httpclient "github.com/Tokumicn/lego-lib/net/http"`
+
+type generator struct {
+	buf bytes.Buffer
+}
+
+func (g *generator) printf(format string, args ...interface{}) {
+	fmt.Fprintf(&g.buf, format, args...)
+}
+
+// generate 生成包pkg中svc的客户端实现
+func generate(pkg string, svc *service) ([]byte, error) {
+	g := &generator{}
+	client := svc.Name + "Client"
+
+	g.printf("// Code generated by httpgen. DO NOT EDIT.\n\n")
+	g.printf("package %s\n\n", pkg)
+	g.printf("import (\n")
+	std := true
+	for _, stmt := range imports(svc) {
+		if std && !isStd(stmt) {
+			std = false
+			g.printf("\n")
+		}
+		g.printf("\t%s\n", stmt)
+	}
+	g.printf(")\n\n")
+
+	g.printf("// %s %s的HTTP实现\n", client, svc.Name)
+	g.printf("type %s struct {\n", client)
+	g.printf("\t// BaseURL 服务地址 支持svc://\n\tBaseURL string\n")
+	g.printf("\t// Client 发送请求的客户端 为nil时使用httpclient.DefaultClient\n\tClient *httpclient.Client\n")
+	g.printf("\t// Retry 未通过@retry指定时使用的重试策略 为nil时不重试\n\tRetry *httpclient.RetryPolicy\n")
+	g.printf("\t// Middlewares 每个请求注册的middleware\n\tMiddlewares []httpclient.Handler\n")
+	g.printf("}\n\n")
+
+	g.printf("// New%s 创建%s\n", client, client)
+	g.printf("func New%s(baseURL string) *%s {\n\treturn &%s{BaseURL: baseURL}\n}\n\n", client, client, client)
+	g.printf("var _ %s = (*%s)(nil)\n\n", svc.Name, client)
+
+	g.printf(`func (c *%s) newRequest(ctx context.Context, name, path string) httpclient.Request {
+	client := c.Client
+	if client == nil {
+		client = httpclient.DefaultClient
+	}
+	req := client.NewRequest(strings.TrimSuffix(c.BaseURL, "/") + path).SetName(name).Use(c.Middlewares...)
+	if ctx != nil {
+		req.SetContext(ctx)
+	}
+	if c.Retry != nil {
+		req.Retry(c.Retry)
+	}
+	return req
+}
+`, client)
+
+	if svc.ErrorType != "" {
+		g.printf(`
+// decodeError 将错误响应体解析为%s 解析失败时返回原错误
+func (c *%s) decodeError(err error) error {
+	if e, ok := httpclient.IsHTTPError(err); ok && len(e.Body) > 0 {
+		apiErr := new(%s)
+		if json.Unmarshal(e.Body, apiErr) == nil {
+			return apiErr
+		}
+	}
+	return err
+}
+`, svc.ErrorType, client, svc.ErrorType)
+	}
+
+	for _, m := range svc.Methods {
+		g.method(svc, client, m)
+	}
+
+	src, err := format.Source(g.buf.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("format generated code: %v\n%s", err, g.buf.Bytes())
+	}
+	return src, nil
+}
+
+func (g *generator) method(svc *service, client string, m *method) {
+	var params []string
+	for _, p := range m.Params {
+		params = append(params, p.Name+" "+p.Type)
+	}
+	results := "error"
+	if m.ResultKind != resultNone {
+		results = "(" + m.Result + ", error)"
+	}
+	ctx := m.Context
+	if ctx == "" {
+		ctx = "nil"
+	}
+
+	g.printf("\n// %s %s %s\n", m.Name, strings.ToUpper(m.HTTPMethod), m.Path)
+	g.printf("func (c *%s) %s(%s) %s {\n", client, m.Name, strings.Join(params, ", "), results)
+	g.printf("\treq := c.newRequest(%s, %q, %s).%s()\n", ctx, m.Tag, pathExpr(m), m.HTTPMethod)
+
+	switch {
+	case m.Retry == 0:
+		g.printf("\treq.Retry(nil)\n")
+	case m.Retry > 0:
+		g.printf("\tretry := httpclient.DefaultRetryPolicy()\n\tretry.MaxAttempts = %d\n\treq.Retry(retry)\n", m.Retry)
+	}
+
+	for _, p := range m.Params {
+		switch p.Bind {
+		case bindQuery:
+			g.value(p, func(v string) string { return fmt.Sprintf("req.SetParam(%q, %s)", p.Key, v) })
+		case bindHeader:
+			g.value(p, func(v string) string { return fmt.Sprintf("req.AddHeader(%q, %s)", p.Key, stringify(p, v)) })
+		case bindForm:
+			g.value(p, func(v string) string { return fmt.Sprintf("req.AddFormField(%q, %s)", p.Key, stringify(p, v)) })
+		case bindBody:
+			if p.Type == "[]byte" {
+				g.printf("\treq.SetBody(%s)\n", p.Name)
+			} else {
+				g.printf("\treq.SetJSONBody(%s)\n", p.Name)
+			}
+		}
+	}
+
+	errExpr := "r.Error"
+	if svc.ErrorType != "" {
+		errExpr = "c.decodeError(r.Error)"
+	}
+	zero := "out"
+	if m.nilable {
+		zero = "nil"
+	}
+	switch m.ResultKind {
+	case resultNone:
+		g.printf("\tif _, r := req.ToBytes(); r.Error != nil {\n\t\treturn %s\n\t}\n\treturn nil\n", errExpr)
+	case resultString:
+		g.printf("\tout, r := req.ToString()\n")
+	case resultBytes:
+		g.printf("\tout, r := req.ToBytes()\n")
+	case resultStream:
+		g.printf("\tout, r := req.Stream()\n")
+	case resultJSON:
+		if strings.HasPrefix(m.Result, "*") {
+			g.printf("\tout := new(%s)\n\tr := req.ToJSON(out)\n", m.Result[1:])
+		} else {
+			g.printf("\tvar out %s\n\tr := req.ToJSON(&out)\n", m.Result)
+		}
+	}
+	if m.ResultKind != resultNone {
+		g.printf("\tif r.Error != nil {\n\t\treturn %s, %s\n\t}\n\treturn out, nil\n", zero, errExpr)
+	}
+	g.printf("}\n")
+}
+
+// value 按参数类型生成设置语句 切片逐个设置 指针为nil时跳过
+func (g *generator) value(p *param, stmt func(v string) string) {
+	switch {
+	case p.Slice:
+		g.printf("\tfor _, v := range %s {\n\t\t%s\n\t}\n", p.Name, stmt("v"))
+	case p.Ptr:
+		g.printf("\tif %s != nil {\n\t\t%s\n\t}\n", p.Name, stmt("*"+p.Name))
+	default:
+		g.printf("\t%s\n", stmt(p.Name))
+	}
+}
+
+func stringify(p *param, v string) string {
+	if p.Type == "string" || p.Type == "*string" || p.Type == "[]string" {
+		return v
+	}
+	return "fmt.Sprint(" + v + ")"
+}
+
+// pathExpr 拼接路径 路径参数经过PathEscape
+func pathExpr(m *method) string {
+	types := make(map[string]string)
+	for _, p := range m.Params {
+		types[p.Name] = p.Type
+	}
+
+	var parts []string
+	last := 0
+	for _, loc := range placeholder.FindAllStringSubmatchIndex(m.Path, -1) {
+		if loc[0] > last {
+			parts = append(parts, strconv.Quote(m.Path[last:loc[0]]))
+		}
+		name := m.Path[loc[2]:loc[3]]
+		value := name
+		if types[name] != "string" {
+			value = "fmt.Sprint(" + name + ")"
+		}
+		parts = append(parts, "url.PathEscape("+value+")")
+		last = loc[1]
+	}
+	if last < len(m.Path) {
+		parts = append(parts, strconv.Quote(m.Path[last:]))
+	}
+	return strings.Join(parts, " + ")
+}
+
+// imports 生成代码用到的import语句
+func imports(svc *service) []string {
+	stmts := map[string]bool{
+		`"context"`:  true,
+		`"strings"`:  true,
+		clientImport: true,
+	}
+	if svc.ErrorType != "" {
+		stmts[`"encoding/json"`] = true
+	}
+	for _, m := range svc.Methods {
+		if strings.Contains(pathExpr(m), "url.PathEscape") {
+			stmts[`"net/url"`] = true
+		}
+		for _, p := range m.Params {
+			if p.Bind == bindPath && p.Type != "string" ||
+				(p.Bind == bindHeader || p.Bind == bindForm) && stringify(p, p.Name) != p.Name {
+				stmts[`"fmt"`] = true
+			}
+		}
+	}
+	for _, stmt := range svc.imports {
+		stmts[stmt] = true
+	}
+
+	var result []string
+	for stmt := range stmts {
+		result = append(result, stmt)
+	}
+	// 标准库在前
+	sort.Slice(result, func(i, j int) bool {
+		if isStd(result[i]) != isStd(result[j]) {
+			return isStd(result[i])
+		}
+		return importPath(result[i]) < importPath(result[j])
+	})
+	return result
+}
+
+func importPath(stmt string) string {
+	return stmt[strings.Index(stmt, `"`):]
+}
+
+func isStd(stmt string) bool {
+	path := strings.Trim(importPath(stmt), `"`)
+	return !strings.Contains(strings.SplitN(path, "/", 2)[0], ".")
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"bytes"
+	"go/parser"
+	"go/token"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+// example中的生成代码需与当前生成器的输出一致 修改生成器后执行go generate ./...
+func TestGenerateExample(t *testing.T) {
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, "example/api.go", nil, parser.ParseComments)
+	if err != nil {
+		t.Fatal(err)
+	}
+	svc, err := parseService(fset, f, "UserAPI")
+	if err != nil {
+		t.Fatal(err)
+	}
+	src, err := generate(f.Name.Name, svc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	golden, err := ioutil.ReadFile("example/userapi_client_gen.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(src, golden) {
+		t.Errorf("example/userapi_client_gen.go is stale, run go generate ./...")
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	cases := map[string]string{
+		"missing method": `
+			Get(id int) error`,
+		"unnamed params": `
+			// @GET /users
+			Get(int) error`,
+		"path param": `
+			// @GET /users/{id}
+			Get(name string) error`,
+		"unknown directive param": `
+			// @GET /users
+			// @header token=X-Token
+			Get(id int) error`,
+		"body on GET": `
+			// @GET /users
+			// @body user
+			Get(user string) error`,
+		"results": `
+			// @GET /users
+			Get() (int, string)`,
+		"variadic": `
+			// @GET /users
+			Get(ids ...int) error`,
+	}
+	for name, methods := range cases {
+		src := "package p\ntype API interface {" + methods + "\n}"
+		fset := token.NewFileSet()
+		f, err := parser.ParseFile(fset, "api.go", src, parser.ParseComments)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := parseService(fset, f, "API"); err == nil {
+			t.Errorf("%s: expected error", name)
+		} else if !strings.Contains(err.Error(), "API.Get") {
+			t.Errorf("%s: error without method name %v", name, err)
+		}
+	}
+}
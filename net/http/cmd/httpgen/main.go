@@ -0,0 +1,78 @@
+// httpgen 根据带注释指令的接口生成基于Request的客户端实现
+//
+// 用法 在接口所在文件中添加
+//
+//	//go:generate go run github.com/Tokumicn/lego-lib/net/http/cmd/httpgen -type UserAPI
+//
+// 接口注释支持
+//
+//	@error Type         错误响应体解析为*Type返回 *Type需实现error
+//
+// 方法注释支持
+//
+//	@GET /users/{id}    请求方法与路径 支持GET POST PUT DELETE HEAD {id}绑定同名参数
+//	@name tag           SetName标签 默认为接口名.方法名
+//	@retry n            最大尝试次数 0表示不重试 默认使用客户端的Retry
+//	@query param[=key]  查询参数 GET DELETE HEAD中未绑定的参数默认为查询参数
+//	@header param=Key   请求头
+//	@form param[=field] 表单字段
+//	@body param         JSON请求体 []byte类型直接发送 POST PUT中第一个未绑定的参数默认为请求体
+//
+// context.Context参数通过SetContext传递 返回值为error或(T, error)
+// T为string []byte io.ReadCloser时不解析JSON
+package main
+
+import (
+	"flag"
+	"fmt"
+	"go/parser"
+	"go/token"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+func main() {
+	typeName := flag.String("type", "", "interface name, comma separated for multiple")
+	output := flag.String("output", "", "output file, default <type>_client_gen.go next to the source file")
+	file := flag.String("file", os.Getenv("GOFILE"), "source file containing the interface, default $GOFILE")
+	flag.Parse()
+
+	if *typeName == "" || *file == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+	names := strings.Split(*typeName, ",")
+	if len(names) > 1 && *output != "" {
+		fmt.Fprintln(os.Stderr, "httpgen: -output cannot be used with multiple types")
+		os.Exit(2)
+	}
+	for _, name := range names {
+		out := *output
+		if out == "" {
+			out = filepath.Join(filepath.Dir(*file), strings.ToLower(name)+"_client_gen.go")
+		}
+		if err := run(*file, name, out); err != nil {
+			fmt.Fprintln(os.Stderr, "httpgen:", err)
+			os.Exit(1)
+		}
+	}
+}
+
+func run(file, name, output string) error {
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, file, nil, parser.ParseComments)
+	if err != nil {
+		return err
+	}
+	svc, err := parseService(fset, f, strings.TrimSpace(name))
+	if err != nil {
+		return err
+	}
+	src, err := generate(f.Name.Name, svc)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(output, src, 0644)
+}
@@ -0,0 +1,353 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/printer"
+	"go/token"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// 参数绑定位置
+const (
+	bindQuery = iota
+	bindPath
+	bindHeader
+	bindForm
+	bindBody
+	bindContext
+)
+
+// 返回值解析方式
+const (
+	resultNone = iota
+	resultJSON
+	resultString
+	resultBytes
+	resultStream
+)
+
+var methods = map[string]string{
+	"GET":    "Get",
+	"POST":   "Post",
+	"PUT":    "Put",
+	"DELETE": "Delete",
+	"HEAD":   "Head",
+}
+
+var placeholder = regexp.MustCompile(`\{(\w+)\}`)
+
+type service struct {
+	Name string
+	// ErrorType @error指定的错误响应体类型 *ErrorType需实现error
+	ErrorType string
+	Methods   []*method
+	// imports 参数与返回值类型引用的包 包名到import语句
+	imports map[string]string
+}
+
+type method struct {
+	Name       string
+	HTTPMethod string
+	Path       string
+	Tag        string
+	// Retry @retry指定的最大尝试次数 -1表示未指定
+	Retry      int
+	Params     []*param
+	Context    string
+	Result     string
+	ResultKind int
+	// nilable 返回值类型可为nil 出错时返回nil
+	nilable bool
+}
+
+type param struct {
+	Name  string
+	Type  string
+	Bind  int
+	Key   string
+	Slice bool
+	Ptr   bool
+}
+
+// parseService 解析接口及其方法上的注释指令
+func parseService(fset *token.FileSet, file *ast.File, name string) (*service, error) {
+	var spec *ast.TypeSpec
+	var doc *ast.CommentGroup
+	for _, decl := range file.Decls {
+		gen, ok := decl.(*ast.GenDecl)
+		if !ok || gen.Tok != token.TYPE {
+			continue
+		}
+		for _, s := range gen.Specs {
+			if ts := s.(*ast.TypeSpec); ts.Name.Name == name {
+				spec, doc = ts, ts.Doc
+				if doc == nil {
+					doc = gen.Doc
+				}
+			}
+		}
+	}
+	if spec == nil {
+		return nil, fmt.Errorf("type %s not found", name)
+	}
+	it, ok := spec.Type.(*ast.InterfaceType)
+	if !ok {
+		return nil, fmt.Errorf("%s is not an interface", name)
+	}
+
+	svc := &service{Name: name, imports: make(map[string]string)}
+	for _, d := range directives(doc) {
+		switch d[0] {
+		case "@error":
+			if len(d) != 2 {
+				return nil, fmt.Errorf("%s: usage @error TypeName", name)
+			}
+			svc.ErrorType = d[1]
+		}
+	}
+
+	imports := fileImports(file)
+	for _, field := range it.Methods.List {
+		ft, ok := field.Type.(*ast.FuncType)
+		if !ok {
+			return nil, fmt.Errorf("%s: embedded interfaces are not supported", name)
+		}
+		for _, ident := range field.Names {
+			m, err := parseMethod(fset, ident.Name, ft, field.Doc, svc)
+			if err != nil {
+				return nil, fmt.Errorf("%s.%s: %v", name, ident.Name, err)
+			}
+			svc.Methods = append(svc.Methods, m)
+		}
+		collectImports(ft, imports, svc.imports)
+	}
+	return svc, nil
+}
+
+func parseMethod(fset *token.FileSet, name string, ft *ast.FuncType, doc *ast.CommentGroup, svc *service) (*method, error) {
+	m := &method{Name: name, Retry: -1, Tag: svc.Name + "." + name}
+	binds := make(map[string]*param)
+	var body string
+	for _, d := range directives(doc) {
+		if httpMethod, ok := methods[strings.ToUpper(strings.TrimPrefix(d[0], "@"))]; ok {
+			if len(d) != 2 || !strings.HasPrefix(d[1], "/") {
+				return nil, fmt.Errorf("usage %s /path/{param}", d[0])
+			}
+			m.HTTPMethod, m.Path = httpMethod, d[1]
+			continue
+		}
+		switch d[0] {
+		case "@name":
+			if len(d) != 2 {
+				return nil, fmt.Errorf("usage @name tag")
+			}
+			m.Tag = d[1]
+		case "@retry":
+			n, err := strconv.Atoi(d[len(d)-1])
+			if len(d) != 2 || err != nil || n < 0 {
+				return nil, fmt.Errorf("usage @retry maxAttempts")
+			}
+			m.Retry = n
+		case "@query", "@header", "@form":
+			if len(d) != 2 {
+				return nil, fmt.Errorf("usage %s param[=key]", d[0])
+			}
+			p := &param{Bind: bindQuery}
+			if d[0] == "@header" {
+				p.Bind = bindHeader
+			} else if d[0] == "@form" {
+				p.Bind = bindForm
+			}
+			kv := strings.SplitN(d[1], "=", 2)
+			p.Name, p.Key = kv[0], kv[0]
+			if len(kv) == 2 {
+				p.Key = kv[1]
+			}
+			binds[p.Name] = p
+		case "@body":
+			if len(d) != 2 {
+				return nil, fmt.Errorf("usage @body param")
+			}
+			body = d[1]
+		}
+	}
+	if m.HTTPMethod == "" {
+		return nil, fmt.Errorf("missing @GET/@POST/@PUT/@DELETE/@HEAD directive")
+	}
+
+	inPath := make(map[string]bool)
+	for _, match := range placeholder.FindAllStringSubmatch(m.Path, -1) {
+		inPath[match[1]] = true
+	}
+
+	for _, field := range ft.Params.List {
+		if len(field.Names) == 0 {
+			return nil, fmt.Errorf("parameters must be named")
+		}
+		if _, ok := field.Type.(*ast.Ellipsis); ok {
+			return nil, fmt.Errorf("variadic parameters are not supported")
+		}
+		typ := exprString(fset, field.Type)
+		for _, ident := range field.Names {
+			p := &param{Name: ident.Name, Key: ident.Name, Type: typ}
+			if typ == "context.Context" {
+				m.Context, p.Bind = p.Name, bindContext
+				m.Params = append(m.Params, p)
+				continue
+			}
+			switch t := field.Type.(type) {
+			case *ast.ArrayType:
+				p.Slice = t.Len == nil && typ != "[]byte"
+			case *ast.StarExpr:
+				p.Ptr = true
+			}
+
+			switch b := binds[p.Name]; {
+			case inPath[p.Name]:
+				p.Bind = bindPath
+				delete(inPath, p.Name)
+			case b != nil:
+				p.Bind, p.Key = b.Bind, b.Key
+				delete(binds, p.Name)
+			case p.Name == body || (body == "" && hasBody(m.HTTPMethod) && !bound(m.Params, bindBody)):
+				p.Bind = bindBody
+				if p.Name == body {
+					body = ""
+				}
+			default:
+				p.Bind = bindQuery
+			}
+			m.Params = append(m.Params, p)
+		}
+	}
+	for name := range inPath {
+		return nil, fmt.Errorf("path parameter {%s} has no matching argument", name)
+	}
+	for name := range binds {
+		return nil, fmt.Errorf("directive refers to unknown parameter %s", name)
+	}
+	if body != "" {
+		return nil, fmt.Errorf("@body refers to unknown parameter %s", body)
+	}
+	if bound(m.Params, bindBody) && bound(m.Params, bindForm) {
+		return nil, fmt.Errorf("@form and request body cannot be used together")
+	}
+	if bound(m.Params, bindBody) && !hasBody(m.HTTPMethod) {
+		return nil, fmt.Errorf("%s request cannot have a body", strings.ToUpper(m.HTTPMethod))
+	}
+
+	return m, parseResults(fset, m, ft.Results)
+}
+
+func parseResults(fset *token.FileSet, m *method, results *ast.FieldList) error {
+	var types []ast.Expr
+	if results != nil {
+		for _, field := range results.List {
+			n := len(field.Names)
+			if n == 0 {
+				n = 1
+			}
+			for i := 0; i < n; i++ {
+				types = append(types, field.Type)
+			}
+		}
+	}
+	if len(types) == 0 || len(types) > 2 || exprString(fset, types[len(types)-1]) != "error" {
+		return fmt.Errorf("results must be (error) or (T, error)")
+	}
+	if len(types) == 1 {
+		m.ResultKind = resultNone
+		return nil
+	}
+
+	m.Result = exprString(fset, types[0])
+	switch m.Result {
+	case "string":
+		m.ResultKind = resultString
+	case "[]byte":
+		m.ResultKind, m.nilable = resultBytes, true
+	case "io.ReadCloser":
+		m.ResultKind, m.nilable = resultStream, true
+	default:
+		m.ResultKind = resultJSON
+		switch types[0].(type) {
+		case *ast.StarExpr, *ast.ArrayType, *ast.MapType:
+			m.nilable = true
+		}
+	}
+	if m.ResultKind == resultStream && m.HTTPMethod == "Head" {
+		return fmt.Errorf("HEAD request has no body to stream")
+	}
+	return nil
+}
+
+func hasBody(httpMethod string) bool {
+	return httpMethod == "Post" || httpMethod == "Put"
+}
+
+func bound(params []*param, bind int) bool {
+	for _, p := range params {
+		if p.Bind == bind {
+			return true
+		}
+	}
+	return false
+}
+
+// directives 返回注释中以@开头的行 按空白分割
+func directives(doc *ast.CommentGroup) [][]string {
+	if doc == nil {
+		return nil
+	}
+	var result [][]string
+	for _, line := range strings.Split(doc.Text(), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) > 0 && strings.HasPrefix(fields[0], "@") {
+			result = append(result, fields)
+		}
+	}
+	return result
+}
+
+func exprString(fset *token.FileSet, expr ast.Expr) string {
+	var buf bytes.Buffer
+	printer.Fprint(&buf, fset, expr)
+	return buf.String()
+}
+
+// fileImports 包名到import语句 未指定别名时取路径最后一段
+func fileImports(file *ast.File) map[string]string {
+	imports := make(map[string]string)
+	for _, spec := range file.Imports {
+		importPath, _ := strconv.Unquote(spec.Path.Value)
+		name := path.Base(importPath)
+		stmt := strconv.Quote(importPath)
+		if spec.Name != nil {
+			name = spec.Name.Name
+			stmt = name + " " + stmt
+		}
+		imports[name] = stmt
+	}
+	return imports
+}
+
+// collectImports 记录方法签名中引用的包
+func collectImports(ft *ast.FuncType, imports, used map[string]string) {
+	ast.Inspect(ft, func(n ast.Node) bool {
+		sel, ok := n.(*ast.SelectorExpr)
+		if !ok {
+			return true
+		}
+		if ident, ok := sel.X.(*ast.Ident); ok {
+			if stmt, ok := imports[ident.Name]; ok {
+				used[ident.Name] = stmt
+			}
+		}
+		return false
+	})
+}
@@ -0,0 +1,307 @@
+package http
+
+import (
+	"bufio"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/zstd"
+)
+
+// Codec 内容编码 Name为Content-Encoding中的取值
+type Codec interface {
+	Name() string
+	NewReader(r io.Reader) (io.ReadCloser, error)
+	NewWriter(w io.Writer) (io.WriteCloser, error)
+}
+
+// 内置编码
+var (
+	Gzip    Codec = gzipCodec{}
+	Deflate Codec = deflateCodec{}
+	Brotli  Codec = brotliCodec{}
+	Zstd    Codec = zstdCodec{}
+)
+
+var (
+	codecsMu sync.RWMutex
+	codecs   = map[string]Codec{}
+	// 默认Accept-Encoding 按注册顺序
+	acceptEncodings []string
+)
+
+func init() {
+	RegisterCodec(Gzip)
+	RegisterCodec(Deflate)
+	RegisterCodec(Brotli)
+	RegisterCodec(Zstd)
+}
+
+// RegisterCodec 注册编码 用于解码响应与默认的Accept-Encoding
+func RegisterCodec(c Codec) {
+	codecsMu.Lock()
+	defer codecsMu.Unlock()
+	if _, ok := codecs[c.Name()]; !ok {
+		acceptEncodings = append(acceptEncodings, c.Name())
+	}
+	codecs[c.Name()] = c
+}
+
+// GetCodec 按Content-Encoding取值获取编码
+func GetCodec(name string) (Codec, bool) {
+	codecsMu.RLock()
+	defer codecsMu.RUnlock()
+	c, ok := codecs[strings.ToLower(strings.TrimSpace(name))]
+	return c, ok
+}
+
+func defaultAcceptEncoding() string {
+	codecsMu.RLock()
+	defer codecsMu.RUnlock()
+	return strings.Join(acceptEncodings, ", ")
+}
+
+// SetCompressedBody 发送前以codec流式压缩请求体并设置Content-Encoding
+func (fr *FastRequest) SetCompressedBody(codec Codec) Request {
+	fr.compress = codec
+	return fr
+}
+
+// prepareEncoding 设置Accept-Encoding并压缩请求体
+// Range请求不协商编码 避免续传时偏移量对应压缩后的内容
+func (fr *FastRequest) prepareEncoding() {
+	accept := fr.client.opts.acceptEncoding
+	if accept == nil {
+		accept = []string{defaultAcceptEncoding()}
+	}
+	if value := strings.Join(accept, ", "); value != "" &&
+		fr.resq.Header.Get("Accept-Encoding") == "" && fr.resq.Header.Get("Range") == "" {
+		fr.resq.Header.Set("Accept-Encoding", value)
+	}
+
+	if fr.compress == nil || fr.resq.Body == nil || fr.resq.Body == http.NoBody {
+		return
+	}
+	codec := fr.compress
+	body, getBody := fr.resq.Body, fr.resq.GetBody
+	open := func(src io.ReadCloser) func() (io.ReadCloser, error) {
+		return func() (io.ReadCloser, error) {
+			return compressBody(codec, src), nil
+		}
+	}
+
+	fr.resq.Header.Set("Content-Encoding", codec.Name())
+	fr.resq.ContentLength = -1
+	fr.resq.Body = &lazyBody{open: open(body)}
+	fr.resq.GetBody = nil
+	if getBody != nil {
+		fr.resq.GetBody = func() (io.ReadCloser, error) {
+			src, err := getBody()
+			if err != nil {
+				return nil, err
+			}
+			return &lazyBody{open: open(src)}, nil
+		}
+	}
+}
+
+// compressBody 通过管道边读边压缩
+func compressBody(codec Codec, src io.ReadCloser) io.ReadCloser {
+	pr, pw := io.Pipe()
+	go func() {
+		defer src.Close()
+		w, err := codec.NewWriter(pw)
+		if err != nil {
+			pw.CloseWithError(err)
+			return
+		}
+		if _, err := io.Copy(w, src); err != nil {
+			w.Close()
+			pw.CloseWithError(err)
+			return
+		}
+		pw.CloseWithError(w.Close())
+	}()
+	return pr
+}
+
+// decodeBody 按Content-Encoding逆序解码 limit大于0时解码后超过limit返回ErrBodyTooLarge
+func decodeBody(body io.ReadCloser, contentEncoding string, limit int64) (io.ReadCloser, error) {
+	var encodings []string
+	for _, name := range strings.Split(contentEncoding, ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name != "" && name != "identity" {
+			encodings = append(encodings, name)
+		}
+	}
+	if len(encodings) == 0 {
+		return body, nil
+	}
+
+	var reader io.Reader = body
+	var decoders []io.Closer
+	for i := len(encodings) - 1; i >= 0; i-- {
+		codec, ok := GetCodec(encodings[i])
+		if !ok {
+			closeAll(decoders)
+			body.Close()
+			return nil, fmt.Errorf("http: unsupported Content-Encoding %q", encodings[i])
+		}
+		var decoder io.ReadCloser
+		var err error
+		if lc, ok := codec.(limitedCodec); ok && limit > 0 {
+			decoder, err = lc.newLimitedReader(reader, limit)
+		} else {
+			decoder, err = codec.NewReader(reader)
+		}
+		if err != nil {
+			closeAll(decoders)
+			body.Close()
+			return nil, err
+		}
+		decoders = append(decoders, decoder)
+		reader = decoder
+	}
+	if limit > 0 {
+		reader = &limitedReader{r: reader, n: limit}
+	}
+	return &decodedBody{Reader: reader, decoders: decoders, body: body}, nil
+}
+
+type decodedBody struct {
+	io.Reader
+	decoders []io.Closer
+	body     io.Closer
+}
+
+func (d *decodedBody) Close() error {
+	closeAll(d.decoders)
+	return d.body.Close()
+}
+
+func closeAll(closers []io.Closer) {
+	for i := len(closers) - 1; i >= 0; i-- {
+		closers[i].Close()
+	}
+}
+
+// limitedCodec 可按解码大小上限限制解码内存的编码
+type limitedCodec interface {
+	newLimitedReader(r io.Reader, limit int64) (io.ReadCloser, error)
+}
+
+// limitedReader 超过n字节时返回ErrBodyTooLarge 防止解压炸弹
+type limitedReader struct {
+	r io.Reader
+	n int64
+}
+
+func (l *limitedReader) Read(p []byte) (int, error) {
+	if l.n < 0 {
+		return 0, ErrBodyTooLarge
+	}
+	// 多读1字节以区分恰好读完与超出
+	if int64(len(p)) > l.n+1 {
+		p = p[:l.n+1]
+	}
+	n, err := l.r.Read(p)
+	l.n -= int64(n)
+	if l.n < 0 {
+		return n + int(l.n), ErrBodyTooLarge
+	}
+	return n, err
+}
+
+type gzipCodec struct{}
+
+func (gzipCodec) Name() string { return "gzip" }
+
+func (gzipCodec) NewReader(r io.Reader) (io.ReadCloser, error) {
+	return gzip.NewReader(r)
+}
+
+func (gzipCodec) NewWriter(w io.Writer) (io.WriteCloser, error) {
+	return gzip.NewWriter(w), nil
+}
+
+// deflateCodec HTTP中的deflate为zlib格式 兼容直接发送raw deflate的服务端
+type deflateCodec struct{}
+
+func (deflateCodec) Name() string { return "deflate" }
+
+func (deflateCodec) NewReader(r io.Reader) (io.ReadCloser, error) {
+	br := bufio.NewReader(r)
+	header, err := br.Peek(2)
+	if err == nil && header[0]&0x0f == 8 && (uint16(header[0])<<8|uint16(header[1]))%31 == 0 {
+		return zlib.NewReader(br)
+	}
+	return flate.NewReader(br), nil
+}
+
+func (deflateCodec) NewWriter(w io.Writer) (io.WriteCloser, error) {
+	return zlib.NewWriter(w), nil
+}
+
+type brotliCodec struct{}
+
+func (brotliCodec) Name() string { return "br" }
+
+func (brotliCodec) NewReader(r io.Reader) (io.ReadCloser, error) {
+	return ioutil.NopCloser(brotli.NewReader(r)), nil
+}
+
+func (brotliCodec) NewWriter(w io.Writer) (io.WriteCloser, error) {
+	return brotli.NewWriter(w), nil
+}
+
+// zstdMaxWindow HTTP中zstd编码的窗口不超过8MB(RFC 9659) 拒绝声明更大窗口的帧
+const zstdMaxWindow = 8 << 20
+
+type zstdCodec struct{}
+
+func (zstdCodec) Name() string { return "zstd" }
+
+func (c zstdCodec) NewReader(r io.Reader) (io.ReadCloser, error) {
+	return c.newLimitedReader(r, 0)
+}
+
+// newLimitedReader 窗口与解码内存不超过limit 避免很小的帧声明巨大的窗口 超出时返回ErrBodyTooLarge
+func (zstdCodec) newLimitedReader(r io.Reader, limit int64) (io.ReadCloser, error) {
+	window := uint64(zstdMaxWindow)
+	if limit > 0 && uint64(limit) < window {
+		window = uint64(limit)
+	}
+	if window < zstd.MinWindowSize {
+		window = zstd.MinWindowSize
+	}
+	d, err := zstd.NewReader(r, zstd.WithDecoderConcurrency(1),
+		zstd.WithDecoderMaxWindow(window), zstd.WithDecoderMaxMemory(window))
+	if err != nil {
+		return nil, err
+	}
+	return zstdReader{d.IOReadCloser()}, nil
+}
+
+type zstdReader struct {
+	io.ReadCloser
+}
+
+func (z zstdReader) Read(p []byte) (int, error) {
+	n, err := z.ReadCloser.Read(p)
+	if err == zstd.ErrWindowSizeExceeded || err == zstd.ErrDecoderSizeExceeded {
+		err = ErrBodyTooLarge
+	}
+	return n, err
+}
+
+func (zstdCodec) NewWriter(w io.Writer) (io.WriteCloser, error) {
+	return zstd.NewWriter(w)
+}
@@ -0,0 +1,76 @@
+package http
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestContentEncoding(t *testing.T) {
+	content := strings.Repeat("lego-lib ", 1000)
+	for _, codec := range []Codec{Gzip, Deflate, Brotli, Zstd} {
+		codec := codec
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !strings.Contains(r.Header.Get("Accept-Encoding"), codec.Name()) {
+				t.Errorf("Accept-Encoding %q", r.Header.Get("Accept-Encoding"))
+			}
+			w.Header().Set("Content-Encoding", codec.Name())
+			cw, _ := codec.NewWriter(w)
+			cw.Write([]byte(content))
+			cw.Close()
+		}))
+
+		body, r := NewClient().NewRequest(srv.URL).ToString()
+		if r.Error != nil || body != content {
+			t.Errorf("%s got %d bytes %v", codec.Name(), len(body), r.Error)
+		}
+		if _, r := NewClient(WithMaxDecodedSize(100)).NewRequest(srv.URL).ToString(); r.Error != ErrBodyTooLarge {
+			t.Errorf("%s bomb got %v", codec.Name(), r.Error)
+		}
+		srv.Close()
+	}
+}
+
+func TestCompressedBody(t *testing.T) {
+	content := strings.Repeat("upload ", 1000)
+	var calls int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if calls == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		reader, err := decodeBody(r.Body, r.Header.Get("Content-Encoding"), 0)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		body, _ := ioutil.ReadAll(reader)
+		if !bytes.Equal(body, []byte(content)) || r.Header.Get("Content-Encoding") != "zstd" {
+			w.WriteHeader(http.StatusBadRequest)
+		}
+	}))
+	defer srv.Close()
+
+	r := NewClient().NewRequest(srv.URL).Post().Retry(&RetryPolicy{MaxAttempts: 2, RetryNonIdempotent: true}).
+		SetBody([]byte(content)).SetCompressedBody(Zstd).ToJSON(new(interface{}))
+	if r.StatusCode != http.StatusOK || calls != 2 {
+		t.Errorf("got %d %v calls %d", r.StatusCode, r.Error, calls)
+	}
+}
+
+// TestZstdWindow 只有几字节的帧声明256MB窗口 按超过解码上限处理
+func TestZstdWindow(t *testing.T) {
+	frame := []byte{0x28, 0xb5, 0x2f, 0xfd, 0x00, 0x90, 0x09, 0x00, 0x00, 'a'}
+	body, err := decodeBody(ioutil.NopCloser(bytes.NewReader(frame)), "zstd", 1<<20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer body.Close()
+	if _, err := ioutil.ReadAll(body); err != ErrBodyTooLarge {
+		t.Errorf("large window got %v", err)
+	}
+}
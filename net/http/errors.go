@@ -0,0 +1,59 @@
+package http
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+)
+
+// 未设置最大长度时错误响应体最多保留的字节数
+const maxErrorBodySize = 64 << 10
+
+// HTTPError 响应状态码为400~600时返回的错误 保留状态码 响应头与响应体
+type HTTPError struct {
+	StatusCode int
+	Status     string
+	Header     http.Header
+	// Body 解码后的响应体 超过最大长度时被截断
+	Body []byte
+}
+
+// Error 保持与之前版本相同的错误信息
+func (e *HTTPError) Error() string {
+	return fmt.Sprintf("The FastRequested URL returned error: %d", e.StatusCode)
+}
+
+// IsHTTPError err为*HTTPError时返回该错误
+func IsHTTPError(err error) (*HTTPError, bool) {
+	e, ok := err.(*HTTPError)
+	return e, ok
+}
+
+// IgnoreStatusError 状态码为400~600时不返回HTTPError 由调用方根据Response.StatusCode处理
+func (fr *FastRequest) IgnoreStatusError() Request {
+	fr.ignoreStatusError = true
+	return fr
+}
+
+// statusError 读取错误响应体并生成HTTPError 读取失败时Body为空
+func (fr *FastRequest) statusError() error {
+	e := &HTTPError{
+		StatusCode: fr.resp.StatusCode,
+		Status:     fr.resp.Status,
+		Header:     fr.resp.Header,
+	}
+
+	reader, err := fr.bodyReader()
+	if err != nil {
+		return e
+	}
+	defer reader.Close()
+
+	limit := fr.bodyLimit()
+	if limit <= 0 {
+		limit = maxErrorBodySize
+	}
+	e.Body, _ = ioutil.ReadAll(io.LimitReader(reader, limit))
+	return e
+}
@@ -0,0 +1,41 @@
+package http
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestHTTPError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Request-Id", "abc")
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(`{"code":1001,"message":"invalid name"}`))
+	}))
+	defer srv.Close()
+
+	var ok struct{ Name string }
+	var errBody struct {
+		Code    int
+		Message string
+	}
+	r := NewClient().NewRequest(srv.URL).ToJSONWithError(&ok, &errBody)
+	e, is := IsHTTPError(r.Error)
+	if !is {
+		t.Fatalf("got %v", r.Error)
+	}
+	if e.StatusCode != http.StatusBadRequest || e.Header.Get("X-Request-Id") != "abc" || r.StatusCode != http.StatusBadRequest {
+		t.Errorf("got %+v %+v", e, r)
+	}
+	if errBody.Code != 1001 || errBody.Message != "invalid name" {
+		t.Errorf("error body %+v", errBody)
+	}
+
+	body, r := NewClient().NewRequest(srv.URL).IgnoreStatusError().ToString()
+	if r.Error != nil || r.StatusCode != http.StatusBadRequest || body == "" {
+		t.Errorf("ignore status got %q %+v", body, r)
+	}
+	if _, r := NewClient(WithIgnoreStatusError(true)).NewRequest(srv.URL).ToBytes(); r.Error != nil {
+		t.Errorf("client ignore status got %v", r.Error)
+	}
+}
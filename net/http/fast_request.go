@@ -2,70 +2,29 @@ package http
 
 import (
 	"bytes"
-	"compress/gzip"
 	"context"
 	"encoding/json"
 	"encoding/xml"
 	"errors"
 	"fmt"
+	"io"
 	"io/ioutil"
-	"net"
 	"net/http"
 	"net/url"
 	"strconv"
 	"time"
 
-	"golang.org/x/sync/singleflight"
+	"github.com/Tokumicn/lego-lib/tracing"
 )
 
-var (
-	Fastclient      *http.Client
-	fastclientGroup singleflight.Group
-)
-
-func init() {
-	NewFastClient(15*time.Second, 512, false)
-}
-
-// Newhttpclient .
-func NewFastClient(rwTimeout time.Duration, MaxIdleConns int, disableKeepAlives bool) {
-	tran := &http.Transport{
-		Proxy: http.ProxyFromEnvironment,
-		DialContext: (&net.Dialer{
-			Timeout:   3 * time.Second,
-			KeepAlive: 15 * time.Second,
-			DualStack: true,
-		}).DialContext,
-		MaxIdleConns:          MaxIdleConns,
-		IdleConnTimeout:       90 * time.Second,
-		TLSHandshakeTimeout:   10 * time.Second,
-		ExpectContinueTimeout: 1 * time.Second,
-		MaxIdleConnsPerHost:   100,
-		DisableKeepAlives:     disableKeepAlives,
-	}
-
-	Fastclient = &http.Client{
-		Transport: tran,
-		Timeout:   rwTimeout,
-	}
-}
-
-// NewFastRequest .
+// NewFastRequest 使用DefaultClient创建Request
 func NewFastRequest(uri ...string) Request {
-	result := new(FastRequest)
-	req := &http.Request{
-		Header: make(http.Header),
-	}
-	result.resq = req
-	result.params = make(url.Values)
-	if len(uri) > 0 {
-		result.url = uri[0]
-	}
-	return result
+	return DefaultClient.NewRequest(uri...)
 }
 
 // FastRequest .
 type FastRequest struct {
+	client          *Client
 	resq            *http.Request
 	resp            *http.Response
 	reqe            error
@@ -75,6 +34,26 @@ type FastRequest struct {
 	name            string
 	responseError   error
 	stop            bool
+	retry           *RetryPolicy
+	attempt         int
+	maxBodySize     int64
+	form            url.Values
+	files           []formFile
+	progress        func(sent, total int64)
+
+	ignoreStatusError bool
+	service           string
+	balanceKey        string
+	hedgeAfter        time.Duration
+	hedgeMax          int
+	attemptTimeout    time.Duration
+	middlewares       []Handler
+	chain             chain
+	duration          time.Duration
+	compress          Codec
+
+	// attemptHooks 每次尝试发送前对该次请求执行 包括重试与对冲请求
+	attemptHooks []func(*http.Request) error
 }
 
 // SetURL .
@@ -127,20 +106,39 @@ func (fr *FastRequest) SetJSONBody(obj interface{}) Request {
 		return fr
 	}
 
-	fr.resq.Body = ioutil.NopCloser(bytes.NewReader(byts))
-	fr.resq.ContentLength = int64(len(byts))
+	fr.setBody(byts)
 	fr.resq.Header.Set("Content-Type", "application/json")
 	return fr
 }
 
 // SetBody .
 func (fr *FastRequest) SetBody(byts []byte) Request {
-	fr.resq.Body = ioutil.NopCloser(bytes.NewReader(byts))
-	fr.resq.ContentLength = int64(len(byts))
+	fr.setBody(byts)
 	fr.resq.Header.Set("Content-Type", "application/x-www-form-urlencoded")
 	return fr
 }
 
+// setBody GetBody保证重试时可以重新读取请求体
+func (fr *FastRequest) setBody(byts []byte) {
+	fr.resq.GetBody = func() (io.ReadCloser, error) {
+		return ioutil.NopCloser(bytes.NewReader(byts)), nil
+	}
+	fr.resq.Body, _ = fr.resq.GetBody()
+	fr.resq.ContentLength = int64(len(byts))
+}
+
+// SetMaxBodySize 设置ToJSON ToBytes等读取完整响应体时的最大长度 优先于WithMaxBodySize
+func (fr *FastRequest) SetMaxBodySize(n int64) Request {
+	fr.maxBodySize = n
+	return fr
+}
+
+// Retry 设置重试策略 nil表示不重试
+func (fr *FastRequest) Retry(policy *RetryPolicy) Request {
+	fr.retry = policy
+	return fr
+}
+
 // ToJSON .
 func (fr *FastRequest) ToJSON(obj interface{}) (r Response) {
 	var body []byte
@@ -155,6 +153,27 @@ func (fr *FastRequest) ToJSON(obj interface{}) (r Response) {
 	return
 }
 
+// ToJSONWithError 状态码正常时解析到ok 返回HTTPError时将错误响应体解析到errBody
+// 错误响应体解析失败时r.Error仍为HTTPError
+func (fr *FastRequest) ToJSONWithError(ok, errBody interface{}) (r Response) {
+	var body []byte
+	r, body = fr.singleflightDo()
+	if e, is := IsHTTPError(r.Error); is {
+		if len(e.Body) > 0 && errBody != nil {
+			json.Unmarshal(e.Body, errBody)
+		}
+		return
+	}
+	if r.Error != nil {
+		return
+	}
+	r.Error = json.Unmarshal(body, ok)
+	if r.Error != nil {
+		r.Error = fmt.Errorf("%s, body:%s", r.Error.Error(), string(body))
+	}
+	return
+}
+
 // ToString .
 func (fr *FastRequest) ToString() (value string, r Response) {
 	var body []byte
@@ -180,7 +199,6 @@ func (fr *FastRequest) ToXML(v interface{}) (r Response) {
 		return
 	}
 
-	fr.httpRespone(&r)
 	r.Error = xml.Unmarshal(body, v)
 	return
 }
@@ -215,40 +233,55 @@ func (fr *FastRequest) URL() string {
 
 func (fr *FastRequest) singleflightDo() (r Response, body []byte) {
 	if fr.singleflightKey == "" {
-		r.Error = fr.prepare()
-		if r.Error != nil {
-			return
-		}
-		handle(fr)
-		r.Error = fr.responseError
-		if r.Error != nil {
-			return
-		}
-		body = fr.body()
-		fr.httpRespone(&r)
-		return
+		return fr.bufferedDo()
 	}
 
-	data, _, _ := fastclientGroup.Do(fr.singleflightKey, func() (interface{}, error) {
-		var res Response
-		res.Error = fr.prepare()
-		if r.Error != nil {
-			return &singleflightData{Res: res}, nil
-		}
-		handle(fr)
-		res.Error = fr.responseError
-		if res.Error != nil {
-			return &singleflightData{Res: res}, nil
-		}
-
-		fr.httpRespone(&res)
-		return &singleflightData{Res: res, Body: fr.body()}, nil
+	data, _, _ := fr.client.group.Do(fr.singleflightKey, func() (interface{}, error) {
+		res, body := fr.bufferedDo()
+		return &singleflightData{Res: res, Body: body}, nil
 	})
 
 	sfdata := data.(*singleflightData)
 	return sfdata.Res, sfdata.Body
 }
 
+// bufferedDo 发送请求并读取完整响应体
+func (fr *FastRequest) bufferedDo() (r Response, body []byte) {
+	r = fr.send()
+	if r.Error != nil {
+		return
+	}
+	body, r.Error = fr.body()
+	return
+}
+
+// send 发送请求 成功时由调用方读取并关闭fr.resp.Body
+func (fr *FastRequest) send() (r Response) {
+	r.Error = fr.prepare()
+	if r.Error != nil {
+		return
+	}
+	middlewares := fr.client.handlers()
+	handlers := make([]Handler, 0, len(middlewares)+len(fr.middlewares))
+	handlers = append(handlers, middlewares...)
+	fr.chain = chain{handlers: append(handlers, fr.middlewares...), index: -1}
+	fr.attemptHooks = nil
+	fr.run(0)
+	r.Error = fr.responseError
+	if r.Error != nil {
+		if fr.resp != nil {
+			fr.resp.Body.Close()
+		}
+		// 错误状态码同样返回响应信息
+		if _, ok := IsHTTPError(r.Error); ok {
+			fr.httpRespone(&r)
+		}
+		return
+	}
+	fr.httpRespone(&r)
+	return
+}
+
 func (fr *FastRequest) do() (e error) {
 	if fr.reqe != nil {
 		return fr.reqe
@@ -259,7 +292,52 @@ func (fr *FastRequest) do() (e error) {
 		return
 	}
 	fr.resq.URL = u
-	var err error
+	fr.service = ""
+	if u.Scheme == ServiceScheme {
+		fr.service = u.Host
+	}
+
+	for fr.attempt = 1; ; fr.attempt++ {
+		err := fr.roundTrip()
+		wait, retry := fr.retry.next(fr.attempt, fr.resq, fr.resp, err)
+		if !retry {
+			if err != nil {
+				return err
+			}
+			code := fr.resp.StatusCode
+			if code >= 400 && code <= 600 && !fr.ignoreStatusError && !fr.client.opts.ignoreStatusError {
+				return fr.statusError()
+			}
+			return nil
+		}
+
+		if fr.resp != nil {
+			io.Copy(ioutil.Discard, fr.resp.Body)
+			fr.resp.Body.Close()
+		}
+		if e := sleepContext(fr.resq.Context(), wait); e != nil {
+			if err != nil {
+				return err
+			}
+			return e
+		}
+		if fr.resq.GetBody != nil {
+			if fr.resq.Body, e = fr.resq.GetBody(); e != nil {
+				return e
+			}
+		}
+	}
+}
+
+// roundTrip 发送一次请求并上报监控
+func (fr *FastRequest) roundTrip() (err error) {
+	ctx, span := tracing.StartSpan(fr.resq.Context(), fr.resq.Method+" "+fr.resq.URL.Host, tracing.KindClient)
+	span.SetAttribute("http.url", fr.resq.URL.String())
+	if fr.name != "" {
+		span.SetAttribute("http.tag", fr.name)
+	}
+	tracing.InjectHeader(ctx, fr.resq.Header)
+
 	now := time.Now()
 	defer func() {
 		code := ""
@@ -271,31 +349,77 @@ func (fr *FastRequest) do() (e error) {
 		if err != nil {
 			code = "error"
 		}
-		PrometheusImpl.HttpClientWithLabelValues(u.Host, code, pro, fr.resq.Method, fr.name, now)
+		fr.client.metrics().HttpClientWithLabelValues(fr.resq.URL.Host, code, pro, fr.resq.Method, fr.name, now)
+
+		span.SetAttribute("http.status_code", code)
+		span.SetError(err)
+		span.End()
 	}()
-	fr.resp, err = Fastclient.Do(fr.resq)
+	fr.resp, err = fr.hedgedDo(ctx)
+	return err
+}
+
+// pickEndpoint 为svc://请求选择实例并改写req的URL 每次重试与对冲请求重新选择
+func (fr *FastRequest) pickEndpoint(req *http.Request) (func(*http.Response, error), error) {
+	discovery := fr.client.getDiscovery()
+	if discovery == nil {
+		return nil, ErrNoDiscovery
+	}
+	key := fr.balanceKey
+	if key == "" {
+		key = fr.URL()
+	}
+	ep, done, err := discovery.Pick(req.Context(), fr.service, key)
+	if err != nil {
+		return nil, err
+	}
+	u := *req.URL
+	u.Scheme = ep.Scheme
+	u.Host = ep.Addr
+	req.URL = &u
+	return done, nil
+}
+
+// BalanceKey 设置一致性哈希使用的key 相同key的请求落在同一实例
+func (fr *FastRequest) BalanceKey(key string) Request {
+	fr.balanceKey = key
+	return fr
+}
+
+// body 读取完整响应体 超过最大长度时返回ErrBodyTooLarge
+func (fr *FastRequest) body() ([]byte, error) {
+	reader, err := fr.bodyReader()
 	if err != nil {
-		return err
+		return nil, err
 	}
-	code := fr.resp.StatusCode
-	if code >= 400 && code <= 600 {
-		return fmt.Errorf("The FastRequested URL returned error: %d", code)
+	defer reader.Close()
+
+	limit := fr.bodyLimit()
+	if limit <= 0 {
+		return ioutil.ReadAll(reader)
+	}
+
+	body, err := ioutil.ReadAll(io.LimitReader(reader, limit+1))
+	if err != nil {
+		return nil, err
 	}
-	return nil
+	if int64(len(body)) > limit {
+		return nil, ErrBodyTooLarge
+	}
+	return body, nil
 }
 
-func (fr *FastRequest) body() (body []byte) {
-	defer fr.resp.Body.Close()
-	if fr.resp.Header.Get("Content-Encoding") == "gzip" {
-		reader, err := gzip.NewReader(fr.resp.Body)
-		if err != nil {
-			return
-		}
-		body, _ = ioutil.ReadAll(reader)
-		return body
+// bodyLimit 读取完整响应体时的最大长度 0表示不限制
+func (fr *FastRequest) bodyLimit() int64 {
+	if fr.maxBodySize > 0 {
+		return fr.maxBodySize
 	}
-	body, _ = ioutil.ReadAll(fr.resp.Body)
-	return
+	return fr.client.opts.maxBodySize
+}
+
+// bodyReader 返回解码后的响应体 Close同时关闭原始响应体
+func (fr *FastRequest) bodyReader() (io.ReadCloser, error) {
+	return decodeBody(fr.resp.Body, fr.resp.Header.Get("Content-Encoding"), fr.client.opts.maxDecodedSize)
 }
 
 func (fr *FastRequest) httpRespone(httpRespone *Response) {
@@ -334,11 +458,47 @@ func (req *FastRequest) prepare() (e error) {
 		return
 	}
 	req.resq.URL = u
+	req.prepareForm()
+	req.prepareEncoding()
 	return
 }
 
 func (req *FastRequest) Next() {
-	req.responseError = req.do()
+	req.chain.called = true
+	req.run(req.chain.index + 1)
+}
+
+// Use 为该请求追加middleware 在Client的middleware之后执行
+func (req *FastRequest) Use(handlers ...Handler) Request {
+	req.middlewares = append(req.middlewares, handlers...)
+	return req
+}
+
+func (req *FastRequest) GetDuration() time.Duration {
+	return req.duration
+}
+
+func (req *FastRequest) GetAttempts() int {
+	return req.attempt
+}
+
+func (req *FastRequest) ReadBody() ([]byte, error) {
+	// 错误响应体已由HTTPError读取
+	if e, ok := IsHTTPError(req.responseError); ok {
+		return e.Body, nil
+	}
+	if req.resp == nil {
+		return nil, req.responseError
+	}
+	body, err := req.body()
+	if err != nil {
+		return nil, err
+	}
+	// 已解码 之后按未压缩的响应体读取
+	req.resp.Header.Del("Content-Encoding")
+	req.resp.ContentLength = int64(len(body))
+	req.resp.Body = ioutil.NopCloser(bytes.NewReader(body))
+	return body, nil
 }
 
 func (req *FastRequest) Stop(e ...error) {
@@ -354,10 +514,24 @@ func (req *FastRequest) getStop() bool {
 	return req.stop
 }
 
+func (req *FastRequest) onAttempt(hook func(*http.Request) error) {
+	req.attemptHooks = append(req.attemptHooks, hook)
+}
+
+func (req *FastRequest) getMetrics() Prometheus {
+	return req.client.metrics()
+}
+
 func (req *FastRequest) GetRequest() *http.Request {
 	return req.resq
 }
 
+func (req *FastRequest) SetResponse(resp *http.Response) {
+	req.stop = true
+	req.resp = resp
+	req.responseError = nil
+}
+
 func (req *FastRequest) GetRespone() (*http.Response, error) {
 	return req.resp, req.responseError
 }
@@ -0,0 +1,190 @@
+package http
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"time"
+)
+
+// Hedge 请求在after内未返回时再发送一个相同的请求 最多额外发送max个
+// 采用最先成功(无错误且状态码小于500)的响应并取消其余请求
+// 与重试相同 只对冲幂等方法或带Idempotency-Key请求头的请求 请求体不可重复读取时不对冲
+// multipart请求体的各次尝试共用文件reader 不能并发发送 不对冲
+func (fr *FastRequest) Hedge(after time.Duration, max int) Request {
+	fr.hedgeAfter = after
+	fr.hedgeMax = max
+	return fr
+}
+
+// AttemptTimeout 设置单次尝试的超时 包括读取响应体 每次重试与对冲请求单独计时
+// 优先于WithAttemptTimeout 与WithTimeout设置的总超时互不影响
+func (fr *FastRequest) AttemptTimeout(timeout time.Duration) Request {
+	fr.attemptTimeout = timeout
+	return fr
+}
+
+type attemptResult struct {
+	resp *http.Response
+	err  error
+	idx  int
+}
+
+// hedgedDo 发送一次尝试 设置了Hedge时并发发送对冲请求
+func (fr *FastRequest) hedgedDo(ctx context.Context) (*http.Response, error) {
+	first := withProgress(fr.resq.WithContext(ctx), fr.progress)
+	replayable := fr.resq.Body == nil || fr.resq.Body == http.NoBody || fr.resq.GetBody != nil
+	if _, ok := fr.resq.Body.(*lazyBody); ok {
+		replayable = false
+	}
+	if fr.hedgeMax <= 0 || fr.hedgeAfter <= 0 || !replayable || !isIdempotent(fr.resq) {
+		return fr.attemptDo(first)
+	}
+
+	results := make(chan attemptResult, fr.hedgeMax+1)
+	var cancels []context.CancelFunc
+	launch := func(req *http.Request) {
+		actx, cancel := context.WithCancel(ctx)
+		idx := len(cancels)
+		cancels = append(cancels, cancel)
+		go func() {
+			resp, err := fr.attemptDo(req.WithContext(actx))
+			results <- attemptResult{resp: resp, err: err, idx: idx}
+		}()
+	}
+
+	launch(first)
+	pending := 1
+	timer := time.NewTimer(fr.hedgeAfter)
+	defer timer.Stop()
+
+	var last *attemptResult
+	discard := func(res *attemptResult) {
+		if res != nil {
+			closeAttempt(*res)
+			cancels[res.idx]()
+		}
+	}
+	for {
+		select {
+		case <-timer.C:
+			if len(cancels) > fr.hedgeMax {
+				continue
+			}
+			req := fr.resq.Clone(ctx)
+			if fr.resq.GetBody != nil {
+				body, err := fr.resq.GetBody()
+				if err != nil {
+					continue
+				}
+				req.Body = body
+			}
+			launch(req)
+			pending++
+			timer.Reset(fr.hedgeAfter)
+
+		case res := <-results:
+			pending--
+			if res.err == nil && res.resp.StatusCode < 500 {
+				for i, cancel := range cancels {
+					if i != res.idx {
+						cancel()
+					}
+				}
+				go drainAttempts(results, pending)
+				discard(last)
+				res.resp.Body = &cancelBody{ReadCloser: res.resp.Body, cancel: cancels[res.idx]}
+				return res.resp, nil
+			}
+
+			// 优先保留有响应的失败结果
+			if last == nil || last.resp == nil || res.resp != nil {
+				discard(last)
+				last = &res
+			} else {
+				discard(&res)
+			}
+			if pending == 0 {
+				if last.resp == nil {
+					cancels[last.idx]()
+					return nil, last.err
+				}
+				last.resp.Body = &cancelBody{ReadCloser: last.resp.Body, cancel: cancels[last.idx]}
+				return last.resp, nil
+			}
+		}
+	}
+}
+
+// attemptDo 发送单个请求 svc://请求在此选择实例 单次尝试超时在响应体关闭时释放
+func (fr *FastRequest) attemptDo(req *http.Request) (*http.Response, error) {
+	timeout := fr.attemptTimeout
+	if timeout <= 0 {
+		timeout = fr.client.opts.attemptTimeout
+	}
+	cancel := context.CancelFunc(func() {})
+	if timeout > 0 {
+		var ctx context.Context
+		ctx, cancel = context.WithTimeout(req.Context(), timeout)
+		req = req.WithContext(ctx)
+	}
+
+	if len(fr.attemptHooks) > 0 {
+		// 对冲请求并发执行 hook只修改本次请求的头
+		req = req.WithContext(req.Context())
+		req.Header = req.Header.Clone()
+		for _, hook := range fr.attemptHooks {
+			if err := hook(req); err != nil {
+				cancel()
+				return nil, err
+			}
+		}
+	}
+
+	done := func(*http.Response, error) {}
+	if fr.service != "" {
+		var err error
+		if done, err = fr.pickEndpoint(req); err != nil {
+			cancel()
+			return nil, err
+		}
+	}
+
+	resp, err := fr.client.client.Do(req)
+	// 被取消的对冲请求不计入实例的失败统计
+	if !errors.Is(err, context.Canceled) || req.Context().Err() != context.Canceled {
+		done(resp, err)
+	}
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	resp.Body = &cancelBody{ReadCloser: resp.Body, cancel: cancel}
+	return resp, nil
+}
+
+// cancelBody 响应体关闭时取消请求的context
+type cancelBody struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (c *cancelBody) Close() error {
+	err := c.ReadCloser.Close()
+	c.cancel()
+	return err
+}
+
+func closeAttempt(res attemptResult) {
+	if res.resp != nil {
+		res.resp.Body.Close()
+	}
+}
+
+// drainAttempts 关闭被取消的对冲请求的响应
+func drainAttempts(results <-chan attemptResult, pending int) {
+	for ; pending > 0; pending-- {
+		closeAttempt(<-results)
+	}
+}
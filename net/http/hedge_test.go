@@ -0,0 +1,172 @@
+package http
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestHedge(t *testing.T) {
+	var calls, cancelled int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&calls, 1) == 1 {
+			select {
+			case <-r.Context().Done():
+				atomic.AddInt32(&cancelled, 1)
+				return
+			case <-time.After(time.Second):
+			}
+		}
+		w.Write([]byte("ok"))
+	}))
+	defer srv.Close()
+
+	start := time.Now()
+	body, r := NewClient().NewRequest(srv.URL).Hedge(20*time.Millisecond, 2).ToString()
+	if r.Error != nil || body != "ok" {
+		t.Fatalf("got %q %v", body, r.Error)
+	}
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("hedged request took %v", elapsed)
+	}
+	if n := atomic.LoadInt32(&calls); n != 2 {
+		t.Errorf("calls %d", n)
+	}
+	time.Sleep(50 * time.Millisecond)
+	if atomic.LoadInt32(&cancelled) != 1 {
+		t.Error("slow request not cancelled")
+	}
+}
+
+func TestAttemptTimeout(t *testing.T) {
+	var calls int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&calls, 1) == 1 {
+			time.Sleep(200 * time.Millisecond)
+		}
+		w.Write([]byte("ok"))
+	}))
+	defer srv.Close()
+
+	policy := &RetryPolicy{MaxAttempts: 2, BaseDelay: time.Millisecond}
+	body, r := NewClient().NewRequest(srv.URL).Retry(policy).AttemptTimeout(50 * time.Millisecond).ToString()
+	if r.Error != nil || body != "ok" {
+		t.Fatalf("got %q %v", body, r.Error)
+	}
+
+	_, r = NewClient(WithAttemptTimeout(50 * time.Millisecond)).NewRequest(srv.URL).ToString()
+	if r.Error != nil {
+		t.Errorf("fast attempt got %v", r.Error)
+	}
+	atomic.StoreInt32(&calls, 0)
+	_, r = NewClient(WithAttemptTimeout(50 * time.Millisecond)).NewRequest(srv.URL).ToString()
+	if r.Error == nil || !isTimeout(r.Error) {
+		t.Errorf("slow attempt got %v", r.Error)
+	}
+}
+
+func isTimeout(err error) bool {
+	if e, ok := err.(interface{ Timeout() bool }); ok && e.Timeout() {
+		return true
+	}
+	return err == context.DeadlineExceeded
+}
+
+func TestHedgeNonIdempotent(t *testing.T) {
+	var calls int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		time.Sleep(50 * time.Millisecond)
+		w.Write([]byte("ok"))
+	}))
+	defer srv.Close()
+
+	if _, r := NewClient().NewRequest(srv.URL).Post().SetBody([]byte("order")).Hedge(10*time.Millisecond, 2).ToString(); r.Error != nil {
+		t.Fatal(r.Error)
+	}
+	if n := atomic.LoadInt32(&calls); n != 1 {
+		t.Errorf("POST hedged %d times", n)
+	}
+
+	atomic.StoreInt32(&calls, 0)
+	if _, r := NewClient().NewRequest(srv.URL).Post().SetBody([]byte("order")).AddHeader("Idempotency-Key", "order-1").
+		Hedge(10*time.Millisecond, 1).ToString(); r.Error != nil {
+		t.Fatal(r.Error)
+	}
+	if n := atomic.LoadInt32(&calls); n != 2 {
+		t.Errorf("POST with Idempotency-Key sent %d times", n)
+	}
+}
+
+// TestHedgeOutlier 被取消的对冲请求不导致实例被摘除
+func TestHedgeOutlier(t *testing.T) {
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/slow" {
+			select {
+			case <-r.Context().Done():
+				return
+			case <-time.After(time.Second):
+			}
+		}
+		w.Write([]byte("slow"))
+	}))
+	defer slow.Close()
+	fast := newBackend("fast", http.StatusOK)
+	defer fast.Close()
+	resolver := StaticResolver{"orders": {
+		{Addr: strings.TrimPrefix(slow.URL, "http://")},
+		{Addr: strings.TrimPrefix(fast.URL, "http://")},
+	}}
+
+	d := NewDiscovery(resolver, WithOutlier(OutlierConfig{ConsecutiveFailures: 1, EjectDuration: time.Minute}))
+	client := NewClient(WithDiscovery(d))
+	for i := 0; i < 2; i++ {
+		if body, r := client.NewRequest("svc://orders/slow").Hedge(10*time.Millisecond, 1).ToString(); r.Error != nil || body != "fast" {
+			t.Fatalf("hedged request got %q %v", body, r.Error)
+		}
+	}
+
+	seen := map[string]bool{}
+	for i := 0; i < 4; i++ {
+		body, _ := client.NewRequest("svc://orders").ToString()
+		seen[body] = true
+	}
+	if !seen["slow"] {
+		t.Errorf("cancelled hedge ejected the slow endpoint, picked %v", seen)
+	}
+}
+
+// TestHedgeMultipart multipart上传共用文件reader 不发送对冲请求
+func TestHedgeMultipart(t *testing.T) {
+	content := bytes.Repeat([]byte("0123456789"), 20000)
+	var calls int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		file, _, err := r.FormFile("file")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		data, _ := ioutil.ReadAll(file)
+		time.Sleep(100 * time.Millisecond)
+		if !bytes.Equal(data, content) {
+			http.Error(w, "corrupted", http.StatusBadRequest)
+		}
+	}))
+	defer srv.Close()
+
+	_, r := NewClient().NewRequest(srv.URL).Put().Hedge(10*time.Millisecond, 2).
+		AddFile("file", "a.bin", bytes.NewReader(content)).ToBytes()
+	if r.Error != nil {
+		t.Fatalf("upload err %v", r.Error)
+	}
+	if n := atomic.LoadInt32(&calls); n != 1 {
+		t.Errorf("sent %d attempts", n)
+	}
+}
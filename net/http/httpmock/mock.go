@@ -0,0 +1,389 @@
+// Package httpmock 用于测试的http.RoundTripper
+// 按method URL与请求体匹配预设响应 统计调用次数 并支持录制回放真实请求
+package httpmock
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"reflect"
+	"regexp"
+	"strings"
+	"sync"
+
+	lhttp "github.com/Tokumicn/lego-lib/net/http"
+)
+
+// ErrNoResponder 没有匹配的预设响应
+var ErrNoResponder = errors.New("httpmock: no responder found")
+
+// Responder 根据请求生成响应
+type Responder func(req *http.Request) (*http.Response, error)
+
+// BodyMatcher 请求体匹配
+type BodyMatcher func(body []byte) bool
+
+// BodyEquals 请求体与s完全相同
+func BodyEquals(s string) BodyMatcher {
+	return func(body []byte) bool {
+		return string(body) == s
+	}
+}
+
+// BodyContains 请求体包含s
+func BodyContains(s string) BodyMatcher {
+	return func(body []byte) bool {
+		return bytes.Contains(body, []byte(s))
+	}
+}
+
+// BodyRegexp 请求体匹配正则 正则非法时panic
+func BodyRegexp(pattern string) BodyMatcher {
+	re := regexp.MustCompile(pattern)
+	return func(body []byte) bool {
+		return re.Match(body)
+	}
+}
+
+// BodyJSON 请求体与v序列化后的JSON语义相同 忽略字段顺序与空白
+func BodyJSON(v interface{}) BodyMatcher {
+	byts, err := json.Marshal(v)
+	if err != nil {
+		panic(err)
+	}
+	var want interface{}
+	json.Unmarshal(byts, &want)
+	return func(body []byte) bool {
+		var got interface{}
+		if err := json.Unmarshal(body, &got); err != nil {
+			return false
+		}
+		return reflect.DeepEqual(got, want)
+	}
+}
+
+// NewResponse 创建响应
+func NewResponse(status int, header http.Header, body []byte) *http.Response {
+	if header == nil {
+		header = make(http.Header)
+	}
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", status, http.StatusText(status)),
+		StatusCode:    status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          ioutil.NopCloser(bytes.NewReader(body)),
+		ContentLength: int64(len(body)),
+	}
+}
+
+// Expectation 一条预设 通过Transport.On创建
+type Expectation struct {
+	method  string
+	match   func(u *url.URL) bool
+	pattern string
+	headers http.Header
+	body    BodyMatcher
+
+	status    int
+	header    http.Header
+	respBody  []byte
+	responder Responder
+
+	times int // 0表示不限次数
+	calls int
+}
+
+// WithHeader 要求请求头key包含value
+func (e *Expectation) WithHeader(key, value string) *Expectation {
+	if e.headers == nil {
+		e.headers = make(http.Header)
+	}
+	e.headers.Add(key, value)
+	return e
+}
+
+// WithBody 要求请求体满足matcher
+func (e *Expectation) WithBody(matcher BodyMatcher) *Expectation {
+	e.body = matcher
+	return e
+}
+
+// Reply 返回status与body
+func (e *Expectation) Reply(status int, body string) *Expectation {
+	e.status = status
+	e.respBody = []byte(body)
+	return e
+}
+
+// ReplyJSON 返回status与v序列化后的JSON v无法序列化时panic
+func (e *Expectation) ReplyJSON(status int, v interface{}) *Expectation {
+	byts, err := json.Marshal(v)
+	if err != nil {
+		panic(err)
+	}
+	e.status = status
+	e.respBody = byts
+	return e.ReplyHeader("Content-Type", "application/json")
+}
+
+// ReplyHeader 设置响应头
+func (e *Expectation) ReplyHeader(key, value string) *Expectation {
+	e.header.Add(key, value)
+	return e
+}
+
+// ReplyError 返回传输错误
+func (e *Expectation) ReplyError(err error) *Expectation {
+	e.responder = func(*http.Request) (*http.Response, error) {
+		return nil, err
+	}
+	return e
+}
+
+// ReplyFunc 由fn生成响应
+func (e *Expectation) ReplyFunc(fn Responder) *Expectation {
+	e.responder = fn
+	return e
+}
+
+// Times 最多匹配n次 AssertExpectations要求正好调用n次
+func (e *Expectation) Times(n int) *Expectation {
+	e.times = n
+	return e
+}
+
+// Once 等同Times(1)
+func (e *Expectation) Once() *Expectation {
+	return e.Times(1)
+}
+
+func (e *Expectation) String() string {
+	return e.method + " " + e.pattern
+}
+
+func (e *Expectation) matches(req *http.Request, body []byte) bool {
+	if e.times > 0 && e.calls >= e.times {
+		return false
+	}
+	method := req.Method
+	if method == "" {
+		method = http.MethodGet
+	}
+	if e.method != "" && !strings.EqualFold(e.method, method) {
+		return false
+	}
+	if !e.match(req.URL) {
+		return false
+	}
+	for key, values := range e.headers {
+		for _, value := range values {
+			if !contains(req.Header[http.CanonicalHeaderKey(key)], value) {
+				return false
+			}
+		}
+	}
+	return e.body == nil || e.body(body)
+}
+
+func (e *Expectation) respond(req *http.Request) (*http.Response, error) {
+	if e.responder != nil {
+		return e.responder(req)
+	}
+	resp := NewResponse(e.status, e.header.Clone(), e.respBody)
+	resp.Request = req
+	return resp, nil
+}
+
+// TestingT testing.T中用到的方法
+type TestingT interface {
+	Helper()
+	Errorf(format string, args ...interface{})
+}
+
+// Transport 按预设响应请求的http.RoundTripper 并发安全
+type Transport struct {
+	// Fallback 没有匹配的预设时使用 为nil时返回ErrNoResponder
+	Fallback http.RoundTripper
+
+	mu           sync.Mutex
+	expectations []*Expectation
+	calls        map[string]int
+}
+
+// NewTransport 创建Transport
+func NewTransport() *Transport {
+	return &Transport{calls: make(map[string]int)}
+}
+
+// On 按method与URL预设响应 method为空匹配任意方法
+// url不带查询参数时忽略请求的查询参数 带查询参数时要求参数相同
+func (t *Transport) On(method, rawurl string) *Expectation {
+	want, err := url.Parse(rawurl)
+	if err != nil {
+		panic(err)
+	}
+	return t.add(method, rawurl, func(u *url.URL) bool {
+		if u.Scheme != want.Scheme || u.Host != want.Host || u.Path != want.Path {
+			return false
+		}
+		if want.RawQuery == "" {
+			return true
+		}
+		return u.Query().Encode() == want.Query().Encode()
+	})
+}
+
+// OnRegexp 按method与URL正则预设响应 正则匹配完整URL
+func (t *Transport) OnRegexp(method, pattern string) *Expectation {
+	re := regexp.MustCompile(pattern)
+	return t.add(method, pattern, func(u *url.URL) bool {
+		return re.MatchString(u.String())
+	})
+}
+
+func (t *Transport) add(method, pattern string, match func(u *url.URL) bool) *Expectation {
+	e := &Expectation{
+		method:  strings.ToUpper(method),
+		pattern: pattern,
+		match:   match,
+		status:  http.StatusOK,
+		header:  make(http.Header),
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.expectations = append(t.expectations, e)
+	return e
+}
+
+// RoundTrip 实现http.RoundTripper 按注册顺序匹配第一条预设
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	var body []byte
+	if req.Body != nil {
+		var err error
+		if body, err = ioutil.ReadAll(req.Body); err != nil {
+			return nil, err
+		}
+		req.Body.Close()
+		req.Body = ioutil.NopCloser(bytes.NewReader(body))
+	}
+
+	t.mu.Lock()
+	t.calls[callKey(req.Method, req.URL)]++
+	var matched *Expectation
+	for _, e := range t.expectations {
+		if e.matches(req, body) {
+			e.calls++
+			matched = e
+			break
+		}
+	}
+	t.mu.Unlock()
+
+	if matched != nil {
+		return matched.respond(req)
+	}
+	if t.Fallback != nil {
+		return t.Fallback.RoundTrip(req)
+	}
+	return nil, fmt.Errorf("%w: %s %s", ErrNoResponder, req.Method, req.URL)
+}
+
+// Calls 返回method与url的请求次数 url需包含实际的查询参数
+func (t *Transport) Calls(method, rawurl string) int {
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return 0
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.calls[callKey(method, u)]
+}
+
+// TotalCalls 返回全部请求次数
+func (t *Transport) TotalCalls() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	total := 0
+	for _, n := range t.calls {
+		total += n
+	}
+	return total
+}
+
+// AssertExpectations 检查每条预设至少被调用一次 设置了Times的需正好调用Times次
+func (t *Transport) AssertExpectations(tb TestingT) bool {
+	tb.Helper()
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	ok := true
+	for _, e := range t.expectations {
+		if e.times > 0 && e.calls != e.times || e.times == 0 && e.calls == 0 {
+			tb.Errorf("httpmock: %s called %d times, want %s", e, e.calls, wantTimes(e.times))
+			ok = false
+		}
+	}
+	return ok
+}
+
+// Reset 清空预设与调用次数
+func (t *Transport) Reset() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.expectations = nil
+	t.calls = make(map[string]int)
+}
+
+// Activate 将DefaultClient与DefaultH2CClient的传输层替换为rt 返回恢复函数
+// 与ActivateClient相同 不能与使用这两个Client的请求并发调用 不适用于t.Parallel的测试
+//
+//	defer httpmock.Activate(mock)()
+func Activate(rt http.RoundTripper) (restore func()) {
+	restoreDefault := ActivateClient(lhttp.DefaultClient, rt)
+	restoreH2C := ActivateClient(lhttp.DefaultH2CClient, rt)
+	return func() {
+		restoreDefault()
+		restoreH2C()
+	}
+}
+
+// ActivateClient 将client的传输层替换为rt 返回恢复函数
+// 直接修改底层http.Client.Transport 替换与恢复均不能与该client上的请求并发
+// t.Parallel的测试应通过lhttp.NewClient(lhttp.WithTransport(mock))创建各自的Client
+func ActivateClient(client *lhttp.Client, rt http.RoundTripper) (restore func()) {
+	hc := client.HTTPClient()
+	origin := hc.Transport
+	hc.Transport = rt
+	return func() {
+		hc.Transport = origin
+	}
+}
+
+func callKey(method string, u *url.URL) string {
+	if method == "" {
+		method = http.MethodGet
+	}
+	return strings.ToUpper(method) + " " + u.Scheme + "://" + u.Host + u.Path + "?" + u.Query().Encode()
+}
+
+func wantTimes(n int) string {
+	if n == 0 {
+		return "at least once"
+	}
+	return fmt.Sprint(n)
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
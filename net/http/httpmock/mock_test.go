@@ -0,0 +1,111 @@
+package httpmock
+
+import (
+	"compress/gzip"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	lhttp "github.com/Tokumicn/lego-lib/net/http"
+)
+
+type fakeT struct {
+	errors int
+}
+
+func (f *fakeT) Helper() {}
+func (f *fakeT) Errorf(format string, args ...interface{}) {
+	f.errors++
+}
+
+func TestTransport(t *testing.T) {
+	mock := NewTransport()
+	mock.On("POST", "https://api.example.com/users").
+		WithBody(BodyJSON(map[string]interface{}{"name": "tom"})).
+		ReplyJSON(http.StatusCreated, map[string]int{"id": 1}).
+		Once()
+	mock.OnRegexp("GET", `^https://api\.example\.com/users/\d+$`).Reply(http.StatusOK, `{"id":1,"name":"tom"}`)
+	defer Activate(mock)()
+
+	var created struct{ ID int }
+	r := lhttp.NewFastRequest("https://api.example.com/users").Post().
+		SetJSONBody(map[string]string{"name": "tom"}).ToJSON(&created)
+	if r.Error != nil || created.ID != 1 || r.StatusCode != http.StatusCreated {
+		t.Fatalf("create got %+v %v", created, r.Error)
+	}
+
+	var user struct{ Name string }
+	for i := 0; i < 2; i++ {
+		if r := lhttp.NewFastRequest("https://api.example.com/users/1").ToJSON(&user); r.Error != nil || user.Name != "tom" {
+			t.Fatalf("get got %+v %v", user, r.Error)
+		}
+	}
+	if n := mock.Calls("GET", "https://api.example.com/users/1"); n != 2 {
+		t.Errorf("calls %d", n)
+	}
+
+	// Once已用完
+	_, r = lhttp.NewFastRequest("https://api.example.com/users").Post().SetJSONBody(map[string]string{"name": "tom"}).ToBytes()
+	if !errors.Is(r.Error, ErrNoResponder) {
+		t.Errorf("got %v", r.Error)
+	}
+	mock.AssertExpectations(t)
+
+	mock.On("DELETE", "https://api.example.com/users/1").Once()
+	ft := &fakeT{}
+	if mock.AssertExpectations(ft) || ft.errors != 1 {
+		t.Errorf("unmet expectation not reported")
+	}
+}
+
+func TestRecorder(t *testing.T) {
+	// 支持压缩的服务端 golden文件保存解码后的内容
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.Contains(r.Header.Get("Accept-Encoding"), "gzip") {
+			w.Write([]byte("hello " + r.URL.Query().Get("name")))
+			return
+		}
+		w.Header().Set("Content-Encoding", "gzip")
+		gz := gzip.NewWriter(w)
+		gz.Write([]byte("hello " + r.URL.Query().Get("name")))
+		gz.Close()
+	}))
+	defer srv.Close()
+
+	dir, err := ioutil.TempDir("", "httpmock")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	golden := filepath.Join(dir, "hello.json")
+
+	rec, err := NewRecorder(ModeRecord, golden, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := lhttp.NewClient(lhttp.WithTransport(rec))
+	if body, r := client.NewRequest(srv.URL).SetParam("name", "go").ToString(); r.Error != nil || body != "hello go" {
+		t.Fatalf("record got %q %v", body, r.Error)
+	}
+	if err := rec.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	rep, err := NewRecorder(ModeReplay, golden, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client = lhttp.NewClient(lhttp.WithTransport(rep))
+	srv.Close()
+	if body, r := client.NewRequest(srv.URL).SetParam("name", "go").ToString(); r.Error != nil || body != "hello go" {
+		t.Fatalf("replay got %q %v", body, r.Error)
+	}
+	if _, r := client.NewRequest(srv.URL).SetParam("name", "rust").ToString(); !errors.Is(r.Error, ErrNoResponder) {
+		t.Errorf("unrecorded request got %v", r.Error)
+	}
+}
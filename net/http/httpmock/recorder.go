@@ -0,0 +1,218 @@
+package httpmock
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	lhttp "github.com/Tokumicn/lego-lib/net/http"
+)
+
+// Mode 录制回放模式
+type Mode int
+
+const (
+	// ModeReplay 只从golden文件回放 没有匹配的记录时返回ErrNoResponder
+	ModeReplay Mode = iota
+	// ModeRecord 发送真实请求并录制 Save时覆盖golden文件
+	ModeRecord
+)
+
+// RecordEnv 为1时ModeFromEnv返回ModeRecord
+const RecordEnv = "HTTPMOCK_RECORD"
+
+// ModeFromEnv 根据环境变量HTTPMOCK_RECORD选择模式 默认回放
+//
+//	HTTPMOCK_RECORD=1 go test ./... 更新golden文件
+func ModeFromEnv() Mode {
+	if os.Getenv(RecordEnv) == "1" {
+		return ModeRecord
+	}
+	return ModeReplay
+}
+
+// Interaction 一次录制的请求与响应
+type Interaction struct {
+	Request  RecordedRequest  `json:"request"`
+	Response RecordedResponse `json:"response"`
+}
+
+// RecordedRequest 录制的请求 回放时按Method URL与Body匹配
+type RecordedRequest struct {
+	Method string `json:"method"`
+	URL    string `json:"url"`
+	Body   string `json:"body,omitempty"`
+}
+
+// RecordedResponse 录制的响应
+type RecordedResponse struct {
+	StatusCode int         `json:"status"`
+	Header     http.Header `json:"header,omitempty"`
+	Body       string      `json:"body"`
+}
+
+// Recorder 录制或回放请求的http.RoundTripper 并发安全
+type Recorder struct {
+	mode   Mode
+	golden string
+	real   http.RoundTripper
+
+	mu           sync.Mutex
+	interactions []Interaction
+	used         []bool
+}
+
+// NewRecorder 创建Recorder real为录制时使用的传输层 nil时使用http.DefaultTransport
+// 回放模式下golden文件不存在时返回错误
+func NewRecorder(mode Mode, golden string, real http.RoundTripper) (*Recorder, error) {
+	if real == nil {
+		real = http.DefaultTransport
+	}
+	r := &Recorder{mode: mode, golden: golden, real: real}
+	if mode == ModeRecord {
+		return r, nil
+	}
+
+	byts, err := ioutil.ReadFile(golden)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(byts, &r.interactions); err != nil {
+		return nil, fmt.Errorf("httpmock: decode %s: %w", golden, err)
+	}
+	r.used = make([]bool, len(r.interactions))
+	return r, nil
+}
+
+// RoundTrip 实现http.RoundTripper
+func (r *Recorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	var body []byte
+	if req.Body != nil {
+		var err error
+		if body, err = ioutil.ReadAll(req.Body); err != nil {
+			return nil, err
+		}
+		req.Body.Close()
+	}
+	recorded := RecordedRequest{Method: req.Method, URL: req.URL.String(), Body: string(body)}
+	if recorded.Method == "" {
+		recorded.Method = http.MethodGet
+	}
+
+	if r.mode == ModeRecord {
+		return r.record(req, recorded, body)
+	}
+	return r.replay(req, recorded)
+}
+
+func (r *Recorder) record(req *http.Request, recorded RecordedRequest, body []byte) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	req.Body = ioutil.NopCloser(bytes.NewReader(body))
+	resp, err := r.real.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	respBody, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = ioutil.NopCloser(bytes.NewReader(respBody))
+
+	// 调用方收到原始响应 golden文件中保存解码后的内容 回放时不再协商压缩
+	decoded, err := decodeBody(respBody, resp.Header.Get("Content-Encoding"))
+	if err != nil {
+		return nil, fmt.Errorf("httpmock: record %s %s: %w", recorded.Method, recorded.URL, err)
+	}
+	header := resp.Header.Clone()
+	header.Del("Content-Encoding")
+	header.Del("Content-Length")
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.interactions = append(r.interactions, Interaction{
+		Request:  recorded,
+		Response: RecordedResponse{StatusCode: resp.StatusCode, Header: header, Body: string(decoded)},
+	})
+	return resp, nil
+}
+
+// decodeBody 按Content-Encoding逆序解码 编码通过lhttp.GetCodec获取
+func decodeBody(body []byte, contentEncoding string) ([]byte, error) {
+	encodings := strings.Split(contentEncoding, ",")
+	for i := len(encodings) - 1; i >= 0; i-- {
+		name := strings.ToLower(strings.TrimSpace(encodings[i]))
+		if name == "" || name == "identity" {
+			continue
+		}
+		codec, ok := lhttp.GetCodec(name)
+		if !ok {
+			return nil, fmt.Errorf("unsupported Content-Encoding %q", name)
+		}
+		reader, err := codec.NewReader(bytes.NewReader(body))
+		if err != nil {
+			return nil, err
+		}
+		body, err = ioutil.ReadAll(reader)
+		reader.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+	return body, nil
+}
+
+// replay 按录制顺序使用第一条未使用的匹配记录 全部用过后重复使用最后一条匹配记录
+func (r *Recorder) replay(req *http.Request, recorded RecordedRequest) (*http.Response, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	last := -1
+	for i, interaction := range r.interactions {
+		if interaction.Request != recorded {
+			continue
+		}
+		last = i
+		if !r.used[i] {
+			break
+		}
+	}
+	if last < 0 {
+		return nil, fmt.Errorf("%w: %s %s not recorded in %s", ErrNoResponder, recorded.Method, recorded.URL, r.golden)
+	}
+	r.used[last] = true
+
+	recordedResp := r.interactions[last].Response
+	resp := NewResponse(recordedResp.StatusCode, recordedResp.Header.Clone(), []byte(recordedResp.Body))
+	resp.Request = req
+	return resp, nil
+}
+
+// Save 录制模式下写入golden文件 回放模式下不做任何事
+func (r *Recorder) Save() error {
+	if r.mode != ModeRecord {
+		return nil
+	}
+
+	r.mu.Lock()
+	byts, err := json.MarshalIndent(r.interactions, "", "  ")
+	r.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(r.golden), 0755); err != nil {
+		return err
+	}
+	tmp := r.golden + ".tmp"
+	if err := ioutil.WriteFile(tmp, append(byts, '\n'), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, r.golden)
+}
@@ -0,0 +1,301 @@
+package http
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/Tokumicn/lego-lib/logs"
+)
+
+// 脱敏后的取值
+const redacted = "REDACTED"
+
+// curl命令中请求体的最大字节数
+const maxCurlBodySize = 64 << 10
+
+// AccessLogConfig 访问日志配置
+type AccessLogConfig struct {
+	// RedactParams 需要脱敏的查询参数 如token sign
+	RedactParams []string
+	// MaskHeaders 需要脱敏的请求头 默认Authorization Proxy-Authorization Cookie Set-Cookie X-Api-Key
+	MaskHeaders []string
+	// LogHeaders 是否打印请求头与响应头
+	LogHeaders bool
+	// MaxBodySize 打印请求体与响应体的最大字节数 默认1024 小于0时不打印
+	MaxBodySize int
+	// Curl 在Debug级别打印等价的curl命令 脱敏的请求头需手动补全
+	Curl bool
+	// Logger 默认logs.WithContext
+	Logger func(ctx context.Context) logs.Logger
+}
+
+// AccessLog 返回访问日志middleware 记录method URL 状态码 耗时 尝试次数与请求响应体
+// 打印响应体时在调用方读取的同时记录前MaxBodySize字节 读到EOF或Close时才打印日志
+func AccessLog(conf AccessLogConfig) Handler {
+	if conf.MaskHeaders == nil {
+		conf.MaskHeaders = []string{"Authorization", "Proxy-Authorization", "Cookie", "Set-Cookie", "X-Api-Key"}
+	}
+	if conf.MaxBodySize == 0 {
+		conf.MaxBodySize = 1024
+	}
+	if conf.Logger == nil {
+		conf.Logger = logs.WithContext
+	}
+	al := &accessLog{conf: conf, masked: make(map[string]bool), params: make(map[string]bool)}
+	for _, h := range conf.MaskHeaders {
+		al.masked[http.CanonicalHeaderKey(h)] = true
+	}
+	for _, p := range conf.RedactParams {
+		al.params[p] = true
+	}
+	return al.handle
+}
+
+type accessLog struct {
+	conf   AccessLogConfig
+	masked map[string]bool
+	params map[string]bool
+}
+
+func (al *accessLog) handle(m Middleware) {
+	req := m.GetRequest()
+	reqBody, reqTruncated := al.requestBody(req)
+
+	m.Next()
+
+	logger := al.conf.Logger(req.Context())
+	if logger == nil {
+		return
+	}
+	resp, err := m.GetRespone()
+
+	// 实际发送的请求 svc://地址为选中的实例
+	sent := req
+	if resp != nil && resp.Request != nil {
+		sent = resp.Request
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "http client %s %s", methodOf(req), al.redactURL(sent.URL))
+	status := 0
+	if resp != nil {
+		status = resp.StatusCode
+	}
+	fmt.Fprintf(&b, " status:%d attempts:%d latency:%s tag:%s", status, m.GetAttempts(), m.GetDuration(), m.GetName())
+	if al.conf.LogHeaders {
+		fmt.Fprintf(&b, " req_header:%s", al.headers(req.Header))
+		if resp != nil {
+			fmt.Fprintf(&b, " resp_header:%s", al.headers(resp.Header))
+		}
+	}
+	write := func() {
+		if err != nil {
+			fmt.Fprintf(&b, " error:%s", err)
+			logger.Error(b.String())
+		} else {
+			logger.Info(b.String())
+		}
+		if al.conf.Curl {
+			logger.Debug(al.curl(req, sent.URL, reqBody, reqTruncated))
+		}
+	}
+	if al.conf.MaxBodySize <= 0 {
+		write()
+		return
+	}
+	fmt.Fprintf(&b, " req_body:%s", clip(reqBody, reqTruncated, al.conf.MaxBodySize))
+
+	if e, ok := IsHTTPError(err); ok {
+		fmt.Fprintf(&b, " resp_body:%s", clip(e.Body, false, al.conf.MaxBodySize))
+		write()
+		return
+	}
+	if resp == nil || resp.Body == nil || err != nil {
+		b.WriteString(" resp_body:")
+		write()
+		return
+	}
+	// 响应体由调用方读取 读完或关闭时打印
+	encoding := resp.Header.Get("Content-Encoding")
+	resp.Body = &loggedBody{ReadCloser: resp.Body, limit: al.conf.MaxBodySize, done: func(body []byte, more bool) {
+		body, more = al.decodePrefix(body, more, encoding)
+		fmt.Fprintf(&b, " resp_body:%s", clip(body, more, al.conf.MaxBodySize))
+		write()
+	}}
+}
+
+// requestBody 通过GetBody读取请求体 不影响发送 打印curl时最多读取64KB
+// multipart请求体边读文件边发送 GetBody与发送共用文件reader 不记录
+func (al *accessLog) requestBody(req *http.Request) ([]byte, bool) {
+	if al.conf.MaxBodySize < 0 && !al.conf.Curl || req.GetBody == nil {
+		return nil, false
+	}
+	if _, ok := req.Body.(*lazyBody); ok || req.ContentLength == -1 {
+		return nil, false
+	}
+	body, err := req.GetBody()
+	if err != nil {
+		return nil, false
+	}
+	defer body.Close()
+	limit := al.conf.MaxBodySize
+	if al.conf.Curl && limit < maxCurlBodySize {
+		limit = maxCurlBodySize
+	}
+	return readPrefix(body, limit)
+}
+
+// decodePrefix 解码压缩响应体记录的部分 截断的压缩数据解码到出错为止
+func (al *accessLog) decodePrefix(prefix []byte, more bool, encoding string) ([]byte, bool) {
+	if encoding == "" {
+		return prefix, more
+	}
+	decoded, err := decodeBody(ioutil.NopCloser(bytes.NewReader(prefix)), encoding, 0)
+	if err != nil {
+		return []byte("<" + encoding + " encoded>"), false
+	}
+	defer decoded.Close()
+	body, decodedMore := readPrefix(decoded, al.conf.MaxBodySize)
+	return body, more || decodedMore
+}
+
+// loggedBody 在调用方读取时记录前limit字节 读到EOF 出错或Close时调用一次done
+type loggedBody struct {
+	io.ReadCloser
+	limit int
+	buf   []byte
+	more  bool
+	once  sync.Once
+	done  func(body []byte, more bool)
+}
+
+func (b *loggedBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if rest := b.limit + 1 - len(b.buf); rest > 0 {
+		if rest > n {
+			rest = n
+		}
+		b.buf = append(b.buf, p[:rest]...)
+	}
+	if n > 0 && len(b.buf) > b.limit {
+		b.more = true
+	}
+	if err != nil {
+		b.finish(false)
+	}
+	return n, err
+}
+
+// Close 未读到EOF时按截断打印
+func (b *loggedBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.finish(true)
+	return err
+}
+
+func (b *loggedBody) finish(closed bool) {
+	b.once.Do(func() {
+		b.done(b.buf, b.more || closed)
+	})
+}
+
+// readPrefix 最多读取limit+1字节 第二个返回值表示超过limit
+func readPrefix(r io.Reader, limit int) ([]byte, bool) {
+	body, _ := ioutil.ReadAll(io.LimitReader(r, int64(limit)+1))
+	return body, len(body) > limit
+}
+
+// clip 截取前limit字节打印
+func clip(body []byte, more bool, limit int) string {
+	if len(body) > limit {
+		body, more = body[:limit], true
+	}
+	if more {
+		return string(body) + "...(truncated)"
+	}
+	return string(body)
+}
+
+func (al *accessLog) redactURL(u *url.URL) string {
+	if u == nil {
+		return ""
+	}
+	if len(al.params) == 0 || u.RawQuery == "" {
+		return u.String()
+	}
+	query := u.Query()
+	for key := range query {
+		if al.params[key] {
+			query[key] = []string{redacted}
+		}
+	}
+	copied := *u
+	copied.RawQuery = query.Encode()
+	return copied.String()
+}
+
+func (al *accessLog) headers(header http.Header) string {
+	keys := make([]string, 0, len(header))
+	for key := range header {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	parts := make([]string, 0, len(keys))
+	for _, key := range keys {
+		value := strings.Join(header[key], ",")
+		if al.masked[key] {
+			value = redacted
+		}
+		parts = append(parts, key+"="+value)
+	}
+	return "{" + strings.Join(parts, " ") + "}"
+}
+
+// curl 生成等价的curl命令
+func (al *accessLog) curl(req *http.Request, u *url.URL, body []byte, more bool) string {
+	var b strings.Builder
+	b.WriteString("curl -X ")
+	b.WriteString(methodOf(req))
+	b.WriteString(" ")
+	b.WriteString(shellQuote(al.redactURL(u)))
+
+	keys := make([]string, 0, len(req.Header))
+	for key := range req.Header {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		for _, value := range req.Header[key] {
+			if al.masked[key] {
+				value = redacted
+			}
+			b.WriteString(" -H ")
+			b.WriteString(shellQuote(key + ": " + value))
+		}
+	}
+	if len(body) > 0 {
+		b.WriteString(" --data-binary ")
+		b.WriteString(shellQuote(clip(body, more, maxCurlBodySize)))
+	}
+	return b.String()
+}
+
+func shellQuote(s string) string {
+	return "'" + strings.Replace(s, "'", `'\''`, -1) + "'"
+}
+
+func methodOf(req *http.Request) string {
+	if req.Method == "" {
+		return http.MethodGet
+	}
+	return req.Method
+}
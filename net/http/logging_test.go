@@ -0,0 +1,156 @@
+package http
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Tokumicn/lego-lib/logs"
+)
+
+type recordLogger struct {
+	lines []string
+}
+
+func (l *recordLogger) log(level string, v ...interface{}) {
+	l.lines = append(l.lines, level+" "+fmt.Sprint(v...))
+}
+func (l *recordLogger) Debug(v ...interface{}) { l.log("debug", v...) }
+func (l *recordLogger) Info(v ...interface{})  { l.log("info", v...) }
+func (l *recordLogger) Warn(v ...interface{})  { l.log("warn", v...) }
+func (l *recordLogger) Error(v ...interface{}) { l.log("error", v...) }
+func (l *recordLogger) Fatal(v ...interface{}) { l.log("fatal", v...) }
+func (l *recordLogger) Debugf(format string, v ...interface{}) {
+	l.log("debug", fmt.Sprintf(format, v...))
+}
+func (l *recordLogger) Infof(format string, v ...interface{}) {
+	l.log("info", fmt.Sprintf(format, v...))
+}
+func (l *recordLogger) Warnf(format string, v ...interface{}) {
+	l.log("warn", fmt.Sprintf(format, v...))
+}
+func (l *recordLogger) Errorf(format string, v ...interface{}) {
+	l.log("error", fmt.Sprintf(format, v...))
+}
+func (l *recordLogger) Fatalf(format string, v ...interface{}) {
+	l.log("fatal", fmt.Sprintf(format, v...))
+}
+
+func TestAccessLog(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(strings.Repeat("x", 20)))
+	}))
+	defer srv.Close()
+
+	logger := &recordLogger{}
+	client := NewClient()
+	client.Use(AccessLog(AccessLogConfig{
+		RedactParams: []string{"token"},
+		LogHeaders:   true,
+		MaxBodySize:  8,
+		Curl:         true,
+		Logger:       func(context.Context) logs.Logger { return logger },
+	}))
+
+	body, r := client.NewRequest(srv.URL).Post().SetParam("token", "secret").SetParam("id", 1).
+		AddHeader("Authorization", "Bearer secret").SetJSONBody(map[string]string{"name": "it's"}).ToString()
+	if r.Error != nil || len(body) != 20 {
+		t.Fatalf("body %q %v", body, r.Error)
+	}
+	if len(logger.lines) != 2 {
+		t.Fatalf("lines %v", logger.lines)
+	}
+
+	access, curl := logger.lines[0], logger.lines[1]
+	for _, want := range []string{"info http client POST", "token=REDACTED", "status:200", "attempts:1",
+		"Authorization=REDACTED", `req_body:{"name":...(truncated)`, "resp_body:xxxxxxxx...(truncated)"} {
+		if !strings.Contains(access, want) {
+			t.Errorf("access log missing %q: %s", want, access)
+		}
+	}
+	if strings.Contains(access+curl, "secret") {
+		t.Errorf("secret leaked: %s %s", access, curl)
+	}
+	if !strings.HasPrefix(curl, "debug curl -X POST '") || !strings.Contains(curl, `-H 'Authorization: REDACTED'`) ||
+		!strings.Contains(curl, `--data-binary '{"name":"it'\''s"}'`) {
+		t.Errorf("curl %s", curl)
+	}
+}
+
+// TestAccessLogMultipart 记录日志不消费multipart请求体中的文件内容
+func TestAccessLogMultipart(t *testing.T) {
+	content := bytes.Repeat([]byte("0123456789"), 20000)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		file, _, err := r.FormFile("file")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		data, _ := ioutil.ReadAll(file)
+		fmt.Fprint(w, len(data))
+	}))
+	defer srv.Close()
+
+	logger := &recordLogger{}
+	client := NewClient()
+	client.Use(AccessLog(AccessLogConfig{
+		MaxBodySize: 64,
+		Curl:        true,
+		Logger:      func(context.Context) logs.Logger { return logger },
+	}))
+
+	body, r := client.NewRequest(srv.URL).Post().AddFile("file", "a.bin", bytes.NewReader(content)).ToString()
+	if r.Error != nil || body != fmt.Sprint(len(content)) {
+		t.Fatalf("upload got %s err %v", body, r.Error)
+	}
+}
+
+// TestAccessLogStream 记录响应体不等待流式响应 关闭时打印已读取的部分
+func TestAccessLogStream(t *testing.T) {
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Write([]byte("data: hello\n\n"))
+		w.(http.Flusher).Flush()
+		<-release
+	}))
+	defer srv.Close()
+	defer close(release)
+
+	logger := &recordLogger{}
+	client := NewClient()
+	client.Use(AccessLog(AccessLogConfig{Logger: func(context.Context) logs.Logger { return logger }}))
+
+	events := make(chan *SSEEvent, 1)
+	var body io.ReadCloser
+	go func() {
+		var r Response
+		if body, r = client.NewRequest(srv.URL).Stream(); r.Error != nil {
+			t.Errorf("stream err %v", r.Error)
+			close(events)
+			return
+		}
+		event, _ := NewSSEReader(body).Next()
+		events <- event
+	}()
+	select {
+	case event := <-events:
+		if event == nil || event.Data != "hello" {
+			t.Fatalf("event %+v", event)
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatal("first event not delivered")
+	}
+
+	body.Close()
+	if len(logger.lines) != 1 || !strings.Contains(logger.lines[0], "resp_body:data: hello") {
+		t.Errorf("lines %v", logger.lines)
+	}
+}
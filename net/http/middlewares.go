@@ -1,32 +1,68 @@
 package http
 
-import "net/http"
+import (
+	"net/http"
+	"time"
+)
 
+// Middleware 洋葱模型的请求上下文 Next之前可修改请求 Next之后可读取响应
 type Middleware interface {
+	// Next 执行之后的middleware并发送请求 再次调用会重新执行之后的middleware并重发
+	// middleware未调用Next且未Stop时返回后自动执行之后的middleware
 	Next()
 	Stop(...error)
 	GetRequest() *http.Request
 	GetRespone() (*http.Response, error)
+	// SetResponse 直接以resp作为结果 不再发送请求 之后的middleware不再执行
+	SetResponse(resp *http.Response)
+	// ReadBody 读取解码后的完整响应体 之后的middleware与调用方仍可读取
+	ReadBody() ([]byte, error)
+	// GetDuration 最近一次Next中发送请求的耗时 包括重试
+	GetDuration() time.Duration
+	// GetAttempts 最近一次Next中的尝试次数
+	GetAttempts() int
+	GetName() string
 	getStop() bool
+	getMetrics() Prometheus
+	// onAttempt 注册每次尝试发送前执行的hook 用于每次重新签名等
+	onAttempt(hook func(*http.Request) error)
 }
 
-var middlewares []Handler
-
 type Handler func(Middleware)
 
+// UseMiddleware 为DefaultClient与DefaultH2CClient注册middleware
+// 自行创建的Client通过Client.Use注册 单个请求通过Request.Use注册
 func UseMiddleware(handle ...Handler) {
-	middlewares = append(middlewares, handle...)
+	DefaultClient.Use(handle...)
+	DefaultH2CClient.Use(handle...)
+}
+
+// chain 按注册顺序执行 先注册的在外层
+type chain struct {
+	handlers []Handler
+	index    int
+	called   bool
 }
 
-func handle(request Middleware) {
-	if len(middlewares) == 0 {
-		request.Next()
+// run 从第i个middleware开始执行 全部执行完后发送请求
+func (fr *FastRequest) run(i int) {
+	if fr.stop {
 		return
 	}
-	for i := 0; i < len(middlewares); i++ {
-		middlewares[i](request)
-		if request.getStop() {
-			return
-		}
+	if i >= len(fr.chain.handlers) {
+		start := time.Now()
+		fr.responseError = fr.do()
+		fr.duration = time.Since(start)
+		return
+	}
+
+	index, called := fr.chain.index, fr.chain.called
+	fr.chain.index, fr.chain.called = i, false
+	fr.chain.handlers[i](fr)
+	next := !fr.chain.called
+	fr.chain.index, fr.chain.called = index, called
+
+	if next {
+		fr.run(i + 1)
 	}
 }
@@ -0,0 +1,63 @@
+package http
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+func TestMiddlewareChain(t *testing.T) {
+	var calls int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.Write([]byte("hello"))
+	}))
+	defer srv.Close()
+
+	var trace []string
+	mark := func(name string) Handler {
+		return func(m Middleware) {
+			trace = append(trace, name+">")
+			m.Next()
+			trace = append(trace, "<"+name)
+		}
+	}
+	// 未调用Next的middleware
+	passive := func(m Middleware) {
+		trace = append(trace, "passive")
+	}
+	var body string
+	inspect := func(m Middleware) {
+		m.Next()
+		b, err := m.ReadBody()
+		if err != nil {
+			t.Error(err)
+		}
+		body = string(b)
+		if m.GetDuration() <= 0 || m.GetAttempts() != 1 {
+			t.Errorf("duration %v attempts %d", m.GetDuration(), m.GetAttempts())
+		}
+	}
+
+	client := NewClient()
+	client.Use(mark("a"), passive)
+	got, r := client.NewRequest(srv.URL).Use(mark("b"), inspect).ToString()
+	if r.Error != nil || got != "hello" || body != "hello" {
+		t.Fatalf("got %q %q %v", got, body, r.Error)
+	}
+	if calls != 1 {
+		t.Errorf("request sent %d times", calls)
+	}
+	if s := strings.Join(trace, " "); s != "a> passive b> <b <a" {
+		t.Errorf("order %s", s)
+	}
+
+	// 没有middleware调用Next时同样发送
+	client = NewClient()
+	client.Use(passive)
+	if _, r := client.NewRequest(srv.URL).ToString(); r.Error != nil || calls != 2 {
+		t.Errorf("passive chain got %v calls %d", r.Error, calls)
+	}
+}
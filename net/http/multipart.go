@@ -0,0 +1,183 @@
+package http
+
+import (
+	"io"
+	"io/ioutil"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"sync"
+)
+
+type formFile struct {
+	field    string
+	filename string
+	reader   io.Reader
+	offset   int64 // reader为io.Seeker时的起始位置 重试时回到该位置
+}
+
+// SetForm 设置表单字段 未添加文件时以application/x-www-form-urlencoded发送
+func (fr *FastRequest) SetForm(form url.Values) Request {
+	if fr.form == nil {
+		fr.form = make(url.Values)
+	}
+	for key, values := range form {
+		fr.form[key] = append(fr.form[key], values...)
+	}
+	return fr
+}
+
+// AddFormField 添加单个表单字段
+func (fr *FastRequest) AddFormField(field, value string) Request {
+	if fr.form == nil {
+		fr.form = make(url.Values)
+	}
+	fr.form.Add(field, value)
+	return fr
+}
+
+// AddFile 添加文件 请求以multipart/form-data发送 文件内容在发送时流式读取
+// reader实现io.Seeker时请求体可以在重试时重新读取
+func (fr *FastRequest) AddFile(field, filename string, reader io.Reader) Request {
+	file := formFile{field: field, filename: filename, reader: reader, offset: -1}
+	if seeker, ok := reader.(io.Seeker); ok {
+		if offset, err := seeker.Seek(0, io.SeekCurrent); err == nil {
+			file.offset = offset
+		}
+	}
+	fr.files = append(fr.files, file)
+	return fr
+}
+
+// OnUploadProgress 设置上传进度回调 sent为已发送字节数 total未知时为-1
+// 每次重试从0开始计数
+func (fr *FastRequest) OnUploadProgress(fn func(sent, total int64)) Request {
+	fr.progress = fn
+	return fr
+}
+
+// prepareForm 根据表单与文件生成请求体
+func (fr *FastRequest) prepareForm() {
+	if len(fr.files) == 0 {
+		if fr.form != nil {
+			fr.setBody([]byte(fr.form.Encode()))
+			fr.resq.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		}
+		return
+	}
+
+	boundary := multipart.NewWriter(ioutil.Discard).Boundary()
+	open := func() (io.ReadCloser, error) {
+		return fr.multipartBody(boundary), nil
+	}
+
+	fr.resq.Header.Set("Content-Type", "multipart/form-data; boundary="+boundary)
+	fr.resq.ContentLength = -1
+	fr.resq.Body = &lazyBody{open: open}
+	fr.resq.GetBody = nil
+
+	for _, file := range fr.files {
+		if file.offset < 0 {
+			return
+		}
+	}
+	fr.resq.GetBody = func() (io.ReadCloser, error) {
+		for _, file := range fr.files {
+			if _, err := file.reader.(io.Seeker).Seek(file.offset, io.SeekStart); err != nil {
+				return nil, err
+			}
+		}
+		return &lazyBody{open: open}, nil
+	}
+}
+
+// multipartBody 通过管道边读文件边发送 不在内存中保存整个请求体
+func (fr *FastRequest) multipartBody(boundary string) io.ReadCloser {
+	pr, pw := io.Pipe()
+	go func() {
+		writer := multipart.NewWriter(pw)
+		writer.SetBoundary(boundary)
+		pw.CloseWithError(writeMultipart(writer, fr.form, fr.files))
+	}()
+	return pr
+}
+
+func writeMultipart(writer *multipart.Writer, form url.Values, files []formFile) error {
+	for field, values := range form {
+		for _, value := range values {
+			if err := writer.WriteField(field, value); err != nil {
+				return err
+			}
+		}
+	}
+	for _, file := range files {
+		part, err := writer.CreateFormFile(file.field, file.filename)
+		if err != nil {
+			return err
+		}
+		if _, err := io.Copy(part, file.reader); err != nil {
+			return err
+		}
+	}
+	return writer.Close()
+}
+
+// lazyBody 首次Read时才创建请求体 请求未发出时不启动写入协程
+type lazyBody struct {
+	open func() (io.ReadCloser, error)
+
+	once sync.Once
+	body io.ReadCloser
+	err  error
+}
+
+func (l *lazyBody) Read(p []byte) (int, error) {
+	l.once.Do(func() {
+		l.body, l.err = l.open()
+	})
+	if l.err != nil {
+		return 0, l.err
+	}
+	return l.body.Read(p)
+}
+
+// Close 未读取过时不再创建请求体
+func (l *lazyBody) Close() error {
+	l.once.Do(func() {
+		l.err = http.ErrBodyReadAfterClose
+	})
+	if l.body == nil {
+		return nil
+	}
+	return l.body.Close()
+}
+
+// progressBody 统计已发送字节数
+type progressBody struct {
+	io.ReadCloser
+	sent  int64
+	total int64
+	fn    func(sent, total int64)
+}
+
+func (p *progressBody) Read(b []byte) (int, error) {
+	n, err := p.ReadCloser.Read(b)
+	if n > 0 {
+		p.sent += int64(n)
+		p.fn(p.sent, p.total)
+	}
+	return n, err
+}
+
+// withProgress 为本次发送的请求体加上进度统计
+func withProgress(req *http.Request, fn func(sent, total int64)) *http.Request {
+	if fn == nil || req.Body == nil || req.Body == http.NoBody {
+		return req
+	}
+	total := req.ContentLength
+	if total <= 0 {
+		total = -1
+	}
+	req.Body = &progressBody{ReadCloser: req.Body, total: total, fn: fn}
+	return req
+}
@@ -0,0 +1,59 @@
+package http
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestMultipartUpload(t *testing.T) {
+	var calls int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if calls == 1 {
+			ioutil.ReadAll(r.Body)
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		file, header, err := r.FormFile("file")
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		defer file.Close()
+		content, _ := ioutil.ReadAll(file)
+		w.Write([]byte(r.FormValue("name") + ":" + header.Filename + ":" + string(content)))
+	}))
+	defer srv.Close()
+
+	var sent int64
+	body, r := NewClient().NewRequest(srv.URL).Post().
+		Retry(&RetryPolicy{MaxAttempts: 2, RetryNonIdempotent: true}).
+		AddFormField("name", "report").
+		AddFile("file", "a.txt", strings.NewReader("hello")).
+		OnUploadProgress(func(n, total int64) { sent = n }).
+		ToString()
+	if r.Error != nil {
+		t.Fatal(r.Error)
+	}
+	if body != "report:a.txt:hello" {
+		t.Errorf("got %q", body)
+	}
+	if calls != 2 || sent == 0 {
+		t.Errorf("calls %d sent %d", calls, sent)
+	}
+}
+
+func TestFormBody(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.Header.Get("Content-Type") + ":" + r.FormValue("q")))
+	}))
+	defer srv.Close()
+
+	body, r := NewClient().NewRequest(srv.URL).Post().AddFormField("q", "go").ToString()
+	if r.Error != nil || body != "application/x-www-form-urlencoded:go" {
+		t.Errorf("got %q %v", body, r.Error)
+	}
+}
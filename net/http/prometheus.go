@@ -0,0 +1,119 @@
+package http
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// 客户端监控标签 gin服务端监控使用相同的标签名
+var clientLabels = []string{"domain", "code", "protocol", "method", "tag"}
+
+// PrometheusMetrics 基于prometheus client_golang的Prometheus实现
+type PrometheusMetrics struct {
+	requests *prometheus.CounterVec
+	latency  *prometheus.HistogramVec
+	breakers *prometheus.GaugeVec
+}
+
+// NewPrometheusMetrics 创建PrometheusMetrics并注册到registerer
+// registerer为nil时使用prometheus.DefaultRegisterer 已注册过的同名指标直接复用
+func NewPrometheusMetrics(namespace string, registerer prometheus.Registerer) (*PrometheusMetrics, error) {
+	if registerer == nil {
+		registerer = prometheus.DefaultRegisterer
+	}
+
+	requests := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "http_client",
+		Name:      "requests_total",
+		Help:      "Total number of http client requests.",
+	}, clientLabels)
+	latency := prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "http_client",
+		Name:      "request_duration_seconds",
+		Help:      "Latency of http client requests.",
+		Buckets:   prometheus.DefBuckets,
+	}, clientLabels)
+	breakers := prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "http_client",
+		Name:      "circuit_breaker_state",
+		Help:      "Circuit breaker state: 0 closed, 1 open, 2 half-open.",
+	}, []string{"key"})
+
+	m := &PrometheusMetrics{}
+	var err error
+	if m.requests, err = registerCounterVec(registerer, requests); err != nil {
+		return nil, err
+	}
+	if m.latency, err = registerHistogramVec(registerer, latency); err != nil {
+		return nil, err
+	}
+	if m.breakers, err = registerGaugeVec(registerer, breakers); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// UsePrometheus 以PrometheusMetrics替换默认的空实现PrometheusImpl
+func UsePrometheus(namespace string) error {
+	m, err := NewPrometheusMetrics(namespace, nil)
+	if err != nil {
+		return err
+	}
+	PrometheusImpl = m
+	return nil
+}
+
+// HttpClientWithLabelValues 记录请求数与耗时
+func (m *PrometheusMetrics) HttpClientWithLabelValues(domain, httpCode, protocol, method, tag string, starTime time.Time) {
+	m.requests.WithLabelValues(domain, httpCode, protocol, method, tag).Inc()
+	m.latency.WithLabelValues(domain, httpCode, protocol, method, tag).Observe(time.Since(starTime).Seconds())
+}
+
+// CircuitBreakerWithLabelValues 记录熔断器状态
+func (m *PrometheusMetrics) CircuitBreakerWithLabelValues(key, state string) {
+	var value float64
+	switch state {
+	case StateOpen.String():
+		value = float64(StateOpen)
+	case StateHalfOpen.String():
+		value = float64(StateHalfOpen)
+	}
+	m.breakers.WithLabelValues(key).Set(value)
+}
+
+func registerCounterVec(registerer prometheus.Registerer, c *prometheus.CounterVec) (*prometheus.CounterVec, error) {
+	if err := registerer.Register(c); err != nil {
+		are, ok := err.(prometheus.AlreadyRegisteredError)
+		if !ok {
+			return nil, err
+		}
+		return are.ExistingCollector.(*prometheus.CounterVec), nil
+	}
+	return c, nil
+}
+
+func registerHistogramVec(registerer prometheus.Registerer, h *prometheus.HistogramVec) (*prometheus.HistogramVec, error) {
+	if err := registerer.Register(h); err != nil {
+		are, ok := err.(prometheus.AlreadyRegisteredError)
+		if !ok {
+			return nil, err
+		}
+		return are.ExistingCollector.(*prometheus.HistogramVec), nil
+	}
+	return h, nil
+}
+
+func registerGaugeVec(registerer prometheus.Registerer, g *prometheus.GaugeVec) (*prometheus.GaugeVec, error) {
+	if err := registerer.Register(g); err != nil {
+		are, ok := err.(prometheus.AlreadyRegisteredError)
+		if !ok {
+			return nil, err
+		}
+		return are.ExistingCollector.(*prometheus.GaugeVec), nil
+	}
+	return g, nil
+}
@@ -0,0 +1,30 @@
+package http
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestPrometheusMetrics(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer srv.Close()
+
+	m, err := NewPrometheusMetrics("test", prometheus.NewRegistry())
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := NewClient(WithMetrics(m))
+	if _, r := client.NewRequest(srv.URL).Get().SetName("ping").ToBytes(); r.Error != nil {
+		t.Fatal(r.Error)
+	}
+
+	u, _ := url.Parse(srv.URL)
+	if n := testutil.ToFloat64(m.requests.WithLabelValues(u.Host, "200", "HTTP/1.1", "GET", "ping")); n != 1 {
+		t.Errorf("requests got %v", n)
+	}
+}
@@ -2,16 +2,30 @@ package http
 
 import (
 	"context"
+	"errors"
+	"io"
 	"net/http"
+	"net/url"
 	"time"
 )
 
-var PrometheusImpl prometheus
+// PrometheusImpl 未通过WithMetrics设置监控的Client使用的上报实现
+var PrometheusImpl Prometheus
 
-type prometheus interface {
+// ErrBodyTooLarge 响应体超过SetMaxBodySize或WithMaxBodySize设置的长度
+var ErrBodyTooLarge = errors.New("http: response body too large")
+
+// Prometheus 客户端请求监控上报接口
+type Prometheus interface {
 	HttpClientWithLabelValues(domain, httpCode, protocol, method, tag string, starTime time.Time)
 }
 
+// BreakerMetrics 熔断器状态上报接口 Client的Prometheus实现该接口时上报熔断器状态切换
+type BreakerMetrics interface {
+	// CircuitBreakerWithLabelValues 熔断器状态切换时调用 key为host或SetName标签
+	CircuitBreakerWithLabelValues(key, state string)
+}
+
 type mockPrometheusImpl struct {
 }
 
@@ -31,7 +45,12 @@ type Request interface {
 	Head() Request
 	SetJSONBody(obj interface{}) Request
 	SetBody(byts []byte) Request
+	SetForm(form url.Values) Request
+	AddFormField(field, value string) Request
+	AddFile(field, filename string, reader io.Reader) Request
+	OnUploadProgress(fn func(sent, total int64)) Request
 	ToJSON(obj interface{}) Response
+	ToJSONWithError(ok, errBody interface{}) Response
 	ToString() (string, Response)
 	ToBytes() ([]byte, Response)
 	ToXML(v interface{}) Response
@@ -44,6 +63,17 @@ type Request interface {
 	Singleflight(key ...interface{}) Request
 	SetName(name string) Request
 	GetName() string
+	Retry(policy *RetryPolicy) Request
+	IgnoreStatusError() Request
+	BalanceKey(key string) Request
+	Hedge(after time.Duration, max int) Request
+	AttemptTimeout(timeout time.Duration) Request
+	Use(handlers ...Handler) Request
+	SetCompressedBody(codec Codec) Request
+	SetMaxBodySize(n int64) Request
+	ToWriter(w io.Writer) Response
+	ToFile(path string) Response
+	Stream() (io.ReadCloser, Response)
 }
 
 // Response .
@@ -1,9 +1,12 @@
-package http
+package http_test
 
 import (
 	"fmt"
 	"sync"
 	"testing"
+
+	lhttp "github.com/Tokumicn/lego-lib/net/http"
+	"github.com/Tokumicn/lego-lib/net/http/httpmock"
 )
 
 type testData struct {
@@ -23,16 +26,37 @@ type testData struct {
 	} `json:"data"`
 }
 
+const demoAPI = "https://api.testing.com/testing-logic/v1/demoapi?userId=123456"
+
+// useDemoAPI 回放testdata/demoapi.json HTTPMOCK_RECORD=1时请求真实接口并更新
+func useDemoAPI(t *testing.T) *httpmock.Recorder {
+	rec, err := httpmock.NewRecorder(httpmock.ModeFromEnv(), "testdata/demoapi.json", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	restore := httpmock.Activate(rec)
+	t.Cleanup(func() {
+		restore()
+		if err := rec.Save(); err != nil {
+			t.Error(err)
+		}
+	})
+	return rec
+}
+
 func TestMiddlewares(t *testing.T) {
-	UseMiddleware(NewTestMiddlewares())
+	client := lhttp.NewClient(lhttp.WithTransport(useDemoAPI(t)))
+	client.Use(NewTestMiddlewares())
 	var data testData
-	rep := NewFastRequest("https://api.testing.com/testing-logic/v1/demoapi?userId=123456").Get().ToJSON(&data)
-	t.Log(rep)
+	rep := client.NewRequest(demoAPI).Get().ToJSON(&data)
+	if rep.Error != nil {
+		t.Fatal(rep.Error)
+	}
 	t.Log(data)
 }
 
-func NewTestMiddlewares() Handler {
-	return func(middle Middleware) {
+func NewTestMiddlewares() lhttp.Handler {
+	return func(middle lhttp.Middleware) {
 		fmt.Println("开始")
 		middle.Next()
 		fmt.Println("结束")
@@ -40,23 +64,23 @@ func NewTestMiddlewares() Handler {
 }
 
 func TestH1cPress(t *testing.T) {
-	UseMiddleware(NewTestMiddlewares())
+	useDemoAPI(t)
 	var wait sync.WaitGroup
 	for i := 0; i < 100; i++ {
 		wait.Add(1)
 		go func() {
+			defer wait.Done()
 			var data testData
-			req := NewFastRequest("https://api.testing.com/testing-logic/v1/demoapi?userId=123456").Get()
+			req := lhttp.NewFastRequest(demoAPI).Get()
 			//req.Singleflight("hahahah", "uuuua", "fff")
 			rep := req.ToJSON(&data)
 			if rep.Error != nil {
-				panic(rep.Error)
+				t.Error(rep.Error)
+				return
 			}
 			if data.Data[0].Grade != 6 {
-				panic("?????????????")
+				t.Error("?????????????")
 			}
-			fmt.Println(data)
-			wait.Done()
 		}()
 	}
 	wait.Wait()
@@ -0,0 +1,150 @@
+package http
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Endpoint 服务实例
+type Endpoint struct {
+	Addr   string `json:"addr"`   // host:port
+	Scheme string `json:"scheme"` // 默认http
+	Weight int    `json:"weight"` // 默认1
+}
+
+// Resolver 将服务名解析为实例列表
+type Resolver interface {
+	Resolve(ctx context.Context, service string) ([]Endpoint, error)
+}
+
+// StaticResolver 固定的服务实例
+type StaticResolver map[string][]Endpoint
+
+// Resolve 实现Resolver
+func (r StaticResolver) Resolve(ctx context.Context, service string) ([]Endpoint, error) {
+	endpoints, ok := r[service]
+	if !ok {
+		return nil, fmt.Errorf("http: service %q not found", service)
+	}
+	return endpoints, nil
+}
+
+// DNSResolver 通过DNS SRV记录解析 查询_service._proto.name.domain
+type DNSResolver struct {
+	// Service SRV服务名 为空时直接查询name.domain的SRV记录
+	Service string
+	// Proto 默认tcp
+	Proto string
+	// Domain 追加在服务名后的域 如service.consul
+	Domain string
+	// Scheme 实例使用的协议 默认http
+	Scheme string
+	// Resolver 默认net.DefaultResolver
+	Resolver *net.Resolver
+}
+
+// Resolve 实现Resolver SRV权重为0时按1处理
+func (r *DNSResolver) Resolve(ctx context.Context, service string) ([]Endpoint, error) {
+	resolver := r.Resolver
+	if resolver == nil {
+		resolver = net.DefaultResolver
+	}
+	proto := r.Proto
+	if proto == "" && r.Service != "" {
+		proto = "tcp"
+	}
+	name := service
+	if r.Domain != "" {
+		name = service + "." + strings.TrimPrefix(r.Domain, ".")
+	}
+
+	_, srvs, err := resolver.LookupSRV(ctx, r.Service, proto, name)
+	if err != nil {
+		return nil, err
+	}
+	endpoints := make([]Endpoint, 0, len(srvs))
+	for _, srv := range srvs {
+		endpoints = append(endpoints, Endpoint{
+			Addr:   net.JoinHostPort(strings.TrimSuffix(srv.Target, "."), strconv.Itoa(int(srv.Port))),
+			Scheme: r.Scheme,
+			Weight: int(srv.Weight),
+		})
+	}
+	return endpoints, nil
+}
+
+// FileResolver 从JSON文件读取服务实例 文件修改后自动重新加载
+//
+//	{"orders": [{"addr": "10.0.0.1:8080", "weight": 2}, {"addr": "10.0.0.2:8080"}]}
+type FileResolver struct {
+	path     string
+	interval time.Duration
+
+	mu       sync.Mutex
+	checked  time.Time
+	modTime  time.Time
+	services map[string][]Endpoint
+}
+
+// NewFileResolver 创建FileResolver interval为检查文件修改的最小间隔 默认1s
+func NewFileResolver(path string, interval time.Duration) (*FileResolver, error) {
+	if interval <= 0 {
+		interval = time.Second
+	}
+	r := &FileResolver{path: path, interval: interval}
+	if err := r.reload(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Resolve 实现Resolver 重新加载失败时继续使用上次加载的内容
+func (r *FileResolver) Resolve(ctx context.Context, service string) ([]Endpoint, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if time.Since(r.checked) >= r.interval {
+		r.reloadLocked()
+	}
+	endpoints, ok := r.services[service]
+	if !ok {
+		return nil, fmt.Errorf("http: service %q not found in %s", service, r.path)
+	}
+	return endpoints, nil
+}
+
+func (r *FileResolver) reload() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.reloadLocked()
+}
+
+func (r *FileResolver) reloadLocked() error {
+	r.checked = time.Now()
+	info, err := os.Stat(r.path)
+	if err != nil {
+		return err
+	}
+	if r.services != nil && info.ModTime().Equal(r.modTime) {
+		return nil
+	}
+
+	byts, err := ioutil.ReadFile(r.path)
+	if err != nil {
+		return err
+	}
+	var services map[string][]Endpoint
+	if err := json.Unmarshal(byts, &services); err != nil {
+		return fmt.Errorf("http: decode %s: %w", r.path, err)
+	}
+	r.services = services
+	r.modTime = info.ModTime()
+	return nil
+}
@@ -0,0 +1,139 @@
+package http
+
+import (
+	"context"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// RetryPolicy 请求重试策略
+// 连接错误 5xx与429时重试 429与503优先使用响应头Retry-After作为等待时间
+type RetryPolicy struct {
+	// MaxAttempts 最大尝试次数 包含首次请求
+	MaxAttempts int
+	// BaseDelay 首次重试的退避时间 之后每次翻倍
+	BaseDelay time.Duration
+	// MaxDelay 退避时间上限
+	MaxDelay time.Duration
+	// RetryNonIdempotent 为true时POST等非幂等请求也会重试
+	// 默认只重试幂等方法 或带Idempotency-Key请求头的请求
+	RetryNonIdempotent bool
+	// ShouldRetry 自定义是否重试 为nil时使用默认规则
+	ShouldRetry func(resp *http.Response, err error) bool
+}
+
+// DefaultRetryPolicy 最多3次 100ms起指数退避 上限2s
+func DefaultRetryPolicy() *RetryPolicy {
+	return &RetryPolicy{
+		MaxAttempts: 3,
+		BaseDelay:   100 * time.Millisecond,
+		MaxDelay:    2 * time.Second,
+	}
+}
+
+var idempotentMethods = map[string]bool{
+	http.MethodGet:     true,
+	http.MethodHead:    true,
+	http.MethodOptions: true,
+	http.MethodTrace:   true,
+	http.MethodPut:     true,
+	http.MethodDelete:  true,
+}
+
+// next 判断第attempt次请求后是否重试 返回等待时间
+func (p *RetryPolicy) next(attempt int, req *http.Request, resp *http.Response, err error) (time.Duration, bool) {
+	if p == nil || attempt >= p.MaxAttempts {
+		return 0, false
+	}
+	if req.Context().Err() != nil {
+		return 0, false
+	}
+	if !p.RetryNonIdempotent && !isIdempotent(req) {
+		return 0, false
+	}
+	if req.Body != nil && req.Body != http.NoBody && req.GetBody == nil {
+		return 0, false
+	}
+
+	retry := false
+	if p.ShouldRetry != nil {
+		retry = p.ShouldRetry(resp, err)
+	} else if err != nil {
+		retry = true
+	} else {
+		retry = resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500
+	}
+	if !retry {
+		return 0, false
+	}
+
+	if resp != nil {
+		if wait, ok := retryAfter(resp); ok {
+			return wait, true
+		}
+	}
+	return p.backoff(attempt), true
+}
+
+// backoff 指数退避 在[d/2, d]之间随机 避免大量客户端同时重试
+func (p *RetryPolicy) backoff(attempt int) time.Duration {
+	d := p.BaseDelay
+	for i := 1; i < attempt && d < p.MaxDelay; i++ {
+		d *= 2
+	}
+	if p.MaxDelay > 0 && d > p.MaxDelay {
+		d = p.MaxDelay
+	}
+	if d <= 0 {
+		return 0
+	}
+	half := d / 2
+	return half + time.Duration(rand.Int63n(int64(d-half)+1))
+}
+
+func isIdempotent(req *http.Request) bool {
+	if req.Header.Get("Idempotency-Key") != "" {
+		return true
+	}
+	method := req.Method
+	if method == "" {
+		method = http.MethodGet
+	}
+	return idempotentMethods[method]
+}
+
+func retryAfter(resp *http.Response) (time.Duration, bool) {
+	if resp.StatusCode != http.StatusTooManyRequests && resp.StatusCode != http.StatusServiceUnavailable {
+		return 0, false
+	}
+	value := resp.Header.Get("Retry-After")
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second, true
+	}
+	if t, err := http.ParseTime(value); err == nil {
+		if d := time.Until(t); d > 0 {
+			return d, true
+		}
+		return 0, true
+	}
+	return 0, false
+}
+
+func sleepContext(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
@@ -0,0 +1,45 @@
+package http
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRetry(t *testing.T) {
+	var calls int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		if string(body) != "payload" {
+			t.Errorf("attempt body got %q", body)
+		}
+		if atomic.AddInt32(&calls, 1) < 3 {
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte("ok"))
+	}))
+	defer srv.Close()
+
+	client := NewClient()
+	policy := &RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond}
+
+	value, r := client.NewRequest(srv.URL).Put().SetBody([]byte("payload")).Retry(policy).ToString()
+	if r.Error != nil || value != "ok" {
+		t.Fatalf("got %q %v", value, r.Error)
+	}
+	if calls != 3 {
+		t.Errorf("calls got %d", calls)
+	}
+
+	// POST默认不重试
+	atomic.StoreInt32(&calls, 0)
+	_, r = client.NewRequest(srv.URL).Post().SetBody([]byte("payload")).Retry(policy).ToString()
+	if r.Error == nil || calls != 1 {
+		t.Errorf("post got calls %d err %v", calls, r.Error)
+	}
+}
@@ -0,0 +1,208 @@
+package http
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// ToWriter 将响应体流式写入w 不经过Singleflight与最大长度限制
+func (fr *FastRequest) ToWriter(w io.Writer) (r Response) {
+	r = fr.send()
+	if r.Error != nil {
+		return
+	}
+
+	reader, err := fr.bodyReader()
+	if err != nil {
+		r.Error = err
+		return
+	}
+	defer reader.Close()
+
+	_, r.Error = io.Copy(w, reader)
+	return
+}
+
+// Stream 返回响应体 调用方负责Close 不经过Singleflight与最大长度限制
+func (fr *FastRequest) Stream() (body io.ReadCloser, r Response) {
+	r = fr.send()
+	if r.Error != nil {
+		return
+	}
+	body, r.Error = fr.bodyReader()
+	return
+}
+
+// ToFile 下载到path 文件已存在时通过Range请求续传
+// 服务端不支持Range时重新下载整个文件 Range按未压缩的内容计算 请求时不协商压缩
+// 服务端忽略identity返回压缩的206响应时返回错误
+func (fr *FastRequest) ToFile(path string) (r Response) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		r.Error = err
+		return
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		r.Error = err
+		return
+	}
+	offset := info.Size()
+	fr.resq.Header.Set("Accept-Encoding", "identity")
+	if offset > 0 {
+		fr.resq.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+	}
+
+	r = fr.send()
+	// 文件已完整下载
+	if r.Error != nil && offset > 0 && fr.resp != nil && fr.resp.StatusCode == http.StatusRequestedRangeNotSatisfiable {
+		r = Response{}
+		fr.httpRespone(&r)
+		return
+	}
+	if r.Error != nil {
+		return
+	}
+	defer fr.resp.Body.Close()
+
+	switch {
+	case fr.resp.StatusCode == http.StatusPartialContent:
+		// 压缩后的部分内容不从帧边界开始 无法解码续传
+		if encoding := fr.resp.Header.Get("Content-Encoding"); encoding != "" && !strings.EqualFold(encoding, "identity") {
+			r.Error = fmt.Errorf("http: cannot resume download with Content-Encoding %q", encoding)
+			return
+		}
+		start, ok := contentRangeStart(fr.resp.Header.Get("Content-Range"))
+		if !ok || start != offset {
+			r.Error = fmt.Errorf("http: unexpected Content-Range %q for offset %d",
+				fr.resp.Header.Get("Content-Range"), offset)
+			return
+		}
+		_, r.Error = file.Seek(offset, io.SeekStart)
+	default:
+		if r.Error = file.Truncate(0); r.Error == nil {
+			_, r.Error = file.Seek(0, io.SeekStart)
+		}
+	}
+	if r.Error != nil {
+		return
+	}
+
+	// 服务端忽略identity时按Content-Encoding解码
+	body, err := fr.bodyReader()
+	if err != nil {
+		r.Error = err
+		return
+	}
+	defer body.Close()
+	_, r.Error = io.Copy(file, body)
+	return
+}
+
+// contentRangeStart 解析 bytes start-end/size 中的start
+func contentRangeStart(contentRange string) (int64, bool) {
+	if !strings.HasPrefix(contentRange, "bytes ") {
+		return 0, false
+	}
+	spec := strings.TrimPrefix(contentRange, "bytes ")
+	i := strings.IndexByte(spec, '-')
+	if i <= 0 {
+		return 0, false
+	}
+	start, err := strconv.ParseInt(spec[:i], 10, 64)
+	return start, err == nil
+}
+
+// NDJSONDecoder 逐行解码换行分隔的json(application/x-ndjson)
+type NDJSONDecoder struct {
+	decoder *json.Decoder
+}
+
+// NewNDJSONDecoder 创建NDJSONDecoder 通常配合Stream使用
+func NewNDJSONDecoder(r io.Reader) *NDJSONDecoder {
+	return &NDJSONDecoder{decoder: json.NewDecoder(r)}
+}
+
+// Decode 解码下一行到v 没有更多数据时返回io.EOF
+func (d *NDJSONDecoder) Decode(v interface{}) error {
+	return d.decoder.Decode(v)
+}
+
+// SSEEvent Server-Sent Events事件
+type SSEEvent struct {
+	ID    string
+	Event string
+	Data  string
+	Retry int
+}
+
+// SSEReader 解码text/event-stream
+type SSEReader struct {
+	scanner *bufio.Scanner
+}
+
+// NewSSEReader 创建SSEReader 单行最大1MB
+func NewSSEReader(r io.Reader) *SSEReader {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	return &SSEReader{scanner: scanner}
+}
+
+// Next 读取下一个事件 没有更多事件时返回io.EOF
+func (s *SSEReader) Next() (*SSEEvent, error) {
+	var (
+		event   SSEEvent
+		data    []string
+		hasData bool
+	)
+	for s.scanner.Scan() {
+		line := s.scanner.Text()
+		// 空行表示事件结束
+		if line == "" {
+			if hasData {
+				event.Data = strings.Join(data, "\n")
+				return &event, nil
+			}
+			event = SSEEvent{}
+			continue
+		}
+		// 冒号开头为注释
+		if strings.HasPrefix(line, ":") {
+			continue
+		}
+
+		field, value := line, ""
+		if i := strings.IndexByte(line, ':'); i >= 0 {
+			field, value = line[:i], strings.TrimPrefix(line[i+1:], " ")
+		}
+		switch field {
+		case "id":
+			event.ID = value
+		case "event":
+			event.Event = value
+		case "data":
+			data = append(data, value)
+			hasData = true
+		case "retry":
+			if n, err := strconv.Atoi(value); err == nil {
+				event.Retry = n
+			}
+		}
+	}
+	if err := s.scanner.Err(); err != nil {
+		return nil, err
+	}
+	if hasData {
+		event.Data = strings.Join(data, "\n")
+		return &event, nil
+	}
+	return nil, io.EOF
+}
@@ -0,0 +1,161 @@
+package http
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestToFileResume(t *testing.T) {
+	content := strings.Repeat("0123456789", 1000)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.ServeContent(w, r, "export.csv", time.Time{}, strings.NewReader(content))
+	}))
+	defer srv.Close()
+
+	dir, err := ioutil.TempDir("", "download")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "export.csv")
+	if err := ioutil.WriteFile(path, []byte(content[:4096]), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	client := NewClient()
+	if r := client.NewRequest(srv.URL).ToFile(path); r.Error != nil || r.StatusCode != http.StatusPartialContent {
+		t.Fatalf("resume got %d %v", r.StatusCode, r.Error)
+	}
+	if r := client.NewRequest(srv.URL).ToFile(path); r.Error != nil {
+		t.Fatalf("complete file got %v", r.Error)
+	}
+
+	got, _ := ioutil.ReadFile(path)
+	if string(got) != content {
+		t.Errorf("file content mismatch len %d", len(got))
+	}
+}
+
+// TestToFileGzip 支持压缩的服务端 文件保存解码后的内容
+func TestToFileGzip(t *testing.T) {
+	content := strings.Repeat("0123456789", 1200)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.Contains(r.Header.Get("Accept-Encoding"), "gzip") && r.Header.Get("Range") == "" {
+			w.Header().Set("Content-Encoding", "gzip")
+			gz := gzip.NewWriter(w)
+			gz.Write([]byte(content))
+			gz.Close()
+			return
+		}
+		http.ServeContent(w, r, "export.csv", time.Time{}, strings.NewReader(content))
+	}))
+	defer srv.Close()
+
+	dir, err := ioutil.TempDir("", "download")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "export.csv")
+	client := NewClient()
+	if r := client.NewRequest(srv.URL).ToFile(path); r.Error != nil {
+		t.Fatal(r.Error)
+	}
+	got, _ := ioutil.ReadFile(path)
+	if string(got) != content {
+		t.Fatalf("download got len %d, want %d", len(got), len(content))
+	}
+
+	// 续传的Range按解码后的长度计算
+	if err := ioutil.WriteFile(path, []byte(content[:5000]), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if r := client.NewRequest(srv.URL).ToFile(path); r.Error != nil || r.StatusCode != http.StatusPartialContent {
+		t.Fatalf("resume got %d %v", r.StatusCode, r.Error)
+	}
+	got, _ = ioutil.ReadFile(path)
+	if string(got) != content {
+		t.Errorf("resume got len %d, want %d", len(got), len(content))
+	}
+}
+
+// TestToFileCompressedRange 服务端忽略identity返回压缩的部分内容时不续传 文件保持不变
+func TestToFileCompressedRange(t *testing.T) {
+	content := strings.Repeat("0123456789", 1200)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Encoding", "gzip")
+		w.Header().Set("Content-Range", fmt.Sprintf("bytes 5000-%d/%d", len(content)-1, len(content)))
+		w.WriteHeader(http.StatusPartialContent)
+		gz := gzip.NewWriter(w)
+		gz.Write([]byte(content[5000:]))
+		gz.Close()
+	}))
+	defer srv.Close()
+
+	dir, err := ioutil.TempDir("", "download")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "export.csv")
+	if err := ioutil.WriteFile(path, []byte(content[:5000]), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if r := NewClient().NewRequest(srv.URL).ToFile(path); r.Error == nil {
+		t.Error("compressed partial content accepted")
+	}
+	got, _ := ioutil.ReadFile(path)
+	if string(got) != content[:5000] {
+		t.Errorf("file changed to len %d", len(got))
+	}
+}
+
+func TestMaxBodySize(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(bytes.Repeat([]byte("x"), 100))
+	}))
+	defer srv.Close()
+
+	client := NewClient(WithMaxBodySize(10))
+	if _, r := client.NewRequest(srv.URL).ToBytes(); r.Error != ErrBodyTooLarge {
+		t.Errorf("client limit got %v", r.Error)
+	}
+	if _, r := client.NewRequest(srv.URL).SetMaxBodySize(100).ToBytes(); r.Error != nil {
+		t.Errorf("request limit got %v", r.Error)
+	}
+
+	var buf bytes.Buffer
+	if r := client.NewRequest(srv.URL).ToWriter(&buf); r.Error != nil || buf.Len() != 100 {
+		t.Errorf("stream got %d %v", buf.Len(), r.Error)
+	}
+}
+
+func TestSSEReader(t *testing.T) {
+	stream := ": comment\nid: 1\nevent: update\ndata: a\ndata: b\n\nretry: 3000\ndata: c\n"
+	reader := NewSSEReader(strings.NewReader(stream))
+
+	event, err := reader.Next()
+	if err != nil || event.ID != "1" || event.Event != "update" || event.Data != "a\nb" {
+		t.Fatalf("first event got %+v %v", event, err)
+	}
+	event, err = reader.Next()
+	if err != nil || event.Retry != 3000 || event.Data != "c" {
+		t.Fatalf("second event got %+v %v", event, err)
+	}
+	if _, err = reader.Next(); err != io.EOF {
+		t.Errorf("end got %v", err)
+	}
+}
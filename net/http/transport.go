@@ -0,0 +1,340 @@
+package http
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"golang.org/x/net/http2"
+	"golang.org/x/net/proxy"
+)
+
+// WithProxyURL 设置固定代理 支持http https socks5 传空字符串时不使用代理
+// HTTP2与H2C仅支持socks5代理
+func WithProxyURL(rawurl string) ClientOption {
+	if rawurl == "" {
+		return func(o *clientOptions) {
+			o.proxy = nil
+			o.proxyURL = nil
+		}
+	}
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		panic(fmt.Sprintf("http: invalid proxy url %q: %v", rawurl, err))
+	}
+	switch u.Scheme {
+	case "http", "https", "socks5":
+	default:
+		panic(fmt.Sprintf("http: unsupported proxy scheme %q", u.Scheme))
+	}
+	return func(o *clientOptions) {
+		o.proxy = http.ProxyURL(u)
+		o.proxyURL = u
+	}
+}
+
+// WithRootCAs 设置校验服务端证书的根证书池 默认使用系统根证书
+func WithRootCAs(pool *x509.CertPool) ClientOption {
+	return func(o *clientOptions) {
+		o.rootCAs = pool
+	}
+}
+
+// WithRootCAFile 从PEM文件加载根证书 读取或解析失败时panic
+func WithRootCAFile(files ...string) ClientOption {
+	pool := x509.NewCertPool()
+	for _, file := range files {
+		data, err := ioutil.ReadFile(file)
+		if err != nil {
+			panic(err)
+		}
+		if !pool.AppendCertsFromPEM(data) {
+			panic(fmt.Sprintf("http: no certificate found in %s", file))
+		}
+	}
+	return WithRootCAs(pool)
+}
+
+// WithClientCert 添加客户端证书 用于mTLS
+func WithClientCert(cert tls.Certificate) ClientOption {
+	return func(o *clientOptions) {
+		o.certificates = append(o.certificates, cert)
+	}
+}
+
+// WithClientCertFile 从PEM文件加载客户端证书与私钥 加载失败时panic
+func WithClientCertFile(certFile, keyFile string) ClientOption {
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		panic(err)
+	}
+	return WithClientCert(cert)
+}
+
+// WithLocalAddr 设置建连时绑定的本地IP 多网卡时指定出口
+func WithLocalAddr(ip string) ClientOption {
+	addr := net.ParseIP(ip)
+	if addr == nil {
+		panic(fmt.Sprintf("http: invalid local address %q", ip))
+	}
+	return func(o *clientOptions) {
+		o.localAddr = &net.TCPAddr{IP: addr}
+	}
+}
+
+// WithResolver 设置域名解析使用的Resolver 默认net.DefaultResolver
+func WithResolver(r *net.Resolver) ClientOption {
+	return func(o *clientOptions) {
+		o.resolver = r
+	}
+}
+
+// WithDNSServer 使用指定的DNS服务器解析域名 addr为host:port
+func WithDNSServer(addr string) ClientOption {
+	if _, _, err := net.SplitHostPort(addr); err != nil {
+		panic(fmt.Sprintf("http: invalid dns server %q: %v", addr, err))
+	}
+	return WithResolver(&net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network, _ string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, network, addr)
+		},
+	})
+}
+
+// WithDNSCache 缓存域名解析结果ttl时长 解析失败时沿用过期的结果
+// 建连时依次尝试解析出的地址
+func WithDNSCache(ttl time.Duration) ClientOption {
+	return func(o *clientOptions) {
+		o.dnsCacheTTL = ttl
+	}
+}
+
+// WithHTTP2HealthCheck 连接readIdleTimeout内未收到数据时发送ping
+// pingTimeout内未收到回复则关闭连接 默认不检查 HTTP1协商为h2时同样生效
+func WithHTTP2HealthCheck(readIdleTimeout, pingTimeout time.Duration) ClientOption {
+	return func(o *clientOptions) {
+		o.readIdleTimeout = readIdleTimeout
+		o.pingTimeout = pingTimeout
+	}
+}
+
+type dialFunc func(ctx context.Context, network, addr string) (net.Conn, error)
+
+func newTransport(o *clientOptions) http.RoundTripper {
+	dial := newDialer(o)
+	tlsConfig := newTLSConfig(o)
+
+	switch o.protocol {
+	case H2C:
+		// h2c为明文连接 https地址仍使用TLS
+		return &h2cTransport{
+			h2c: &http2.Transport{
+				AllowHTTP: true,
+				DialTLSContext: func(ctx context.Context, network, addr string, cfg *tls.Config) (net.Conn, error) {
+					return dial(ctx, network, addr)
+				},
+				ReadIdleTimeout: o.readIdleTimeout,
+				PingTimeout:     o.pingTimeout,
+			},
+			tls: newHTTP2Transport(o, dial, tlsConfig),
+		}
+	case HTTP2:
+		return newHTTP2Transport(o, dial, tlsConfig)
+	}
+
+	transport := &http.Transport{
+		Proxy:                 o.proxy,
+		DialContext:           dial,
+		TLSClientConfig:       tlsConfig,
+		MaxIdleConns:          o.maxIdleConns,
+		IdleConnTimeout:       o.idleConnTimeout,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ExpectContinueTimeout: 1 * time.Second,
+		MaxIdleConnsPerHost:   o.maxIdleConnsPerHost,
+		DisableKeepAlives:     o.disableKeepAlives,
+	}
+	if o.readIdleTimeout > 0 {
+		h2, err := http2.ConfigureTransports(transport)
+		if err != nil {
+			panic(err)
+		}
+		h2.ReadIdleTimeout = o.readIdleTimeout
+		h2.PingTimeout = o.pingTimeout
+	}
+	return transport
+}
+
+func newHTTP2Transport(o *clientOptions, dial dialFunc, tlsConfig *tls.Config) *http2.Transport {
+	return &http2.Transport{
+		TLSClientConfig: tlsConfig,
+		DialTLSContext: func(ctx context.Context, network, addr string, cfg *tls.Config) (net.Conn, error) {
+			conn, err := dial(ctx, network, addr)
+			if err != nil {
+				return nil, err
+			}
+			tlsConn := tls.Client(conn, cfg)
+			if err := tlsConn.Handshake(); err != nil {
+				conn.Close()
+				return nil, err
+			}
+			return tlsConn, nil
+		},
+		ReadIdleTimeout: o.readIdleTimeout,
+		PingTimeout:     o.pingTimeout,
+	}
+}
+
+// newTLSConfig 在WithTLSConfig的副本上设置根证书与客户端证书
+func newTLSConfig(o *clientOptions) *tls.Config {
+	if o.rootCAs == nil && len(o.certificates) == 0 {
+		return o.tlsConfig
+	}
+	cfg := &tls.Config{}
+	if o.tlsConfig != nil {
+		cfg = o.tlsConfig.Clone()
+	}
+	if o.rootCAs != nil {
+		cfg.RootCAs = o.rootCAs
+	}
+	cfg.Certificates = append(cfg.Certificates, o.certificates...)
+	return cfg
+}
+
+// newDialer 按LocalAddr Resolver与DNS缓存建连 HTTP2与H2C的socks5代理在此拨号
+func newDialer(o *clientOptions) dialFunc {
+	dialer := &net.Dialer{
+		Timeout:   o.dialTimeout,
+		KeepAlive: o.keepAlive,
+		LocalAddr: o.localAddr,
+		Resolver:  o.resolver,
+	}
+	dial := dialFunc(dialer.DialContext)
+	if o.dnsCacheTTL > 0 {
+		resolver := o.resolver
+		if resolver == nil {
+			resolver = net.DefaultResolver
+		}
+		cache := &dnsCache{ttl: o.dnsCacheTTL, lookup: resolver.LookupIPAddr, entries: make(map[string]*dnsEntry)}
+		dial = cache.dial(dialer.DialContext)
+	}
+
+	if o.protocol == HTTP1 || o.proxyURL == nil {
+		return dial
+	}
+	if o.proxyURL.Scheme != "socks5" {
+		panic("http: HTTP2 and H2C clients only support socks5 proxy")
+	}
+	var auth *proxy.Auth
+	if user := o.proxyURL.User; user != nil {
+		password, _ := user.Password()
+		auth = &proxy.Auth{User: user.Username(), Password: password}
+	}
+	socks, err := proxy.SOCKS5("tcp", o.proxyURL.Host, auth, forwardDialer(dial))
+	if err != nil {
+		panic(err)
+	}
+	return socks.(proxy.ContextDialer).DialContext
+}
+
+// forwardDialer socks5连接代理服务器时使用的dialer
+type forwardDialer dialFunc
+
+func (f forwardDialer) Dial(network, addr string) (net.Conn, error) {
+	return f(context.Background(), network, addr)
+}
+
+func (f forwardDialer) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	return f(ctx, network, addr)
+}
+
+// h2cTransport http地址使用h2c https地址使用基于TLS的h2
+type h2cTransport struct {
+	h2c *http2.Transport
+	tls *http2.Transport
+}
+
+func (t *h2cTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.URL.Scheme == "https" {
+		return t.tls.RoundTrip(req)
+	}
+	return t.h2c.RoundTrip(req)
+}
+
+func (t *h2cTransport) CloseIdleConnections() {
+	t.h2c.CloseIdleConnections()
+	t.tls.CloseIdleConnections()
+}
+
+type dnsEntry struct {
+	addrs  []net.IPAddr
+	expire time.Time
+}
+
+// dnsCache 缓存域名解析结果
+type dnsCache struct {
+	ttl    time.Duration
+	lookup func(ctx context.Context, host string) ([]net.IPAddr, error)
+
+	mu      sync.Mutex
+	entries map[string]*dnsEntry
+}
+
+func (c *dnsCache) resolve(ctx context.Context, host string) ([]net.IPAddr, error) {
+	c.mu.Lock()
+	entry := c.entries[host]
+	c.mu.Unlock()
+	if entry != nil && time.Now().Before(entry.expire) {
+		return entry.addrs, nil
+	}
+
+	addrs, err := c.lookup(ctx, host)
+	if err != nil || len(addrs) == 0 {
+		if entry != nil {
+			return entry.addrs, nil
+		}
+		if err == nil {
+			err = &net.DNSError{Err: "no such host", Name: host, IsNotFound: true}
+		}
+		return nil, err
+	}
+	c.mu.Lock()
+	c.entries[host] = &dnsEntry{addrs: addrs, expire: time.Now().Add(c.ttl)}
+	c.mu.Unlock()
+	return addrs, nil
+}
+
+func (c *dnsCache) dial(dial dialFunc) dialFunc {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		host, port, err := net.SplitHostPort(addr)
+		if err != nil || net.ParseIP(host) != nil {
+			return dial(ctx, network, addr)
+		}
+		addrs, err := c.resolve(ctx, host)
+		if err != nil {
+			return nil, err
+		}
+
+		lastErr := errors.New("http: no address dialed")
+		for _, ip := range addrs {
+			conn, err := dial(ctx, network, net.JoinHostPort(ip.String(), port))
+			if err == nil {
+				return conn, nil
+			}
+			lastErr = err
+			if ctx.Err() != nil {
+				break
+			}
+		}
+		return nil, lastErr
+	}
+}
@@ -0,0 +1,186 @@
+package http
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type testCert struct {
+	cert    *x509.Certificate
+	key     *ecdsa.PrivateKey
+	certPEM []byte
+	keyPEM  []byte
+}
+
+func newTestCert(t *testing.T, name string, parent *testCert, usage x509.ExtKeyUsage) *testCert {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:  []x509.ExtKeyUsage{usage},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	signer, signerKey := tmpl, key
+	if parent == nil {
+		tmpl.IsCA, tmpl.BasicConstraintsValid = true, true
+	} else {
+		signer, signerKey = parent.cert, parent.key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, signer, &key.PublicKey, signerKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+	keyDER, _ := x509.MarshalECPrivateKey(key)
+	return &testCert{
+		cert:    cert,
+		key:     key,
+		certPEM: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		keyPEM:  pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}),
+	}
+}
+
+func TestMutualTLS(t *testing.T) {
+	ca := newTestCert(t, "ca", nil, x509.ExtKeyUsageAny)
+	server := newTestCert(t, "server", ca, x509.ExtKeyUsageServerAuth)
+	client := newTestCert(t, "client", ca, x509.ExtKeyUsageClientAuth)
+
+	dir, err := ioutil.TempDir("", "mtls")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	write := func(name string, data []byte) string {
+		file := filepath.Join(dir, name)
+		if err := ioutil.WriteFile(file, data, 0600); err != nil {
+			t.Fatal(err)
+		}
+		return file
+	}
+	caFile := write("ca.pem", ca.certPEM)
+	certFile, keyFile := write("client.pem", client.certPEM), write("client.key", client.keyPEM)
+
+	serverCert, err := tls.X509KeyPair(server.certPEM, server.keyPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pool := x509.NewCertPool()
+	pool.AddCert(ca.cert)
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.TLS.PeerCertificates[0].Subject.CommonName + " " + r.Proto))
+	}))
+	srv.EnableHTTP2 = true
+	srv.TLS = &tls.Config{
+		Certificates: []tls.Certificate{serverCert},
+		ClientCAs:    pool,
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+	}
+	srv.StartTLS()
+	defer srv.Close()
+
+	for _, protocol := range []Protocol{HTTP1, HTTP2, H2C} {
+		c := NewClient(WithProtocol(protocol), WithRootCAFile(caFile), WithClientCertFile(certFile, keyFile),
+			WithHTTP2HealthCheck(time.Second, time.Second))
+		body, r := c.NewRequest(srv.URL).ToString()
+		if r.Error != nil || body != "client HTTP/2.0" {
+			t.Errorf("protocol %d got %q %v", protocol, body, r.Error)
+		}
+	}
+
+	if _, r := NewClient(WithRootCAFile(caFile)).NewRequest(srv.URL).ToString(); r.Error == nil {
+		t.Error("request without client certificate succeeded")
+	}
+}
+
+func TestDNSCache(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer srv.Close()
+	_, port, _ := net.SplitHostPort(srv.Listener.Addr().String())
+
+	var lookups int32
+	cache := &dnsCache{
+		ttl: time.Minute,
+		lookup: func(ctx context.Context, host string) ([]net.IPAddr, error) {
+			if atomic.AddInt32(&lookups, 1) > 1 {
+				return nil, &net.DNSError{Err: "server misbehaving", Name: host}
+			}
+			// 第一个地址不可达 依次尝试下一个
+			return []net.IPAddr{{IP: net.ParseIP("127.0.0.2")}, {IP: net.ParseIP("127.0.0.1")}}, nil
+		},
+		entries: make(map[string]*dnsEntry),
+	}
+	var dialer net.Dialer
+	dial := cache.dial(func(ctx context.Context, network, addr string) (net.Conn, error) {
+		if host, _, _ := net.SplitHostPort(addr); host != "127.0.0.1" {
+			return nil, &net.OpError{Op: "dial", Net: network, Err: errors.New("unreachable")}
+		}
+		return dialer.DialContext(ctx, network, addr)
+	})
+
+	for i := 0; i < 3; i++ {
+		if i == 2 {
+			// 过期后解析失败沿用旧结果
+			cache.entries["svc.local"].expire = time.Now()
+		}
+		conn, err := dial(context.Background(), "tcp", net.JoinHostPort("svc.local", port))
+		if err != nil {
+			t.Fatal(err)
+		}
+		conn.Close()
+	}
+	if lookups != 2 {
+		t.Errorf("lookups %d", lookups)
+	}
+}
+
+func TestProxyURL(t *testing.T) {
+	var proxied int32
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&proxied, 1)
+		w.Write([]byte(r.URL.String()))
+	}))
+	defer proxy.Close()
+
+	body, r := NewClient(WithProxyURL(proxy.URL)).NewRequest("http://example.invalid/path").ToString()
+	if r.Error != nil || body != "http://example.invalid/path" || proxied != 1 {
+		t.Errorf("got %q %v", body, r.Error)
+	}
+
+	for _, bad := range []func(){
+		func() { WithProxyURL("ftp://127.0.0.1") },
+		func() { NewClient(WithProtocol(HTTP2), WithProxyURL(proxy.URL)) },
+		func() { WithLocalAddr("localhost") },
+	} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Error("expected panic")
+				}
+			}()
+			bad()
+		}()
+	}
+}
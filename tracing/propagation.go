@@ -0,0 +1,113 @@
+package tracing
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// TraceparentHeader W3C Trace Context请求头
+const TraceparentHeader = "traceparent"
+
+// Format 按W3C traceparent格式编码 version固定为00
+func Format(sc SpanContext) string {
+	flags := "00"
+	if sc.Sampled {
+		flags = "01"
+	}
+	return fmt.Sprintf("00-%s-%s-%s", sc.TraceID, sc.SpanID, flags)
+}
+
+// Parse 解析traceparent 格式错误或ID无效时ok为false
+func Parse(traceparent string) (sc SpanContext, ok bool) {
+	parts := strings.Split(strings.TrimSpace(traceparent), "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || parts[0] == "ff" {
+		return SpanContext{}, false
+	}
+	// version 00 必须正好4段 更高版本允许追加字段
+	if parts[0] == "00" && len(parts) != 4 {
+		return SpanContext{}, false
+	}
+	if len(parts[1]) != 32 || len(parts[2]) != 16 || len(parts[3]) != 2 {
+		return SpanContext{}, false
+	}
+
+	if _, err := hex.Decode(sc.TraceID[:], []byte(parts[1])); err != nil {
+		return SpanContext{}, false
+	}
+	if _, err := hex.Decode(sc.SpanID[:], []byte(parts[2])); err != nil {
+		return SpanContext{}, false
+	}
+	flags, err := hex.DecodeString(parts[3])
+	if err != nil {
+		return SpanContext{}, false
+	}
+	sc.Sampled = flags[0]&0x01 == 0x01
+	return sc, sc.IsValid()
+}
+
+// Inject 将ctx中的链路信息通过set写出 ctx中无链路信息时不写
+func Inject(ctx context.Context, set func(key, value string)) {
+	sc := SpanContextFromContext(ctx)
+	if !sc.IsValid() {
+		return
+	}
+	set(TraceparentHeader, Format(sc))
+}
+
+// Extract 通过get读取上游链路信息 返回携带远端SpanContext的ctx
+func Extract(ctx context.Context, get func(key string) string) context.Context {
+	sc, ok := Parse(get(TraceparentHeader))
+	if !ok {
+		return ctx
+	}
+	return ContextWithRemoteSpanContext(ctx, sc)
+}
+
+// InjectHeader 写入http请求头
+func InjectHeader(ctx context.Context, header http.Header) {
+	Inject(ctx, header.Set)
+}
+
+// ExtractHeader 从http请求头读取
+func ExtractHeader(ctx context.Context, header http.Header) context.Context {
+	return Extract(ctx, header.Get)
+}
+
+// Transport 为每次请求创建client span并写入traceparent的RoundTripper
+type Transport struct {
+	Base http.RoundTripper
+}
+
+// NewTransport base为nil时使用http.DefaultTransport
+func NewTransport(base http.RoundTripper) *Transport {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return &Transport{Base: base}
+}
+
+// RoundTrip 实现http.RoundTripper
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx, span := StartSpan(req.Context(), req.Method+" "+req.URL.Host, KindClient)
+	defer span.End()
+	span.SetAttribute("http.method", req.Method)
+	span.SetAttribute("http.url", req.URL.String())
+
+	// RoundTripper不能修改调用方的请求
+	req = req.Clone(ctx)
+	InjectHeader(ctx, req.Header)
+
+	resp, err := t.Base.RoundTrip(req)
+	if err != nil {
+		span.SetError(err)
+		return nil, err
+	}
+	span.SetAttribute("http.status_code", fmt.Sprint(resp.StatusCode))
+	if resp.StatusCode >= 500 {
+		span.SetError(fmt.Errorf("http status %d", resp.StatusCode))
+	}
+	return resp, nil
+}
@@ -0,0 +1,235 @@
+package tracing
+
+import (
+	"context"
+	"encoding/hex"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// Span类型
+const (
+	KindInternal = "internal"
+	KindServer   = "server"
+	KindClient   = "client"
+	KindProducer = "producer"
+	KindConsumer = "consumer"
+)
+
+// TraceID 16字节链路ID
+type TraceID [16]byte
+
+// String 32位小写十六进制
+func (t TraceID) String() string {
+	return hex.EncodeToString(t[:])
+}
+
+// IsValid 全0为无效ID
+func (t TraceID) IsValid() bool {
+	return t != TraceID{}
+}
+
+// SpanID 8字节span ID
+type SpanID [8]byte
+
+// String 16位小写十六进制
+func (s SpanID) String() string {
+	return hex.EncodeToString(s[:])
+}
+
+// IsValid 全0为无效ID
+func (s SpanID) IsValid() bool {
+	return s != SpanID{}
+}
+
+// SpanContext 跨进程传递的链路信息
+type SpanContext struct {
+	TraceID TraceID
+	SpanID  SpanID
+	Sampled bool
+}
+
+// IsValid TraceID与SpanID均有效
+func (sc SpanContext) IsValid() bool {
+	return sc.TraceID.IsValid() && sc.SpanID.IsValid()
+}
+
+// Span 一次调用的耗时与属性 End后交给Exporter
+type Span struct {
+	Name         string
+	Kind         string
+	SpanContext  SpanContext
+	ParentSpanID SpanID
+	StartTime    time.Time
+	EndTime      time.Time
+	Attributes   map[string]string
+	Err          error
+
+	mu    sync.Mutex
+	ended bool
+}
+
+// SetAttribute 设置属性
+func (s *Span) SetAttribute(key, value string) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.Attributes == nil {
+		s.Attributes = make(map[string]string)
+	}
+	s.Attributes[key] = value
+}
+
+// SetError 记录错误 err为nil时忽略
+func (s *Span) SetError(err error) {
+	if s == nil || err == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.Err = err
+}
+
+// End 结束span并导出 重复调用只生效一次
+func (s *Span) End() {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	if s.ended {
+		s.mu.Unlock()
+		return
+	}
+	s.ended = true
+	s.EndTime = time.Now()
+	s.mu.Unlock()
+
+	if exporter := getExporter(); exporter != nil && s.SpanContext.Sampled {
+		exporter.ExportSpan(s)
+	}
+}
+
+// Duration span耗时
+func (s *Span) Duration() time.Duration {
+	return s.EndTime.Sub(s.StartTime)
+}
+
+// Exporter span导出接口
+type Exporter interface {
+	ExportSpan(span *Span)
+}
+
+var (
+	exporterMu sync.RWMutex
+	exporter   Exporter
+)
+
+// SetExporter 设置全局Exporter nil表示不导出
+func SetExporter(e Exporter) {
+	exporterMu.Lock()
+	defer exporterMu.Unlock()
+	exporter = e
+}
+
+func getExporter() Exporter {
+	exporterMu.RLock()
+	defer exporterMu.RUnlock()
+	return exporter
+}
+
+type spanKey struct{}
+type remoteKey struct{}
+
+// StartSpan 创建span ctx中有span或远端SpanContext时作为其子span 否则开启新链路
+func StartSpan(ctx context.Context, name, kind string) (context.Context, *Span) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	span := &Span{
+		Name:      name,
+		Kind:      kind,
+		StartTime: time.Now(),
+	}
+	if parent := SpanContextFromContext(ctx); parent.IsValid() {
+		span.SpanContext.TraceID = parent.TraceID
+		span.SpanContext.Sampled = parent.Sampled
+		span.ParentSpanID = parent.SpanID
+	} else {
+		span.SpanContext.TraceID = newTraceID()
+		span.SpanContext.Sampled = true
+	}
+	span.SpanContext.SpanID = newSpanID()
+
+	return context.WithValue(ctx, spanKey{}, span), span
+}
+
+// FromContext 获取ctx中当前的span
+func FromContext(ctx context.Context) *Span {
+	if ctx == nil {
+		return nil
+	}
+	span, _ := ctx.Value(spanKey{}).(*Span)
+	return span
+}
+
+// ContextWithRemoteSpanContext 保存从上游提取的SpanContext 之后的StartSpan以其为父
+func ContextWithRemoteSpanContext(ctx context.Context, sc SpanContext) context.Context {
+	return context.WithValue(ctx, remoteKey{}, sc)
+}
+
+// SpanContextFromContext 优先返回当前span 其次返回远端SpanContext
+func SpanContextFromContext(ctx context.Context) SpanContext {
+	if ctx == nil {
+		return SpanContext{}
+	}
+	if span := FromContext(ctx); span != nil {
+		return span.SpanContext
+	}
+	sc, _ := ctx.Value(remoteKey{}).(SpanContext)
+	return sc
+}
+
+// GetTraceID 获取ctx中的trace ID 没有时返回空串
+func GetTraceID(ctx context.Context) string {
+	sc := SpanContextFromContext(ctx)
+	if !sc.TraceID.IsValid() {
+		return ""
+	}
+	return sc.TraceID.String()
+}
+
+// GetSpanID 获取ctx中的span ID 没有时返回空串
+func GetSpanID(ctx context.Context) string {
+	sc := SpanContextFromContext(ctx)
+	if !sc.SpanID.IsValid() {
+		return ""
+	}
+	return sc.SpanID.String()
+}
+
+var (
+	randMu sync.Mutex
+	random = rand.New(rand.NewSource(time.Now().UnixNano()))
+)
+
+func newTraceID() (id TraceID) {
+	randMu.Lock()
+	defer randMu.Unlock()
+	for !id.IsValid() {
+		random.Read(id[:])
+	}
+	return
+}
+
+func newSpanID() (id SpanID) {
+	randMu.Lock()
+	defer randMu.Unlock()
+	for !id.IsValid() {
+		random.Read(id[:])
+	}
+	return
+}
@@ -0,0 +1,70 @@
+package tracing_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	legogin "github.com/Tokumicn/lego-lib/gin"
+	legohttp "github.com/Tokumicn/lego-lib/net/http"
+	"github.com/Tokumicn/lego-lib/tracing"
+)
+
+func TestParse(t *testing.T) {
+	raw := "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+	sc, ok := tracing.Parse(raw)
+	if !ok || !sc.Sampled {
+		t.Fatalf("parse %q failed", raw)
+	}
+	if got := tracing.Format(sc); got != raw {
+		t.Errorf("format got %q", got)
+	}
+
+	for _, invalid := range []string{"", "00-00000000000000000000000000000000-00f067aa0ba902b7-01", "00-xyz-00f067aa0ba902b7-01"} {
+		if _, ok := tracing.Parse(invalid); ok {
+			t.Errorf("parse %q should fail", invalid)
+		}
+	}
+}
+
+func TestPropagation(t *testing.T) {
+	exporter := tracing.NewInMemoryExporter()
+	tracing.SetExporter(exporter)
+	defer tracing.SetExporter(nil)
+
+	var downstream string
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		downstream = r.Header.Get(tracing.TraceparentHeader)
+	}))
+	defer upstream.Close()
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(legogin.Tracing())
+	r.GET("/orders", func(c *gin.Context) {
+		legohttp.NewClient().NewRequest(upstream.URL).SetContext(c.Request.Context()).ToBytes()
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/orders", nil)
+	req.Header.Set(tracing.TraceparentHeader, "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	r.ServeHTTP(httptest.NewRecorder(), req)
+
+	spans := exporter.Spans()
+	if len(spans) != 2 {
+		t.Fatalf("spans got %d", len(spans))
+	}
+	client, server := spans[0], spans[1]
+	if server.Kind != tracing.KindServer || server.ParentSpanID.String() != "00f067aa0ba902b7" {
+		t.Errorf("server span got %+v", server)
+	}
+	if client.ParentSpanID != server.SpanContext.SpanID {
+		t.Error("client span should be child of server span")
+	}
+
+	sc, ok := tracing.Parse(downstream)
+	if !ok || sc.TraceID.String() != "4bf92f3577b34da6a3ce929d0e0e4736" || sc.SpanID != client.SpanContext.SpanID {
+		t.Errorf("downstream traceparent got %q", downstream)
+	}
+}
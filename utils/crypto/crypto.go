@@ -4,9 +4,39 @@ import (
 	"crypto/hmac"
 	"crypto/md5"
 	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
 	"encoding/hex"
+	"fmt"
+	"hash"
 )
 
+// Algorithm 摘要算法 可直接用于配置
+type Algorithm string
+
+// 支持的摘要算法
+const (
+	MD5    Algorithm = "md5"
+	SHA1   Algorithm = "sha1"
+	SHA256 Algorithm = "sha256"
+	SHA512 Algorithm = "sha512"
+)
+
+// New 返回算法对应的hash构造函数
+func (alg Algorithm) New() (func() hash.Hash, error) {
+	switch alg {
+	case MD5:
+		return md5.New, nil
+	case SHA1:
+		return sha1.New, nil
+	case SHA256, "":
+		return sha256.New, nil
+	case SHA512:
+		return sha512.New, nil
+	}
+	return nil, fmt.Errorf("crypto: unsupported algorithm %q", string(alg))
+}
+
 // Md5 md5编码
 func Md5(str string) (string, error) {
 	m := md5.New()
@@ -25,6 +55,19 @@ func Hmac(key, str string) (string, error) {
 	return hex.EncodeToString(h.Sum(nil)), nil
 }
 
+// HmacWith 使用指定算法的hmac编码 alg为空时使用sha256
+func HmacWith(alg Algorithm, key, str string) (string, error) {
+	fn, err := alg.New()
+	if err != nil {
+		return "", err
+	}
+	h := hmac.New(fn, []byte(key))
+	if _, err := h.Write([]byte(str)); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
 // Sha1 sha1编码
 func Sha1(str string) (string, error) {
 	sh := sha1.New()